@@ -0,0 +1,110 @@
+package minnow
+
+import (
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// AppendFile is a file which a Writer can append to. *os.File and Buffer both
+// are AppendFiles.
+type AppendFile interface {
+	io.ReaderAt
+	io.WriteSeeker
+}
+
+// OpenAppend opens an existing minnow file so that more headers, groups and
+// blocks can be added to it. New data is written after the file's current
+// tail and, on Close, a new tail is written after that. The old tail stays
+// valid until the new one is complete, so if the Writer is never closed, the
+// file still contains its original contents.
+//
+// Blocks can't be added to the file's existing groups: a new group must be
+// started before Data is called. Header and block indices continue on from
+// the ones already in the file.
+func OpenAppend(fname string) (*Writer, error) {
+	f, err := os.OpenFile(fname, os.O_RDWR, 0)
+	if err != nil { return nil, err }
+
+	wr, err := newAppendWriter(f, fname)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	wr.closer = f
+	wr.fname = fname
+	wr.appendSize, err = f.Seek(0, 1)
+	if err == nil {
+		err = binaryRead(io.NewSectionReader(f, 0, wr.appendSize),
+			&wr.appendHeader)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return wr, nil
+}
+
+// NewAppendWriter is the same as OpenAppend, but appends to the minnow file
+// stored in f, starting at f's current position. As with NewWriter, the
+// minnow file must be the last thing in f. Closing the Writer does not close
+// f.
+func NewAppendWriter(f AppendFile) (*Writer, error) {
+	return newAppendWriter(f, "minnow file")
+}
+
+// newAppendWriter reads the tail of the minnow file starting at f's current
+// position and returns a Writer positioned at the end of f. fname is only
+// used in error messages.
+func newAppendWriter(f AppendFile, fname string) (*Writer, error) {
+	start, err := f.Seek(0, 1)
+	if err != nil { return nil, err }
+	end, err := f.Seek(0, 2)
+	if err != nil { return nil, err }
+	rd, err := newReader(io.NewSectionReader(f, start, end - start), fname)
+	if err != nil { return nil, err }
+
+	wr := &Writer{
+		f: f, start: start, currGroup: -1, sync: true,
+		headers: rd.headers, blocks: rd.blocks,
+		writers: rd.readers,
+		headerOffsets: rd.headerOffsets, headerSizes: rd.headerSizes,
+		headerNames: rd.headerNames, headerSchemas: rd.headerSchemas,
+		groupOffsets: rd.groupOffsets,
+		groupBlocks: make([]int64, rd.groups),
+		headerCRCs: rd.headerCRCs, blockCRCs: rd.blockCRCs,
+		blockStats: rd.blockStats,
+	}
+	wr.cw.w = f
+	for _, i := range rd.blockIndex { wr.groupBlocks[i]++ }
+
+	// Files written before version 2 don't store checksums, so they need to
+	// be computed before the new tail can be written.
+	if rd.version < 2 {
+		if err := wr.computeCRCs(rd); err != nil { return nil, err }
+	}
+
+	if _, err := f.Seek(0, 2); err != nil { return nil, err }
+	return wr, nil
+}
+
+// computeCRCs computes the checksums of every header and block in rd.
+func (wr *Writer) computeCRCs(rd *Reader) error {
+	wr.headerCRCs = make([]uint32, rd.headers)
+	for i := range wr.headerCRCs {
+		buf := make([]byte, rd.headerSizes[i])
+		if err := rd.readAt(buf, rd.headerOffsets[i]); err != nil {
+			return err
+		}
+		wr.headerCRCs[i] = crc32.Checksum(buf, crcTable)
+	}
+
+	wr.blockCRCs = make([]uint32, rd.blocks)
+	for b := range wr.blockCRCs {
+		buf, err := rd.readBlock(b)
+		if err != nil { return err }
+		wr.blockCRCs[b] = crc32.Checksum(*buf, crcTable)
+		putBytes(buf)
+	}
+	return nil
+}
@@ -2,8 +2,8 @@ package bit
 
 import (
 	"fmt"
+	"io"
 	"math"
-	"os"
 )
 
 // Array is an array in in which elements are packed with a width of
@@ -81,6 +81,45 @@ func (arr *Array) Slice(out []uint64) {
 	}
 }
 
+// Get returns the ith element of the Array without unpacking any of the
+// others.
+func (arr *Array) Get(i int) uint64 {
+	if i < 0 || i >= arr.Length {
+		panic(fmt.Sprintf("Index %d out of range for Array of length %d.",
+			i, arr.Length))
+	}
+	bits := uint(arr.Bits)
+	if bits == 0 { return 0 }
+
+	// An element can straddle up to nine bytes.
+	start := uint(i)*bits
+	startByte, shift := int(start / 8), start % 8
+	nBytes := int((shift + bits + 7) / 8)
+
+	x := uint64(0)
+	for j := 0; j < nBytes && j < 8; j++ {
+		x |= uint64(arr.Data[startByte + j]) << (8*uint(j))
+	}
+	x >>= shift
+	if nBytes > 8 { x |= uint64(arr.Data[startByte + 8]) << (64 - shift) }
+
+	if bits < 64 { x &= (uint64(1) << bits) - 1 }
+	return x
+}
+
+// SliceRange converts elements [start, end) of the Array into a standard
+// uint64 slice. len(out) must be at least end - start.
+func (arr *Array) SliceRange(start, end int, out []uint64) {
+	if start < 0 || end > arr.Length || start > end {
+		panic(fmt.Sprintf("Range [%d, %d) out of range for Array of " +
+			"length %d.", start, end, arr.Length))
+	} else if len(out) < end - start {
+		panic(fmt.Sprintf("Range [%d, %d) has length %d, but out buffer " +
+			"has length %d.", start, end, end - start, len(out)))
+	}
+	for i := start; i < end; i++ { out[i - start] = arr.Get(i) }
+}
+
 func BufferedArray(bits int, x []uint64, b []byte) *Array {
 	if bits > 64 {
 		panic("Cannot pack more than 64 bits per element into a bit.Array")
@@ -158,26 +197,35 @@ func (ab *ArrayBuffer) Bits(x []uint64) int {
 	return PrecisionNeeded(uint64(max))
 }
 
-func (ab *ArrayBuffer) Write(f *os.File, x []uint64, bits int) {
-	if bits == 0 { return }
+// Write packs the bits least significant bits of each element of x into f.
+func (ab *ArrayBuffer) Write(f io.Writer, x []uint64, bits int) error {
+	if bits == 0 { return nil }
 
 	ab.setByteSize(ArrayBytes(bits, len(x)))
 	arr := BufferedArray(bits, x, ab.byteBuf)
-	f.Write(arr.Data)
+	_, err := f.Write(arr.Data)
+	return err
 }
 
-func (ab *ArrayBuffer) Read(f *os.File, bits, n int) []uint64 {
+// Read reads n packed elements with the given width from f. The returned
+// slice is owned by the ArrayBuffer and will be overwritten by the next call.
+// If f ends before all n elements could be read, io.ErrUnexpectedEOF is
+// returned.
+func (ab *ArrayBuffer) Read(f io.Reader, bits, n int) ([]uint64, error) {
 	ab.setUint64Size(n)
 	if bits == 0 {
 		for i := range ab.uint64Buf { ab.uint64Buf[i] = 0 }
-		return ab.uint64Buf
+		return ab.uint64Buf, nil
 	}
 
 	ab.setByteSize(ArrayBytes(bits, n))
 	arr :=Array{ Length: n, Bits: byte(bits), Data: ab.byteBuf }
-	f.Read(ab.byteBuf)
+	if _, err := io.ReadFull(f, ab.byteBuf); err != nil {
+		if err == io.EOF { err = io.ErrUnexpectedEOF }
+		return nil, err
+	}
 	arr.Slice(ab.uint64Buf)
-	return ab.uint64Buf
+	return ab.uint64Buf, nil
 }
 
 func (ab *ArrayBuffer) Uint64(n int) []uint64 {
@@ -1,6 +1,7 @@
 package bit
 
 import (
+	"io"
 	"os"
 	"math/rand"
 	"testing"
@@ -30,6 +31,38 @@ func TestArray(t *testing.T) {
 	}
 }
 
+func TestArrayGet(t *testing.T) {
+	data := make([]uint64, 77)
+	out := make([]uint64, len(data))
+	for i := range data { data[i] = rand.Uint64() }
+
+	zero := &Array{ Length: 3, Bits: 0 }
+	if x := zero.Get(2); x != 0 {
+		t.Errorf("Get(2) = %x for 0-bit Array", x)
+	}
+
+	for bits := 1; bits <= 64; bits++ {
+		arr := NewArray(bits, data)
+		mask := ^(^uint64(0) << uint(bits))
+
+		for i := range data {
+			if x := arr.Get(i); x != data[i] & mask {
+				t.Errorf("%d bits: data[%d] & %x = %x, but Get(%d) = %x",
+					bits, i, mask, data[i] & mask, i, x)
+			}
+		}
+
+		start, end := 13, 50
+		arr.SliceRange(start, end, out)
+		for i := start; i < end; i++ {
+			if out[i - start] != data[i] & mask {
+				t.Errorf("%d bits: data[%d] & %x = %x, but SliceRange " +
+					"gave %x", bits, i, mask, data[i] & mask, out[i - start])
+			}
+		}
+	}
+}
+
 func TestArrayBuffer(t *testing.T) {
 	fname := "../../test_files/array_buffer.test"
 	f, err := os.Create(fname)
@@ -43,7 +76,9 @@ func TestArrayBuffer(t *testing.T) {
 		data := ab.Uint64(lengths[i])
 		for j := range data { data[j] = uint64(j) }
 		bits[i] = ab.Bits(data)
-		ab.Write(f, data, bits[i])
+		if err := ab.Write(f, data, bits[i]); err != nil {
+			t.Fatalf("Could not write array_%d: %s", i, err.Error())
+		}
 	}
 
 	f.Close()
@@ -54,7 +89,10 @@ func TestArrayBuffer(t *testing.T) {
 	if err != nil { panic(err.Error()) }
 
 	for i := range lengths {
-		data := ab.Read(f, bits[i], lengths[i])
+		data, err := ab.Read(f, bits[i], lengths[i])
+		if err != nil {
+			t.Fatalf("Could not read array_%d: %s", i, err.Error())
+		}
 		if len(data) != lengths[i] {
 			t.Errorf("Expected len(array_%d) = %d, but got %d.", 
 				i, lengths[i], len(data))
@@ -66,6 +104,38 @@ func TestArrayBuffer(t *testing.T) {
 			}
 		}
 	}
+
+	if _, err := ab.Read(f, 8, 1); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF after the end of the " +
+			"file, but got %v.", err)
+	}
+	f.Close()
+}
+
+func TestStream(t *testing.T) {
+	widths := []int{ 1, 3, 8, 13, 32, 33, 64, 0, 7 }
+	x := make([]uint64, len(widths))
+	for i := range x { x[i] = rand.Uint64() & (1<<uint(widths[i]) - 1) }
+	x[6] = 1<<63 + 5
+
+	w := &StreamWriter{ }
+	for i := range x { w.Write(x[i], widths[i]) }
+	r := NewStreamReader(w.Bytes())
+
+	for i := range x {
+		out, err := r.Read(widths[i])
+		if err != nil { t.Fatal(err) }
+		if out != x[i] {
+			t.Errorf("%d) Expected %x, got %x.", i, x[i], out)
+		}
+	}
+	// 161 bits were written, so there are 7 bits of padding.
+	for i := 0; i < 7; i++ {
+		if _, err := r.ReadBit(); err != nil { t.Fatal(err) }
+	}
+	if _, err := r.ReadBit(); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, got %v.", err)
+	}
 }
 
 func benchmarkReadArrayN(b *testing.B, bits int) {
@@ -0,0 +1,81 @@
+package bit
+
+import (
+	"io"
+)
+
+// StreamWriter packs variable-width values into a byte slice, starting from
+// the least significant bit of each byte.
+type StreamWriter struct {
+	buf []byte
+	acc uint64
+	nAcc uint
+}
+
+// Reset empties the StreamWriter so that its buffer can be reused.
+func (w *StreamWriter) Reset() {
+	w.buf, w.acc, w.nAcc = w.buf[:0], 0, 0
+}
+
+// Write appends the lowest n bits of x to the stream. n must be at most 64.
+func (w *StreamWriter) Write(x uint64, n int) {
+	for n > 0 {
+		k := n
+		if k > 32 { k = 32 }
+		w.acc |= (x & (1<<uint(k) - 1)) << w.nAcc
+		w.nAcc += uint(k)
+		x >>= uint(k)
+		n -= k
+
+		for w.nAcc >= 8 {
+			w.buf = append(w.buf, byte(w.acc))
+			w.acc >>= 8
+			w.nAcc -= 8
+		}
+	}
+}
+
+// Bytes returns the contents of the stream, padding the last byte with zeros.
+// The returned slice is only valid until the next call to Write or Reset.
+func (w *StreamWriter) Bytes() []byte {
+	if w.nAcc == 0 { return w.buf }
+	return append(w.buf, byte(w.acc))
+}
+
+// StreamReader reads values written by a StreamWriter.
+type StreamReader struct {
+	data []byte
+	pos int
+}
+
+// NewStreamReader returns a StreamReader which reads from data.
+func NewStreamReader(data []byte) *StreamReader {
+	return &StreamReader{ data: data }
+}
+
+// ReadBit reads a single bit from the stream. It returns io.ErrUnexpectedEOF
+// if the stream has been exhausted.
+func (r *StreamReader) ReadBit() (uint64, error) {
+	if r.pos >= 8*len(r.data) { return 0, io.ErrUnexpectedEOF }
+	b := uint64(r.data[r.pos >> 3] >> uint(r.pos & 7)) & 1
+	r.pos++
+	return b, nil
+}
+
+// Read reads an n-bit value from the stream. n must be at most 64. It returns
+// io.ErrUnexpectedEOF if the stream has been exhausted.
+func (r *StreamReader) Read(n int) (uint64, error) {
+	if r.pos + n > 8*len(r.data) { return 0, io.ErrUnexpectedEOF }
+	x := uint64(0)
+	for i := 0; i < n; {
+		// Read as many bits as are left in the current byte.
+		off := uint(r.pos & 7)
+		k := 8 - int(off)
+		if k > n - i { k = n - i }
+		b := uint64(r.data[r.pos >> 3] >> off) & (1<<uint(k) - 1)
+		x |= b << uint(i)
+		i += k
+		r.pos += k
+	}
+	return x, nil
+}
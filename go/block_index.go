@@ -2,6 +2,7 @@ package minnow
 
 import (
 	"fmt"
+	"io"
 )
 
 type blockIndex struct {
@@ -34,6 +35,88 @@ func (idx *blockIndex) blockOffset(b int) int64 {
 	return idx.offsets[b64 - idx.startBlock - 1]
 }
 
+// blockSize returns the size of block b in bytes.
+func (idx *blockIndex) blockSize(b int) int64 {
+	return idx.offsets[int64(b) - idx.startBlock] - idx.blockOffset(b)
+}
+
+// setStartBlock changes the file block index of the group's first block.
+func (idx *blockIndex) setStartBlock(b int) {
+	idx.startBlock = int64(b)
+}
+
+// firstBlock returns the file block index of the group's first block.
+func (idx *blockIndex) firstBlock() int64 {
+	return idx.startBlock
+}
+
 func (idx *blockIndex) blocks() int64 {
 	return int64(len(idx.offsets))
 }
+
+// appendIndex adds the last block of enc to idx. enc belongs to an encoder
+// of idx's group (see concurrentGroup).
+func (idx *blockIndex) appendIndex(enc *blockIndex) {
+	idx.addBlock(enc.blockSize(int(enc.startBlock + enc.blocks() - 1)))
+}
+
+// VariableLength can be passed as N to any of Writer's built-in group
+// methods to allow each of the group's blocks to have a different length.
+const VariableLength = -1
+
+// blockLengths records the number of elements in each block of a group. If N
+// is VariableLength, the lengths of each block are stored in the tail after
+// N, the group's starting block, and its block count.
+type blockLengths struct {
+	N int64
+	lengths []int64 // Only used if N == VariableLength.
+}
+
+// blockLen returns the length of the ith block of the group. Note that i is
+// not a block index within the file.
+func (bl *blockLengths) blockLen(i int) int {
+	if bl.N == VariableLength { return int(bl.lengths[i]) }
+	return int(bl.N)
+}
+
+// addLen records a new block of length n, returning an error if the group's
+// blocks must have a different length.
+func (bl *blockLengths) addLen(n int) error {
+	if bl.N == VariableLength {
+		bl.lengths = append(bl.lengths, int64(n))
+	} else if n != int(bl.N) {
+		return fmt.Errorf("%w: group has blocks of length %d, but got a " +
+			"block of length %d", ErrTypeMismatch, bl.N, n)
+	}
+	return nil
+}
+
+func (bl *blockLengths) writeLengths(f io.Writer) error {
+	if bl.N != VariableLength { return nil }
+	return binaryWrite(f, bl.lengths)
+}
+
+func (bl *blockLengths) readLengths(f io.Reader, blocks int64) error {
+	if bl.N == VariableLength {
+		if err := checkCount(f, blocks, 8); err != nil { return err }
+		bl.lengths = make([]int64, blocks)
+		if err := binaryRead(f, bl.lengths); err != nil { return err }
+		for i, n := range bl.lengths {
+			if n < 0 {
+				return fmt.Errorf("%w: block %d of group has length %d",
+					ErrTruncated, i, n)
+			}
+		}
+		return nil
+	} else if bl.N < 0 {
+		return fmt.Errorf("minnow: group has invalid block length %d", bl.N)
+	}
+	return nil
+}
+
+// appendLengths adds the length of the last block of enc to bl. enc belongs to
+// an encoder of bl's group (see concurrentGroup).
+func (bl *blockLengths) appendLengths(enc *blockLengths) {
+	if bl.N != VariableLength { return }
+	bl.lengths = append(bl.lengths, enc.lengths[len(enc.lengths) - 1])
+}
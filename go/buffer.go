@@ -1,5 +1,11 @@
 package minnow
 
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
 func sizeInt64Buf(buf []int64, n int) []int64 {
 	if n <= cap(buf) { return buf[:n] }
 	buf = buf[:cap(buf)]
@@ -7,3 +13,125 @@ func sizeInt64Buf(buf []int64, n int) []int64 {
 
 	return buf
 }
+
+func sizeUint64Buf(buf []uint64, n int) []uint64 {
+	if n <= cap(buf) { return buf[:n] }
+	buf = buf[:cap(buf)]
+	buf = append(buf, make([]uint64, n - cap(buf))...)
+
+	return buf
+}
+
+func sizeByteBuf(buf []byte, n int) []byte {
+	if n <= cap(buf) { return buf[:n] }
+	buf = buf[:cap(buf)]
+	buf = append(buf, make([]byte, n - cap(buf))...)
+
+	return buf
+}
+
+// Scratch buffers used while decoding blocks. Readers share these pools so
+// that concurrent calls to Reader.Data never share a buffer.
+var (
+	bytePool = sync.Pool{ New: func() interface{} { return &[]byte{ } } }
+	int64Pool = sync.Pool{ New: func() interface{} { return &[]int64{ } } }
+	uint64Pool = sync.Pool{ New: func() interface{} { return &[]uint64{ } } }
+)
+
+func getBytes(n int) *[]byte {
+	buf := bytePool.Get().(*[]byte)
+	*buf = sizeByteBuf(*buf, n)
+	return buf
+}
+
+func putBytes(buf *[]byte) { bytePool.Put(buf) }
+
+func getInt64s(n int) *[]int64 {
+	buf := int64Pool.Get().(*[]int64)
+	*buf = sizeInt64Buf(*buf, n)
+	return buf
+}
+
+func putInt64s(buf *[]int64) { int64Pool.Put(buf) }
+
+func getUint64s(n int) *[]uint64 {
+	buf := uint64Pool.Get().(*[]uint64)
+	*buf = sizeUint64Buf(*buf, n)
+	return buf
+}
+
+func putUint64s(buf *[]uint64) { uint64Pool.Put(buf) }
+
+// Buffer is an in-memory file which can be written to by a Writer and read
+// from by a Reader. The zero value is an empty Buffer ready to use.
+type Buffer struct {
+	data []byte
+	pos int64
+}
+
+var (
+	_ io.WriteSeeker = &Buffer{ }
+	_ io.ReaderAt = &Buffer{ }
+)
+
+// NewBuffer returns a Buffer which initially contains data. The Buffer takes
+// ownership of data.
+func NewBuffer(data []byte) *Buffer {
+	return &Buffer{ data: data }
+}
+
+// Bytes returns the contents of the Buffer. The returned slice aliases the
+// Buffer until the next Write.
+func (buf *Buffer) Bytes() []byte {
+	return buf.data
+}
+
+// Len returns the size of the Buffer in bytes.
+func (buf *Buffer) Len() int {
+	return len(buf.data)
+}
+
+// Write writes p at the current position, growing the Buffer if needed.
+func (buf *Buffer) Write(p []byte) (int, error) {
+	end := buf.pos + int64(len(p))
+	if end > int64(len(buf.data)) {
+		if end > int64(cap(buf.data)) {
+			data := make([]byte, end, 2*end)
+			copy(data, buf.data)
+			buf.data = data
+		} else {
+			buf.data = buf.data[:end]
+		}
+	}
+	copy(buf.data[buf.pos:], p)
+	buf.pos = end
+	return len(p), nil
+}
+
+// Seek sets the position of the next Write.
+func (buf *Buffer) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart: pos = offset
+	case io.SeekCurrent: pos = buf.pos + offset
+	case io.SeekEnd: pos = int64(len(buf.data)) + offset
+	default: return 0, fmt.Errorf("minnow: invalid whence, %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("minnow: negative Buffer position, %d", pos)
+	}
+	buf.pos = pos
+	return pos, nil
+}
+
+// ReadAt reads len(p) bytes starting at offset off.
+func (buf *Buffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("minnow: negative Buffer offset, %d", off)
+	} else if off >= int64(len(buf.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, buf.data[off:])
+	if n < len(p) { return n, io.EOF }
+	return n, nil
+}
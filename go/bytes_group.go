@@ -0,0 +1,191 @@
+package minnow
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/phil-mansfield/minnow/go/bit"
+	"github.com/phil-mansfield/minnow/go/lz"
+)
+
+////////////////
+// bytesGroup //
+////////////////
+
+// bytesGroup stores blocks of byte strings, given as either [][]byte or
+// []string. Each block starts with the bit-packed length of every element,
+// followed by the LZ compressed concatenation of the elements.
+type bytesGroup struct {
+	blockIndex
+	blockLengths
+	ab *bit.ArrayBuffer
+	bits []int64
+
+	buf, comp []byte // Only used by writeData.
+}
+
+func newBytesGroup(startBlock, N int) *bytesGroup {
+	return &bytesGroup{
+		blockIndex: *newBlockIndex(startBlock),
+		blockLengths: blockLengths{ N: int64(N) },
+		ab: &bit.ArrayBuffer{ },
+	}
+}
+
+func newBytesGroupFromTail(f io.Reader) (*bytesGroup, error) {
+	g := &bytesGroup{ ab: &bit.ArrayBuffer{ } }
+	var startBlock, blocks int64
+	for _, x := range []*int64{ &g.N, &startBlock, &blocks } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+	if err := checkBlocks(f, blocks); err != nil { return nil, err }
+	if err := g.readLengths(f, blocks); err != nil { return nil, err }
+
+	if err := checkCount(f, blocks, 16); err != nil { return nil, err }
+	g.bits = make([]int64, blocks)
+	sizes := make([]int64, blocks)
+	for _, x := range []interface{}{ g.bits, sizes } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+
+	g.blockIndex = *newBlockIndex(int(startBlock))
+	for i := range sizes {
+		if g.bits[i] < 0 || g.bits[i] > 64 {
+			return nil, fmt.Errorf("%w: block %d of BytesGroup has %d " +
+				"bits per length", ErrTruncated, i, g.bits[i])
+		} else if sizes[i] < g.packedBytes(i) {
+			return nil, fmt.Errorf("%w: block %d of BytesGroup is too " +
+				"small to hold its lengths", ErrTruncated, i)
+		}
+		g.addBlock(sizes[i])
+	}
+	return g, nil
+}
+
+// packedBytes returns the number of bytes used by the element lengths at the
+// start of the ith block of the group.
+func (g *bytesGroup) packedBytes(i int) int64 {
+	return int64(bit.ArrayBytes(int(g.bits[i]), g.blockLen(i)))
+}
+
+// minBits only counts the element lengths, since the elements themselves may
+// be empty.
+func (g *bytesGroup) minBits(b int) (bits, n int64) {
+	bIdx := b - int(g.startBlock)
+	return g.bits[bIdx], int64(g.blockLen(bIdx))
+}
+
+func (g *bytesGroup) writeTail(f io.Writer) error {
+	for _, x := range []int64{ g.N, g.startBlock, g.blocks() } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	if err := g.writeLengths(f); err != nil { return err }
+
+	sizes := make([]int64, g.blocks())
+	for i := range sizes { sizes[i] = g.blockSize(i + int(g.startBlock)) }
+	for _, x := range []interface{}{ g.bits, sizes } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	return nil
+}
+
+func (g *bytesGroup) groupType() int64 {
+	return BytesGroup
+}
+
+func (g *bytesGroup) length(b int) int {
+	return g.blockLen(b - int(g.startBlock))
+}
+
+func (g *bytesGroup) encoder() group {
+	return newBytesGroup(0, int(g.N))
+}
+
+func (g *bytesGroup) appendBlock(enc group) {
+	e := enc.(*bytesGroup)
+	g.appendIndex(&e.blockIndex)
+	g.appendLengths(&e.blockLengths)
+	g.bits = append(g.bits, e.bits[len(e.bits) - 1])
+}
+
+func (g *bytesGroup) writeData(f io.Writer, x interface{}) error {
+	n := sliceLen(x)
+	if err := g.addLen(n); err != nil { return err }
+
+	lengths := g.ab.Uint64(n)
+	g.buf = g.buf[:0]
+	switch data := x.(type) {
+	case [][]byte:
+		for i := range data {
+			lengths[i] = uint64(len(data[i]))
+			g.buf = append(g.buf, data[i]...)
+		}
+	case []string:
+		for i := range data {
+			lengths[i] = uint64(len(data[i]))
+			g.buf = append(g.buf, data[i]...)
+		}
+	}
+
+	bits := g.ab.Bits(lengths)
+	if err := g.ab.Write(f, lengths, bits); err != nil { return err }
+	g.comp = lz.Compress(g.comp[:0], g.buf)
+	if _, err := f.Write(g.comp); err != nil { return err }
+
+	g.bits = append(g.bits, int64(bits))
+	g.addBlock(int64(bit.ArrayBytes(bits, n) + len(g.comp)))
+	return nil
+}
+
+// readData decodes block b. [][]byte outputs are set to slices of a newly
+// allocated buffer, so they remain valid after later calls.
+func (g *bytesGroup) readData(data []byte, b int, x interface{}) error {
+	bIdx := b - int(g.startBlock)
+	n, nBits := g.blockLen(bIdx), int(g.bits[bIdx])
+
+	lengths := getUint64s(n)
+	defer putUint64s(lengths)
+	if nBits == 0 {
+		for i := range *lengths { (*lengths)[i] = 0 }
+	} else {
+		arr := bit.Array{ Length: n, Bits: byte(nBits), Data: data }
+		arr.Slice(*lengths)
+	}
+
+	// The lengths are checked against the LZ stream before anything is
+	// allocated, so corrupt lengths can't cause huge allocations.
+	comp := data[g.packedBytes(bIdx):]
+	size, err := lz.DecompressedLen(comp)
+	if err != nil { return fmt.Errorf("minnow: block %d: %w", b, err) }
+	total := uint64(0)
+	for _, l := range *lengths {
+		if l > size - total {
+			return fmt.Errorf("minnow: block %d: element lengths add up to " +
+				"more than the %d compressed bytes: %w", b, size, lz.ErrCorrupt)
+		}
+		total += l
+	}
+	if total != size {
+		return fmt.Errorf("minnow: block %d: element lengths add up to %d " +
+			"bytes, not %d: %w", b, total, size, lz.ErrCorrupt)
+	}
+
+	payload := make([]byte, total)
+	err = lz.Decompress(payload, comp)
+	if err != nil {
+		return fmt.Errorf("minnow: block %d: %w", b, err)
+	}
+
+	start := uint64(0)
+	for i, l := range *lengths {
+		end := start + l
+		switch out := x.(type) {
+		case [][]byte:
+			out[i] = payload[start:end:end]
+		case []string:
+			out[i] = string(payload[start:end])
+		}
+		start = end
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package minnow
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Every header and block in a minnow file has a CRC-32C checksum stored in the
+// tail. The tail itself is protected by a checksum which also covers the
+// minnowHeader at the start of the file.
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ChecksumError is returned by Reader.Verify and wraps ErrChecksum. It lists
+// every header and block whose contents do not match their checksums.
+type ChecksumError struct {
+	Headers, Blocks []int
+}
+
+func (err *ChecksumError) Error() string {
+	return fmt.Sprintf("%s: corrupt headers %v and blocks %v",
+		ErrChecksum.Error(), err.Headers, err.Blocks)
+}
+
+func (err *ChecksumError) Unwrap() error { return ErrChecksum }
+
+// crcWriter is an io.Writer which computes the checksum of everything written
+// through it.
+type crcWriter struct {
+	w io.Writer
+	crc uint32
+}
+
+func (cw *crcWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.crc = crc32.Update(cw.crc, crcTable, p[:n])
+	return n, err
+}
+
+// crcReader is an io.Reader which computes the checksum of everything read
+// through it.
+type crcReader struct {
+	r io.Reader
+	crc uint32
+}
+
+func (cr *crcReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.crc = crc32.Update(cr.crc, crcTable, p[:n])
+	return n, err
+}
+
+// VerifyOnRead sets whether Data and Header check the checksums of the blocks
+// and headers they read, returning an error wrapping ErrChecksum if they don't
+// match. It is off by default and should not be called concurrently with
+// other methods. Version 1 files have no checksums and are never checked.
+func (rd *Reader) VerifyOnRead(verify bool) {
+	rd.verifyOnRead = verify
+}
+
+// Verify checks the checksum of every header and block in the file. If any
+// are corrupt, a *ChecksumError listing all of them is returned. Version 1
+// files have no checksums and return an error wrapping ErrVersion.
+func (rd *Reader) Verify() error {
+	if rd.version < 2 {
+		return fmt.Errorf("%w: version %d files do not have checksums",
+			ErrVersion, rd.version)
+	}
+
+	err := &ChecksumError{ }
+
+	for i := 0; i < rd.headers; i++ {
+		buf := make([]byte, rd.headerSizes[i])
+		if ioErr := rd.readAt(buf, rd.headerOffsets[i]); ioErr != nil {
+			return ioErr
+		}
+		if crc32.Checksum(buf, crcTable) != rd.headerCRCs[i] {
+			err.Headers = append(err.Headers, i)
+		}
+	}
+
+	for b := 0; b < rd.blocks; b++ {
+		buf, ioErr := rd.readBlock(b)
+		if ioErr != nil { return ioErr }
+		if crc32.Checksum(*buf, crcTable) != rd.blockCRCs[b] {
+			err.Blocks = append(err.Blocks, b)
+		}
+		putBytes(buf)
+	}
+
+	if len(err.Headers) > 0 || len(err.Blocks) > 0 { return err }
+	return nil
+}
+
+// checkCRC returns an error wrapping ErrChecksum if data doesn't match crc.
+func checkCRC(data []byte, crc uint32, kind string, i int) error {
+	if crc32.Checksum(data, crcTable) == crc { return nil }
+	return fmt.Errorf("%w: %s %d", ErrChecksum, kind, i)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	minnow "github.com/phil-mansfield/minnow/go"
+	"github.com/phil-mansfield/minnow/go/minh"
+	"github.com/phil-mansfield/minnow/go/minp"
+)
+
+// report describes the contents of a single file.
+type report struct {
+	File string `json:"file"`
+	Bytes int64 `json:"bytes"`
+	Version int `json:"version"`
+	Blocks int `json:"blocks"`
+	Headers []headerReport `json:"headers"`
+	Groups []groupReport `json:"groups"`
+	Minh *minhReport `json:"minh,omitempty"`
+	Minp *minpReport `json:"minp,omitempty"`
+}
+
+type headerReport struct {
+	Name string `json:"name"`
+	Schema string `json:"schema"`
+	Bytes int `json:"bytes"`
+}
+
+type groupReport struct {
+	Type string `json:"type"`
+	TypeID int64 `json:"type_id"`
+	StartBlock int `json:"start_block"`
+	Blocks int `json:"blocks"`
+	N int `json:"n"`
+	Elements int64 `json:"elements"`
+	Bytes int64 `json:"bytes"`
+	// RawBytes is the size of the group's elements as Go slices. Ratio is
+	// RawBytes/Bytes. They're zero if the raw size is unknown.
+	RawBytes int64 `json:"raw_bytes,omitempty"`
+	Ratio float64 `json:"ratio,omitempty"`
+	MinBits int64 `json:"min_bits,omitempty"`
+	MaxBits int64 `json:"max_bits,omitempty"`
+	Quantization []quantizationReport `json:"quantization,omitempty"`
+}
+
+// quantizationReport describes a minnow.Quantization.
+type quantizationReport struct {
+	Low float64 `json:"low"`
+	High float64 `json:"high"`
+	Pixels int64 `json:"pixels"`
+	Periodic bool `json:"periodic"`
+	Log bool `json:"log"`
+	Dequantization string `json:"dequantization,omitempty"`
+}
+
+type minhReport struct {
+	Text string `json:"text"`
+	Rows int `json:"rows"`
+	Blocks int `json:"blocks"`
+	L float32 `json:"l"`
+	Boundary float32 `json:"boundary"`
+	Cells int `json:"cells"`
+	Columns []columnReport `json:"columns"`
+}
+
+type columnReport struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Log bool `json:"log"`
+	Low float32 `json:"low"`
+	High float32 `json:"high"`
+	Dx float32 `json:"dx"`
+	Bits int32 `json:"bits,omitempty"`
+}
+
+type minpReport struct {
+	Header minp.Header `json:"header"`
+	Cell minp.Cell `json:"cell"`
+	Dx float64 `json:"dx"`
+	Periodic bool `json:"periodic"`
+	Particles int `json:"particles"`
+}
+
+// rawElementBytes is the size of a single element of each built-in group
+// type as a Go value, or 0 if it isn't fixed.
+var rawElementBytes = map[int64]int64{
+	minnow.Int64Group: 8, minnow.Int32Group: 4,
+	minnow.Int16Group: 2, minnow.Int8Group: 1,
+	minnow.Uint64Group: 8, minnow.Uint32Group: 4,
+	minnow.Uint16Group: 2, minnow.Uint8Group: 1,
+	minnow.Float64Group: 8, minnow.Float32Group: 4,
+	minnow.IntGroup: 8, minnow.FloatGroup: 4,
+	minnow.EntropyIntGroup: 8, minnow.EntropyFloatGroup: 4,
+	minnow.DeltaIntGroup: 8,
+	minnow.LosslessFloat64Group: 8, minnow.LosslessFloat32Group: 4,
+	minnow.BoolGroup: 1, minnow.BitmaskGroup: 8,
+	minnow.Vec32Group: 12, minnow.Vec64Group: 24,
+}
+
+func inspect(args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	jsonOut := flags.Bool("json", false, "print JSON instead of text")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: minnow inspect [-json] file...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("no files given")
+	}
+
+	reports := []*report{ }
+	for _, fname := range flags.Args() {
+		r, err := inspectFile(fname)
+		if err != nil { return err }
+		reports = append(reports, r)
+	}
+
+	if *jsonOut {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+	for i, r := range reports {
+		if i > 0 { fmt.Println() }
+		if err := writeText(os.Stdout, r); err != nil { return err }
+	}
+	return nil
+}
+
+// inspectFile reads the structure of the file fname.
+func inspectFile(fname string) (*report, error) {
+	info, err := os.Stat(fname)
+	if err != nil { return nil, err }
+	rd, err := minnow.Open(fname)
+	if err != nil { return nil, err }
+	defer rd.Close()
+
+	r := &report{
+		File: fname, Bytes: info.Size(),
+		Version: rd.Version(), Blocks: rd.Blocks(),
+	}
+	for i := 0; i < rd.HeaderCount(); i++ {
+		h := headerReport{ }
+		if h.Name, err = rd.HeaderName(i); err != nil { return nil, err }
+		if h.Schema, err = rd.HeaderSchema(i); err != nil { return nil, err }
+		if h.Bytes, err = rd.HeaderSize(i); err != nil { return nil, err }
+		r.Headers = append(r.Headers, h)
+	}
+	for _, g := range rd.Groups() { r.Groups = append(r.Groups, group(g)) }
+
+	// minh and minp files are recognized by their headers, so errors here
+	// just mean that the file is some other kind of minnow file.
+	if mh, err := minh.Open(fname); err == nil {
+		r.Minh = minhInfo(mh)
+		mh.Close()
+	}
+	if mp, err := minp.Open(fname); err == nil {
+		r.Minp = &minpReport{
+			mp.Header, mp.Cell(), mp.Dx, mp.Periodic, mp.N(),
+		}
+		mp.Close()
+	}
+	return r, nil
+}
+
+// group summarizes a group.
+func group(g minnow.GroupInfo) groupReport {
+	gr := groupReport{
+		TypeID: g.Type, StartBlock: g.StartBlock, Blocks: g.Blocks, N: g.N,
+	}
+	for _, q := range g.Quantization {
+		qr := quantizationReport{
+			Low: q.Low, High: q.High, Pixels: q.Pixels,
+			Periodic: q.Periodic, Log: q.Log,
+		}
+		if int(q.Dequantization) < len(dequantizationNames) {
+			qr.Dequantization = dequantizationNames[q.Dequantization]
+		}
+		gr.Quantization = append(gr.Quantization, qr)
+	}
+	gr.Type = fmt.Sprintf("Group(%d)", g.Type)
+	if g.Type >= 0 && g.Type < int64(len(minnow.GroupNames)) {
+		gr.Type = minnow.GroupNames[g.Type]
+	}
+
+	for i := range g.Sizes {
+		gr.Bytes += g.Sizes[i]
+		gr.Elements += int64(g.Lengths[i])
+	}
+	if size := rawElementBytes[g.Type]; size > 0 && gr.Bytes > 0 {
+		gr.RawBytes = size*gr.Elements
+		gr.Ratio = float64(gr.RawBytes) / float64(gr.Bytes)
+	}
+
+	for i, bits := range g.Bits {
+		if i == 0 || bits < gr.MinBits { gr.MinBits = bits }
+		if i == 0 || bits > gr.MaxBits { gr.MaxBits = bits }
+	}
+	return gr
+}
+
+// minhInfo summarizes the headers of a minh file.
+func minhInfo(mh *minh.Reader) *minhReport {
+	r := &minhReport{
+		Text: mh.Text, Rows: mh.Length, Blocks: mh.Blocks,
+		L: mh.L, Boundary: mh.Boundary, Cells: mh.Cells,
+	}
+	for i, c := range mh.Columns {
+		cr := columnReport{
+			Name: mh.Names[i], Type: fmt.Sprintf("%d", c.Type),
+			Log: c.Log != 0, Low: c.Low, High: c.High, Dx: c.Dx, Bits: c.Bits,
+		}
+		if c.Type >= 0 && c.Type < int64(len(minnow.GroupNames)) {
+			cr.Type = minnow.GroupNames[c.Type]
+		}
+		r.Columns = append(r.Columns, cr)
+	}
+	return r
+}
+
+// writeText writes a human-readable version of r to w.
+func writeText(w io.Writer, r *report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	p := func(format string, args ...interface{}) {
+		fmt.Fprintf(tw, format, args...)
+	}
+
+	p("%s: minnow version %d, %d bytes, %d headers, %d groups, %d blocks\n",
+		r.File, r.Version, r.Bytes, len(r.Headers), len(r.Groups), r.Blocks)
+
+	p("\nHeaders:\n")
+	p("  #\tname\tbytes\tschema\n")
+	for i, h := range r.Headers {
+		p("  %d\t%s\t%d\t%s\n", i, orDash(h.Name), h.Bytes, orDash(h.Schema))
+	}
+
+	p("\nGroups:\n")
+	p("  #\ttype\tblocks\tN\telements\tbytes\tratio\tbits\tparameters\n")
+	for i, g := range r.Groups {
+		n, ratio, bits := "var", "-", "-"
+		if g.N != minnow.VariableLength { n = fmt.Sprint(g.N) }
+		if g.Ratio > 0 { ratio = fmt.Sprintf("%.2f", g.Ratio) }
+		if len(g.Quantization) > 0 || g.MaxBits > 0 {
+			bits = fmt.Sprintf("%d-%d", g.MinBits, g.MaxBits)
+		}
+		p("  %d\t%s\t[%d, %d)\t%s\t%d\t%d\t%s\t%s\t%s\n", i, g.Type,
+			g.StartBlock, g.StartBlock + g.Blocks, n, g.Elements, g.Bytes,
+			ratio, bits, quantizationText(g.Quantization))
+	}
+
+	if mh := r.Minh; mh != nil {
+		p("\nminh: %d rows in %d blocks, L = %g, boundary = %g, " +
+			"cells = %d\n", mh.Rows, mh.Blocks, mh.L, mh.Boundary, mh.Cells)
+		if mh.Text != "" { p("  text: %q\n", mh.Text) }
+		p("  column\ttype\tlog\tlow\thigh\tdx\tbits\n")
+		for _, c := range mh.Columns {
+			p("  %s\t%s\t%t\t%g\t%g\t%g\t%d\n", c.Name, c.Type, c.Log,
+				c.Low, c.High, c.Dx, c.Bits)
+		}
+	}
+
+	if mp := r.Minp; mp != nil {
+		hd, c := mp.Header, mp.Cell
+		p("\nminp: %d particles, dx = %g, periodic = %t\n",
+			mp.Particles, mp.Dx, mp.Periodic)
+		p("  z = %g, a = %g, OmegaM = %g, OmegaL = %g, h100 = %g\n",
+			hd.Z, hd.Scale, hd.OmegaM, hd.OmegaL, hd.H100)
+		p("  L = %g, epsilon = %g, NSide = %d, NTotal = %d, mp = %g\n",
+			hd.L, hd.Epsilon, hd.NSide, hd.NTotal, hd.UniformMp)
+		p("  cell: file index = %d, file cells = %d, sub-cells = %d\n",
+			c.FileIndex, c.FileCells, c.SubCells)
+	}
+
+	return tw.Flush()
+}
+
+// dequantizationNames are the names of each minnow.Dequantization.
+var dequantizationNames = []string{ "dither", "midpoint", "lower-edge" }
+
+// quantizationText formats the quantization parameters of a group.
+func quantizationText(qs []quantizationReport) string {
+	out := []string{ }
+	for _, q := range qs {
+		s := fmt.Sprintf("[%g, %g) pixels=%d", q.Low, q.High, q.Pixels)
+		if q.Periodic { s += " periodic" }
+		if q.Log { s += " log" }
+		if q.Dequantization != "" { s += " " + q.Dequantization }
+		out = append(out, s)
+	}
+	if len(out) == 0 { return "-" }
+	return strings.Join(out, "; ")
+}
+
+func orDash(s string) string {
+	if s == "" { return "-" }
+	return s
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	r, err := inspectFile("../../minh/testdata/v1.minh")
+	if err != nil { t.Fatal(err) }
+	if r.Minh == nil || r.Minp != nil {
+		t.Fatalf("Expected a minh file but not a minp file.")
+	}
+	if len(r.Groups) != 6 || r.Blocks != 6 || len(r.Headers) != 7 {
+		t.Errorf("Expected 6 groups, 6 blocks and 7 headers, got %d, %d " +
+			"and %d.", len(r.Groups), r.Blocks, len(r.Headers))
+	}
+	names := []string{ }
+	for _, c := range r.Minh.Columns { names = append(names, c.Name) }
+	if strings.Join(names, " ") != "id x mass" || r.Minh.Rows != 5 {
+		t.Errorf("Expected columns [id x mass] with 5 rows, got %s with %d.",
+			names, r.Minh.Rows)
+	}
+	if g := r.Groups[1]; g.Type != "FloatGroup" || g.RawBytes != 12 ||
+		len(g.Quantization) != 1 || g.Quantization[0].Pixels != 1000 {
+		t.Errorf("Expected FloatGroup with 12 raw bytes and 1000 pixels, " +
+			"got %+v.", g)
+	}
+	js, err := json.Marshal(r.Groups[1].Quantization)
+	if err != nil { t.Fatal(err) }
+	exp := `[{"low":0,"high":10,"pixels":1000,"periodic":true,"log":false,` +
+		`"dequantization":"dither"}]`
+	if string(js) != exp {
+		t.Errorf("Expected quantization JSON %s, got %s.", exp, js)
+	}
+
+	r, err = inspectFile("../../minp/testdata/v1.minp")
+	if err != nil { t.Fatal(err) }
+	if r.Minp == nil || r.Minh != nil {
+		t.Fatalf("Expected a minp file but not a minh file.")
+	}
+	if r.Minp.Particles != 64 || r.Minp.Cell.SubCells != 2 {
+		t.Errorf("Expected 64 particles and 2 sub-cells, got %d and %d.",
+			r.Minp.Particles, r.Minp.Cell.SubCells)
+	}
+
+	buf := &bytes.Buffer{ }
+	if err := writeText(buf, r); err != nil { t.Fatal(err) }
+	if !strings.Contains(buf.String(), "minp: 64 particles") {
+		t.Errorf("Text output is missing the minp summary:\n%s", buf)
+	}
+	if _, err := json.Marshal(r); err != nil { t.Error(err) }
+
+	if _, err := inspectFile("../../minp/testdata/missing.minp"); err == nil {
+		t.Errorf("Expected error for missing file.")
+	}
+}
@@ -0,0 +1,61 @@
+/*Command minnow is a tool for working with minnow files, including minh and
+minp files.
+
+Usage:
+
+    minnow inspect [-json] file...
+    minnow recover file...
+
+inspect prints the structure of each file: its headers, its groups and how
+well they compress, and the contents of minh and minp headers.
+
+recover rebuilds files whose Writers were journaled but never closed, using
+the last checkpoint in each file's journal (see minnow.Writer.Journal).
+Everything written after that checkpoint is lost.
+*/
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// commands maps the name of each subcommand to the function which runs it.
+// Functions are passed the arguments which follow the subcommand name.
+var commands = map[string]func(args []string) error{
+	"inspect": inspect,
+	"recover": recoverFiles,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "minnow: unknown command '%s'\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "minnow %s: %v\n", name, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	names := []string{ }
+	for name := range commands { names = append(names, name) }
+	sort.Strings(names)
+
+	fmt.Fprintln(os.Stderr, "Usage: minnow <command> [arguments]")
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, name := range names { fmt.Fprintln(os.Stderr, "    " + name) }
+	fmt.Fprintln(os.Stderr,
+		"Run 'minnow <command> -h' for help with a command.")
+}
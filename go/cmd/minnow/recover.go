@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	minnow "github.com/phil-mansfield/minnow/go"
+)
+
+func recoverFiles(args []string) error {
+	flags := flag.NewFlagSet("recover", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: minnow recover file...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("no files given")
+	}
+
+	for _, fname := range flags.Args() {
+		if err := minnow.Recover(fname); err != nil { return err }
+
+		rd, err := minnow.Open(fname)
+		if err != nil { return err }
+		fmt.Printf("%s: recovered %d headers, %d groups and " +
+			"%d blocks\n", fname, rd.HeaderCount(), len(rd.Groups()),
+			rd.Blocks())
+		rd.Close()
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package minnow
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+
+	"github.com/phil-mansfield/minnow/go/thread"
+)
+
+// pendingBlock is a block which has been passed to Data but not written yet.
+// Workers fill in everything after x.
+type pendingBlock struct {
+	b int
+	g concurrentGroup
+	enc group
+	x interface{}
+
+	data []byte
+	crc uint32
+	stats BlockStats
+	err error
+}
+
+// SetConcurrency makes Data encode blocks on a pool of workers goroutines,
+// with at most inFlight blocks being encoded or waiting to be written at once.
+// Blocks are still written in the order that Data was called, so the file is
+// the same as one written without concurrency. inFlight is raised to workers
+// if it's smaller. If workers is 1 or less, which is the default, blocks are
+// encoded by Data itself.
+//
+// Data copies blocks before returning, so they can be reused by the caller.
+// If a block can't be encoded, the error is returned by a later call to Data,
+// Header, Close, SetConcurrency, or one of the group methods, and the Writer
+// can no longer be used. Blocks in user-defined groups are always encoded by
+// Data.
+func (wr *Writer) SetConcurrency(workers, inFlight int) error {
+	if err := wr.drain(); err != nil { return err }
+	if wr.queue != nil {
+		wr.queue.Close()
+		wr.queue = nil
+	}
+	if workers <= 1 { return nil }
+
+	if inFlight < workers { inFlight = workers }
+	wr.queue = thread.NewQueue(workers, encodeBlock)
+	wr.inFlight = inFlight
+	return nil
+}
+
+// dataConcurrent sends x, a block in g, to the worker pool and returns its
+// block index.
+func (wr *Writer) dataConcurrent(g concurrentGroup, x interface{}) (int, error) {
+	for wr.queue.Len() >= wr.inFlight {
+		if err := wr.commit(wr.queue.Pop().(*pendingBlock)); err != nil {
+			return -1, err
+		}
+	}
+	wr.queue.Push(&pendingBlock{
+		b: wr.blocks, g: g, enc: g.encoder(), x: copyBlock(x),
+	})
+
+	wr.groupBlocks[len(wr.groupBlocks) - 1]++
+	wr.blocks++
+	if err := wr.journalBlock(); err != nil { return -1, err }
+	return wr.blocks - 1, nil
+}
+
+// encodeBlock is run by the worker pool on each pendingBlock.
+func encodeBlock(worker int, job interface{}) interface{} {
+	pb := job.(*pendingBlock)
+	buf := &bytes.Buffer{ }
+	if pb.err = pb.enc.writeData(buf, pb.x); pb.err != nil { return pb }
+
+	pb.data = buf.Bytes()
+	pb.crc = crc32.Checksum(pb.data, crcTable)
+	if sg, ok := pb.enc.(statsGroup); ok {
+		pb.stats = sg.lastStats()
+	} else {
+		pb.stats = sliceStats(pb.x)
+	}
+	pb.x = nil
+	return pb
+}
+
+// commit writes an encoded block to the file.
+func (wr *Writer) commit(pb *pendingBlock) error {
+	if wr.err != nil { return wr.err }
+	if pb.err != nil {
+		wr.err = fmt.Errorf("minnow: block %d: %w", pb.b, pb.err)
+		return wr.err
+	}
+
+	if _, err := wr.f.Write(pb.data); err != nil {
+		wr.err = err
+		return err
+	}
+	pb.g.appendBlock(pb.enc)
+	wr.blockCRCs = append(wr.blockCRCs, pb.crc)
+	wr.blockStats = append(wr.blockStats, pb.stats)
+	return nil
+}
+
+// drain writes every block sent to the worker pool, returning the first error
+// encountered.
+func (wr *Writer) drain() error {
+	if wr.queue == nil { return wr.err }
+	for wr.queue.Len() > 0 {
+		// Keep popping after errors so that the workers can be closed.
+		wr.commit(wr.queue.Pop().(*pendingBlock))
+	}
+	return wr.err
+}
+
+// copyBlock returns a copy of x, a block in a built-in group.
+func copyBlock(x interface{}) interface{} {
+	if data, ok := x.([][]byte); ok {
+		out := make([][]byte, len(data))
+		for i := range data { out[i] = append([]byte(nil), data[i]...) }
+		return out
+	}
+	v := reflect.ValueOf(x)
+	out := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+	reflect.Copy(out, v)
+	return out.Interface()
+}
@@ -0,0 +1,191 @@
+package minnow
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+
+	"github.com/phil-mansfield/minnow/go/bit"
+)
+
+////////////////////
+// DeltaIntGroup //
+////////////////////
+
+const (
+	// deltaMode blocks store the first element followed by the zigzag
+	// encoded differences between neighboring elements.
+	deltaMode uint8 = iota
+	// offsetMode blocks store elements relative to the block minimum, the
+	// same way intGroup does. It's used when differences wouldn't be smaller.
+	offsetMode
+)
+
+// deltaIntGroup is a group intended for sorted or nearly sorted int64s, like
+// IDs. Each block is bit-packed either as first differences or, if the block
+// isn't close enough to monotone for that to help, relative to its minimum.
+type deltaIntGroup struct {
+	blockIndex
+	blockLengths
+	ab *bit.ArrayBuffer
+	starts, bits []int64
+	modes []uint8
+}
+
+func newDeltaIntGroup(startBlock, N int) *deltaIntGroup {
+	return &deltaIntGroup{
+		blockIndex: *newBlockIndex(startBlock),
+		blockLengths: blockLengths{ N: int64(N) },
+		ab: &bit.ArrayBuffer{ },
+	}
+}
+
+func newDeltaIntGroupFromTail(f io.Reader) (*deltaIntGroup, error) {
+	g := &deltaIntGroup{ ab: &bit.ArrayBuffer{ } }
+	var startBlock, blocks int64
+	for _, x := range []*int64{ &g.N, &startBlock, &blocks } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+	if err := checkBlocks(f, blocks); err != nil { return nil, err }
+	if err := g.readLengths(f, blocks); err != nil { return nil, err }
+
+	if err := checkCount(f, blocks, 17); err != nil { return nil, err }
+	g.starts, g.bits = make([]int64, blocks), make([]int64, blocks)
+	g.modes = make([]uint8, blocks)
+	for _, x := range []interface{}{ g.starts, g.bits, g.modes } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+
+	g.blockIndex = *newBlockIndex(int(startBlock))
+	for i := range g.bits {
+		if g.bits[i] < 0 || g.bits[i] > 64 {
+			return nil, fmt.Errorf("%w: block %d of DeltaIntGroup has %d " +
+				"bits per element", ErrTruncated, i, g.bits[i])
+		} else if g.modes[i] != deltaMode && g.modes[i] != offsetMode {
+			return nil, fmt.Errorf("%w: block %d of DeltaIntGroup has " +
+				"unknown mode %d", ErrUnknownGroup, i, g.modes[i])
+		}
+		g.addBlock(int64(bit.ArrayBytes(int(g.bits[i]), g.packedLen(i))))
+	}
+	return g, nil
+}
+
+// packedLen returns the number of packed elements in the ith block of the
+// group.
+func (g *deltaIntGroup) packedLen(i int) int {
+	n := g.blockLen(i)
+	if g.modes[i] == deltaMode && n > 0 { return n - 1 }
+	return n
+}
+
+func (g *deltaIntGroup) minBits(b int) (bits, n int64) {
+	bIdx := b - int(g.startBlock)
+	return g.bits[bIdx], int64(g.packedLen(bIdx))
+}
+
+func (g *deltaIntGroup) writeTail(f io.Writer) error {
+	for _, x := range []int64{ g.N, g.startBlock, g.blocks() } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	if err := g.writeLengths(f); err != nil { return err }
+	for _, x := range []interface{}{ g.starts, g.bits, g.modes } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	return nil
+}
+
+func (g *deltaIntGroup) groupType() int64 {
+	return DeltaIntGroup
+}
+
+func (g *deltaIntGroup) length(b int) int {
+	return g.blockLen(b - int(g.startBlock))
+}
+
+func (g *deltaIntGroup) encoder() group {
+	return newDeltaIntGroup(0, int(g.N))
+}
+
+func (g *deltaIntGroup) appendBlock(enc group) {
+	e := enc.(*deltaIntGroup)
+	g.appendIndex(&e.blockIndex)
+	g.appendLengths(&e.blockLengths)
+	g.starts = append(g.starts, e.starts[len(e.starts) - 1])
+	g.bits = append(g.bits, e.bits[len(e.bits) - 1])
+	g.modes = append(g.modes, e.modes[len(e.modes) - 1])
+}
+
+func (g *deltaIntGroup) writeData(f io.Writer, x interface{}) error {
+	data := x.([]int64)
+	if err := g.addLen(len(data)); err != nil { return err }
+
+	// Differences are computed with wrapping arithmetic, so they round-trip
+	// even when they overflow.
+	var start int64
+	var maxDelta, maxOffset uint64
+	min := int64Min(data)
+	for i := range data {
+		if i > 0 {
+			z := zigzag(data[i] - data[i-1])
+			if z > maxDelta { maxDelta = z }
+		}
+		if off := uint64(data[i] - min); off > maxOffset { maxOffset = off }
+	}
+	mode, nBits := deltaMode, bits.Len64(maxDelta)
+	if offsetBits := bits.Len64(maxOffset); offsetBits <= nBits {
+		mode, nBits = offsetMode, offsetBits
+	}
+
+	var buf []uint64
+	if mode == deltaMode {
+		start = data[0]
+		buf = g.ab.Uint64(len(data) - 1)
+		for i := range buf { buf[i] = zigzag(data[i+1] - data[i]) }
+	} else {
+		start = min
+		buf = g.ab.Uint64(len(data))
+		for i := range buf { buf[i] = uint64(data[i] - min) }
+	}
+	if err := g.ab.Write(f, buf, nBits); err != nil { return err }
+
+	g.starts = append(g.starts, start)
+	g.bits = append(g.bits, int64(nBits))
+	g.modes = append(g.modes, mode)
+	g.addBlock(int64(bit.ArrayBytes(nBits, len(buf))))
+	return nil
+}
+
+func (g *deltaIntGroup) readData(data []byte, b int, x interface{}) error {
+	out := x.([]int64)
+	bIdx := b - int(g.startBlock)
+	start, nBits, n := g.starts[bIdx], int(g.bits[bIdx]), g.packedLen(bIdx)
+
+	buf := getUint64s(n)
+	defer putUint64s(buf)
+	if nBits == 0 {
+		for i := range *buf { (*buf)[i] = 0 }
+	} else {
+		arr := bit.Array{ Length: n, Bits: byte(nBits), Data: data }
+		arr.Slice(*buf)
+	}
+
+	if g.modes[bIdx] == offsetMode {
+		for i, x := range *buf { out[i] = start + int64(x) }
+		return nil
+	}
+	if g.blockLen(bIdx) == 0 { return nil }
+	out[0] = start
+	for i, z := range *buf { out[i+1] = out[i] + unzigzag(z) }
+	return nil
+}
+
+// zigzag maps signed integers to unsigned integers so that values close to
+// zero stay small: 0, -1, 1, -2, ... become 0, 1, 2, 3, ...
+func zigzag(x int64) uint64 {
+	return uint64(x << 1) ^ uint64(x >> 63)
+}
+
+// unzigzag inverts zigzag.
+func unzigzag(z uint64) int64 {
+	return int64(z >> 1) ^ -int64(z & 1)
+}
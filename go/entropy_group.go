@@ -0,0 +1,186 @@
+package minnow
+
+import (
+	"io"
+	"math/bits"
+
+	"github.com/phil-mansfield/minnow/go/bit"
+	"github.com/phil-mansfield/minnow/go/huffman"
+)
+
+//////////////////////
+// EntropyIntGroup //
+//////////////////////
+
+// entropyIntGroup stores int64s by subtracting the block minimum and Huffman
+// coding the results. Each block has its own code, which is stored in the tail
+// as a table of code lengths.
+//
+// Small values get their own symbols. Larger values are coded by their bit
+// length followed by the remaining bits verbatim, so heavily skewed
+// distributions compress well without an unbounded alphabet.
+type entropyIntGroup struct {
+	blockIndex
+	blockLengths
+	mins []int64
+	lengths [][]uint8
+	codes []*huffman.Code // Only used by readData.
+
+	sw bit.StreamWriter // Only used by writeData.
+}
+
+const (
+	// entropyLiterals is the number of values which get their own symbol.
+	entropyLiterals = 32
+	entropySymbols = entropyLiterals + 64 - 5
+)
+
+// entropySymbol returns the symbol used for v and the number of extra bits
+// which follow it.
+func entropySymbol(v uint64) (sym, extra int) {
+	if v < entropyLiterals { return int(v), 0 }
+	n := bits.Len64(v)
+	return entropyLiterals + n - 6, n - 1
+}
+
+func newEntropyIntGroup(startBlock, N int) *entropyIntGroup {
+	return &entropyIntGroup{
+		blockIndex: *newBlockIndex(startBlock),
+		blockLengths: blockLengths{ N: int64(N) },
+	}
+}
+
+func newEntropyIntGroupFromTail(f io.Reader) (*entropyIntGroup, error) {
+	g := &entropyIntGroup{ }
+	var startBlock, blocks int64
+	for _, x := range []*int64{ &g.N, &startBlock, &blocks } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+	if err := checkBlocks(f, blocks); err != nil { return nil, err }
+	if err := g.readLengths(f, blocks); err != nil { return nil, err }
+
+	err := checkCount(f, blocks, 16 + (entropySymbols + 1) / 2)
+	if err != nil { return nil, err }
+	g.mins = make([]int64, blocks)
+	sizes := make([]int64, blocks)
+	packed := make([]uint8, blocks*((entropySymbols + 1) / 2))
+	for _, x := range []interface{}{ g.mins, sizes, packed } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+
+	g.blockIndex = *newBlockIndex(int(startBlock))
+	g.lengths = make([][]uint8, blocks)
+	g.codes = make([]*huffman.Code, blocks)
+	for i := range sizes {
+		g.addBlock(sizes[i])
+
+		// Code lengths are packed two to a byte.
+		g.lengths[i] = make([]uint8, entropySymbols)
+		p := packed[i*((entropySymbols + 1) / 2):]
+		for j := range g.lengths[i] {
+			g.lengths[i][j] = (p[j/2] >> uint(4*(j%2))) & 0xf
+		}
+
+		var err error
+		g.codes[i], err = huffman.NewCode(g.lengths[i])
+		if err != nil { return nil, err }
+	}
+
+	return g, nil
+}
+
+func (g *entropyIntGroup) writeTail(f io.Writer) error {
+	for _, x := range []int64{ g.N, g.startBlock, g.blocks() } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	if err := g.writeLengths(f); err != nil { return err }
+
+	sizes := make([]int64, len(g.lengths))
+	for i := range sizes { sizes[i] = g.blockSize(i + int(g.startBlock)) }
+	packed := make([]uint8, len(g.lengths)*((entropySymbols + 1) / 2))
+	for i := range g.lengths {
+		p := packed[i*((entropySymbols + 1) / 2):]
+		for j, n := range g.lengths[i] { p[j/2] |= n << uint(4*(j%2)) }
+	}
+
+	for _, x := range []interface{}{ g.mins, sizes, packed } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	return nil
+}
+
+func (g *entropyIntGroup) groupType() int64 {
+	return EntropyIntGroup
+}
+
+func (g *entropyIntGroup) length(b int) int {
+	return g.blockLen(b - int(g.startBlock))
+}
+
+func (g *entropyIntGroup) blockLength() int64 {
+	return g.N
+}
+
+func (g *entropyIntGroup) encoder() group {
+	return newEntropyIntGroup(0, int(g.N))
+}
+
+func (g *entropyIntGroup) appendBlock(enc group) {
+	e := enc.(*entropyIntGroup)
+	g.appendIndex(&e.blockIndex)
+	g.appendLengths(&e.blockLengths)
+	g.mins = append(g.mins, e.mins[len(e.mins) - 1])
+	g.lengths = append(g.lengths, e.lengths[len(e.lengths) - 1])
+}
+
+func (g *entropyIntGroup) writeData(f io.Writer, x interface{}) error {
+	data := x.([]int64)
+	if err := g.addLen(len(data)); err != nil { return err }
+	min := int64Min(data)
+
+	freqs := make([]uint64, entropySymbols)
+	for i := range data {
+		sym, _ := entropySymbol(uint64(data[i] - min))
+		freqs[sym]++
+	}
+	lengths := huffman.Lengths(freqs)
+	code, err := huffman.NewCode(lengths)
+	if err != nil { return err }
+
+	g.sw.Reset()
+	for i := range data {
+		v := uint64(data[i] - min)
+		sym, extra := entropySymbol(v)
+		code.Write(&g.sw, sym)
+		g.sw.Write(v, extra)
+	}
+	buf := g.sw.Bytes()
+	if _, err := f.Write(buf); err != nil { return err }
+
+	g.mins = append(g.mins, min)
+	g.lengths = append(g.lengths, lengths)
+	g.addBlock(int64(len(buf)))
+	return nil
+}
+
+func (g *entropyIntGroup) readData(data []byte, b int, x interface{}) error {
+	out := x.([]int64)
+	bIdx := b - int(g.startBlock)
+	code, min := g.codes[bIdx], g.mins[bIdx]
+
+	r := bit.NewStreamReader(data)
+	for i := 0; i < g.blockLen(bIdx); i++ {
+		sym, err := code.Read(r)
+		if err != nil { return ioError(err) }
+		if sym < entropyLiterals {
+			out[i] = min + int64(sym)
+			continue
+		}
+
+		n := sym - entropyLiterals + 6
+		v, err := r.Read(n - 1)
+		if err != nil { return ioError(err) }
+		out[i] = min + int64(v | 1 << uint(n - 1))
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package minnow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrNotMinnow is returned when a file does not start with the minnow
+	// magic number.
+	ErrNotMinnow = errors.New("minnow: not a minnow file")
+	// ErrVersion is returned when a file was written with a version of the
+	// format that this code cannot read.
+	ErrVersion = errors.New("minnow: unsupported version")
+	// ErrTypeMismatch is returned when a buffer's type or size does not match
+	// the data stored in the file.
+	ErrTypeMismatch = errors.New("minnow: type mismatch")
+	// ErrTruncated is returned when a file ends before all of its data could
+	// be read.
+	ErrTruncated = errors.New("minnow: file is truncated")
+	// ErrUnknownGroup is returned when a file contains a group type that this
+	// code does not recognize.
+	ErrUnknownGroup = errors.New("minnow: unknown group type")
+	// ErrNoGroup is returned when data is written before any group has been
+	// started.
+	ErrNoGroup = errors.New("minnow: no group started")
+	// ErrChecksum is returned when data does not match its stored checksum.
+	ErrChecksum = errors.New("minnow: checksum mismatch")
+	// ErrHeaderName is returned when a header name is not in the file.
+	ErrHeaderName = errors.New("minnow: unknown header name")
+)
+
+// ioError converts an error returned by the io package into a minnow error.
+// Unexpected ends of files are reported as ErrTruncated.
+func ioError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: %v", ErrTruncated, err)
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package minnow
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/phil-mansfield/minnow/go/bit"
+)
+
+///////////////
+// flagGroup //
+///////////////
+
+// flagGroup stores boolean flags bit-packed at a fixed width. BoolGroup blocks
+// are []bool slices packed at one bit per element, while BitmaskGroup blocks
+// are []uint64 slices where only the lowest bits bits of each element may be
+// set.
+type flagGroup struct {
+	blockIndex
+	blockLengths
+	gt, bits int64
+	ab *bit.ArrayBuffer
+}
+
+func newFlagGroup(startBlock, N int, gt, bits int64) *flagGroup {
+	return &flagGroup{
+		blockIndex: *newBlockIndex(startBlock),
+		blockLengths: blockLengths{ N: int64(N) },
+		gt: gt, bits: bits, ab: &bit.ArrayBuffer{ },
+	}
+}
+
+func newFlagGroupFromTail(f io.Reader, gt int64) (*flagGroup, error) {
+	g := &flagGroup{ gt: gt, ab: &bit.ArrayBuffer{ } }
+	var startBlock, blocks int64
+	for _, x := range []*int64{ &g.N, &startBlock, &blocks, &g.bits } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+	if g.bits < 1 || g.bits > 64 {
+		return nil, fmt.Errorf("minnow: %s has %d bits per element",
+			GroupNames[gt], g.bits)
+	}
+	if err := checkBlocks(f, blocks); err != nil { return nil, err }
+	if err := g.readLengths(f, blocks); err != nil { return nil, err }
+
+	g.blockIndex = *newBlockIndex(int(startBlock))
+	for i := 0; i < int(blocks); i++ {
+		g.addBlock(int64(bit.ArrayBytes(int(g.bits), g.blockLen(i))))
+	}
+	return g, nil
+}
+
+func (g *flagGroup) writeTail(f io.Writer) error {
+	for _, x := range []int64{ g.N, g.startBlock, g.blocks(), g.bits } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	return g.writeLengths(f)
+}
+
+func (g *flagGroup) minBits(b int) (bits, n int64) {
+	return g.bits, int64(g.length(b))
+}
+
+func (g *flagGroup) groupType() int64 {
+	return g.gt
+}
+
+func (g *flagGroup) length(b int) int {
+	return g.blockLen(b - int(g.startBlock))
+}
+
+func (g *flagGroup) encoder() group {
+	return newFlagGroup(0, int(g.N), g.gt, g.bits)
+}
+
+func (g *flagGroup) appendBlock(enc group) {
+	e := enc.(*flagGroup)
+	g.appendIndex(&e.blockIndex)
+	g.appendLengths(&e.blockLengths)
+}
+
+func (g *flagGroup) writeData(f io.Writer, x interface{}) error {
+	n := sliceLen(x)
+	buf := g.ab.Uint64(n)
+	switch data := x.(type) {
+	case []bool:
+		for i := range data {
+			buf[i] = 0
+			if data[i] { buf[i] = 1 }
+		}
+	case []uint64:
+		for i := range data {
+			if g.bits < 64 && data[i] >> uint(g.bits) != 0 {
+				return fmt.Errorf("minnow: element %d has value %x, which " +
+					"does not fit in a %d-bit mask", i, data[i], g.bits)
+			}
+			buf[i] = data[i]
+		}
+	}
+
+	if err := g.addLen(n); err != nil { return err }
+	if err := g.ab.Write(f, buf, int(g.bits)); err != nil { return err }
+	g.addBlock(int64(bit.ArrayBytes(int(g.bits), n)))
+	return nil
+}
+
+func (g *flagGroup) readData(data []byte, b int, x interface{}) error {
+	n := g.length(b)
+	buf := getUint64s(n)
+	defer putUint64s(buf)
+	arr := bit.Array{ Length: n, Bits: byte(g.bits), Data: data }
+	arr.Slice(*buf)
+
+	switch out := x.(type) {
+	case []bool:
+		for i, v := range *buf { out[i] = v != 0 }
+	case []uint64:
+		copy(out, *buf)
+	}
+	return nil
+}
@@ -1,10 +1,11 @@
 package minnow
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"math"
-	"math/rand"
-	"os"
+	"reflect"
 	"github.com/phil-mansfield/minnow/go/bit"
 )
 
@@ -21,6 +22,16 @@ const (
 	Float32Group
 	IntGroup
 	FloatGroup
+	EntropyIntGroup
+	EntropyFloatGroup
+	DeltaIntGroup
+	LosslessFloat64Group
+	LosslessFloat32Group
+	BytesGroup
+	BoolGroup
+	BitmaskGroup
+	Vec32Group
+	Vec64Group
 )
 
 var (
@@ -37,17 +48,39 @@ var (
 		"Float32Group",
 		"IntGroup",
 		"FloatGroup",
+		"EntropyIntGroup",
+		"EntropyFloatGroup",
+		"DeltaIntGroup",
+		"LosslessFloat64Group",
+		"LosslessFloat32Group",
+		"BytesGroup",
+		"BoolGroup",
+		"BitmaskGroup",
+		"Vec32Group",
+		"Vec64Group",
 	}
 )
 
+// TypeMatch returns an error wrapping ErrTypeMismatch if x cannot be stored in
+// or read from a group with type gt.
 func TypeMatch(x interface{}, gt int64) error {
+	if _, ok := registeredGroup(gt); ok {
+		// User-defined groups check types themselves.
+		return nil
+	} else if gt < 0 || gt >= int64(len(GroupNames)) {
+		return fmt.Errorf("%w: %d", ErrUnknownGroup, gt)
+	}
 	f := func(s string) error {
-		return fmt.Errorf("Got type %s for group %s.", s, GroupNames[gt])
+		return fmt.Errorf("%w: got type %s for group %s", ErrTypeMismatch,
+			s, GroupNames[gt])
 	}
 	switch v := x.(type) {
 	case []int64:
 		_ = v // To get type switching to work
-		if !(gt == Int64Group || gt == IntGroup) { return f("[]int64") }
+		if !(gt == Int64Group || gt == IntGroup || gt == EntropyIntGroup ||
+			gt == DeltaIntGroup) {
+			return f("[]int64")
+		}
 	case []int32:
 		if !(gt == Int32Group) { return f("[]int32") }
 	case []int16:
@@ -55,7 +88,9 @@ func TypeMatch(x interface{}, gt int64) error {
 	case []int8:
 		if !(gt == Int8Group) { return f("[]int8") }
 	case []uint64:
-		if !(gt == Uint64Group) { return f("[]uint64") }
+		if !(gt == Uint64Group || gt == BitmaskGroup) {
+			return f("[]uint64")
+		}
 	case []uint32:
 		if !(gt == Uint32Group) { return f("[]uint32") }
 	case []uint16:
@@ -63,9 +98,50 @@ func TypeMatch(x interface{}, gt int64) error {
 	case []uint8:
 		if !(gt == Uint8Group) { return f("[]int8") }
 	case []float64:
-		if !(gt == Float64Group) { return f("[]float64") }
+		if !(gt == Float64Group || gt == LosslessFloat64Group) {
+			return f("[]float64")
+		}
 	case []float32:
-		if !(gt == Float32Group || gt == FloatGroup) { return f("[]float32") }
+		if !(gt == Float32Group || gt == FloatGroup ||
+			gt == EntropyFloatGroup || gt == LosslessFloat32Group) {
+			return f("[]float32")
+		}
+	case [][]byte:
+		if !(gt == BytesGroup) { return f("[][]byte") }
+	case []string:
+		if !(gt == BytesGroup) { return f("[]string") }
+	case []bool:
+		if !(gt == BoolGroup) { return f("[]bool") }
+	case [][3]float32:
+		if !(gt == Vec32Group) { return f("[][3]float32") }
+	case [][3]float64:
+		if !(gt == Vec64Group) { return f("[][3]float64") }
+	default:
+		return f(fmt.Sprintf("%T", x))
+	}
+	return nil
+}
+
+// newBlockSlice returns a new slice of length n that blocks of group type gt
+// can be read into, or nil if gt is a user-defined or unknown group.
+func newBlockSlice(gt int64, n int) interface{} {
+	switch gt {
+	case Int64Group, IntGroup, EntropyIntGroup, DeltaIntGroup:
+		return make([]int64, n)
+	case Int32Group: return make([]int32, n)
+	case Int16Group: return make([]int16, n)
+	case Int8Group: return make([]int8, n)
+	case Uint64Group, BitmaskGroup: return make([]uint64, n)
+	case Uint32Group: return make([]uint32, n)
+	case Uint16Group: return make([]uint16, n)
+	case Uint8Group: return make([]uint8, n)
+	case Float64Group, LosslessFloat64Group: return make([]float64, n)
+	case Float32Group, FloatGroup, EntropyFloatGroup, LosslessFloat32Group:
+		return make([]float32, n)
+	case BytesGroup: return make([][]byte, n)
+	case BoolGroup: return make([]bool, n)
+	case Vec32Group: return make([][3]float32, n)
+	case Vec64Group: return make([][3]float64, n)
 	}
 	return nil
 }
@@ -78,28 +154,84 @@ type group interface {
 	groupType() int64
 	length(b int) int
 
-	writeData(f *os.File, x interface{})
-	writeTail(f *os.File)
+	writeData(f io.Writer, x interface{}) error
+	writeTail(f io.Writer) error
 
 	blockOffset(b int) int64
-
-	readData(f *os.File, b int, x interface{})
+	blockSize(b int) int64
+	// setStartBlock changes the file block index of the group's first block.
+	setStartBlock(b int)
+
+	// readData decodes block b from data, the full contents of the block.
+	// It must be safe to call concurrently.
+	readData(data []byte, b int, x interface{}) error
+}
+
+// rangeGroup is implemented by groups which can decode a range of elements
+// without decoding the rest of the block.
+type rangeGroup interface {
+	// rangeBytes returns the bytes of block b, relative to the start of the
+	// block, needed to decode elements [start, end).
+	rangeBytes(b, start, end int) (lo, hi int64)
+	// readRange decodes elements [start, end) of block b into x. data holds
+	// the bytes given by rangeBytes. It must be safe to call concurrently.
+	readRange(data []byte, b, start, end int, x interface{}) error
+}
+
+// concurrentGroup is implemented by groups whose blocks can be encoded
+// concurrently (see Writer.SetConcurrency).
+type concurrentGroup interface {
+	group
+	// encoder returns an empty group with the same settings as the group,
+	// which a single block can be written to independently of it.
+	encoder() group
+	// appendBlock adds the block written to enc, which was returned by
+	// encoder, to the group.
+	appendBlock(enc group)
 }
 
 var (
 	_ group = &fixedSizeGroup{ }
+	_ rangeGroup = &fixedSizeGroup{ }
+	_ rangeGroup = &intGroup{ }
+	_ rangeGroup = &floatGroup{ }
+	_ concurrentGroup = &fixedSizeGroup{ }
+	_ concurrentGroup = &intGroup{ }
+	_ concurrentGroup = &floatGroup{ }
+	_ concurrentGroup = &entropyIntGroup{ }
+	_ concurrentGroup = &deltaIntGroup{ }
+	_ concurrentGroup = &losslessFloatGroup{ }
+	_ concurrentGroup = &bytesGroup{ }
+	_ concurrentGroup = &flagGroup{ }
+	_ concurrentGroup = &vecGroup{ }
 )
 
-func groupFromTail(f *os.File, gt int64) group {
+func groupFromTail(f io.Reader, gt int64, startBlock int) (group, error) {
+	if factory, ok := registeredGroup(gt); ok {
+		return newUserGroupFromTail(f, gt, factory)
+	}
+
 	switch {
 	case gt >= Int64Group && gt <= Float32Group:
 		return newFixedSizeGroupFromTail(f, gt)
 	case gt == IntGroup:
 		return newIntGroupFromTail(f)
-	case gt == FloatGroup:
-		return newFloatGroupFromTail(f)
+	case gt == EntropyIntGroup:
+		return newEntropyIntGroupFromTail(f)
+	case gt == DeltaIntGroup:
+		return newDeltaIntGroupFromTail(f)
+	case gt == LosslessFloat64Group || gt == LosslessFloat32Group:
+		return newLosslessFloatGroupFromTail(f, gt)
+	case gt == FloatGroup || gt == EntropyFloatGroup:
+		return newFloatGroupFromTail(f, gt)
+	case gt == BytesGroup:
+		return newBytesGroupFromTail(f)
+	case gt == BoolGroup || gt == BitmaskGroup:
+		return newFlagGroupFromTail(f, gt)
+	case gt == Vec32Group || gt == Vec64Group:
+		return newVecGroupFromTail(f, gt)
 	}
-	panic(fmt.Sprintf("Unrecognized group type, %d.", gt))
+	return nil, fmt.Errorf("%w: %d", ErrUnknownGroup, gt)
 }
 
 ////////////////////
@@ -108,34 +240,40 @@ func groupFromTail(f *os.File, gt int64) group {
 
 type fixedSizeGroup struct {
 	blockIndex
-	N int64
+	blockLengths
 	typeSize int64
 	gt int64
 }
 
 func newFixedSizeGroup(startBlock, N int, gt int64) *fixedSizeGroup {
 	return &fixedSizeGroup{
-		*newBlockIndex(startBlock), int64(N),
+		*newBlockIndex(startBlock), blockLengths{ N: int64(N) },
 		int64(fixedSizeBytes[gt]), gt,
 	}
 }
 
-func newFixedSizeGroupFromTail(f *os.File, gt int64) *fixedSizeGroup {
+func newFixedSizeGroupFromTail(f io.Reader, gt int64) (group, error) {
 	startBlock := int64(0)
 	blocks := int64(0)
 	g := &fixedSizeGroup{ typeSize: int64(fixedSizeBytes[gt]) }
 
-	binaryRead(f, &g.N)
-	binaryRead(f, &startBlock)
-	binaryRead(f, &blocks)
+	for _, x := range []*int64{ &g.N, &startBlock, &blocks } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+	if err := checkBlocks(f, blocks); err != nil { return nil, err }
+	if err := g.readLengths(f, blocks); err != nil { return nil, err }
 
 	g.blockIndex = *newBlockIndex(int(startBlock))
-	for i := int64(0); i < blocks; i++ {
-		g.addBlock(g.typeSize*g.N)
+	for i := 0; i < int(blocks); i++ {
+		g.addBlock(g.typeSize*int64(g.blockLen(i)))
 	}
 	g.gt = gt
 
-	return g
+	return g, nil
+}
+
+func (g *fixedSizeGroup) minBits(b int) (bits, n int64) {
+	return 8*g.typeSize, int64(g.length(b))
 }
 
 func (g *fixedSizeGroup) groupType() int64 {
@@ -143,23 +281,47 @@ func (g *fixedSizeGroup) groupType() int64 {
 }
 
 func (g *fixedSizeGroup) length(b int) int {
-	return int(g.N)
+	return g.blockLen(b - int(g.startBlock))
+}
+
+func (g *fixedSizeGroup) writeData(f io.Writer, x interface{}) error {
+	n := sliceLen(x)
+	if err := g.addLen(n); err != nil { return err }
+	if err := binaryWrite(f, x); err != nil { return err }
+	g.addBlock(g.typeSize*int64(n))
+	return nil
+}
+
+func (g *fixedSizeGroup) encoder() group {
+	return newFixedSizeGroup(0, int(g.N), g.gt)
+}
+
+func (g *fixedSizeGroup) appendBlock(enc group) {
+	e := enc.(*fixedSizeGroup)
+	g.appendIndex(&e.blockIndex)
+	g.appendLengths(&e.blockLengths)
+}
+
+func (g *fixedSizeGroup) readData(data []byte, b int, out interface{}) error {
+	return binaryRead(bytes.NewReader(data), sliceHead(out, g.length(b)))
 }
 
-func (g *fixedSizeGroup) writeData(f *os.File, x interface{}) {
-	binaryWrite(f, x)
-	g.addBlock(g.typeSize*g.N)
+func (g *fixedSizeGroup) rangeBytes(b, start, end int) (lo, hi int64) {
+	return int64(start)*g.typeSize, int64(end)*g.typeSize
 }
 
-func (g *fixedSizeGroup) readData(f *os.File, b int, out interface{}) {
-	binaryRead(f, out)
+func (g *fixedSizeGroup) readRange(
+	data []byte, b, start, end int, out interface{},
+) error {
+	return binaryRead(bytes.NewReader(data), sliceHead(out, end - start))
 }
 
 
-func (g *fixedSizeGroup) writeTail(f *os.File) {
-	binaryWrite(f, g.N)
-	binaryWrite(f, g.startBlock)
-	binaryWrite(f, g.blocks())
+func (g *fixedSizeGroup) writeTail(f io.Writer) error {
+	for _, x := range []int64{ g.N, g.startBlock, g.blocks() } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	return g.writeLengths(f)
 }
 
 ///////////////
@@ -171,64 +333,76 @@ func (g *fixedSizeGroup) writeTail(f *os.File) {
 // as a component of several other, more comlicated groups.
 type intGroup struct {
 	blockIndex
-	N int64
+	blockLengths
 	ab *bit.ArrayBuffer
 	mins, bits []int64
 }
 
 func newIntGroup(startBlock, N int) group {
 	return &intGroup{
-		blockIndex: *newBlockIndex(startBlock), N: int64(N),
+		blockIndex: *newBlockIndex(startBlock),
+		blockLengths: blockLengths{ N: int64(N) },
 		ab: &bit.ArrayBuffer{ },
 	}
 }
 
-func newIntGroupFromTail(f *os.File) group {
+func newIntGroupFromTail(f io.Reader) (group, error) {
 	g := &intGroup{ }
 	var startBlock, blocks, min, bits int64
 	g.ab = &bit.ArrayBuffer{ }
 
-	read := func() (x []int64) {
-		binaryRead(f, &min)
-		binaryRead(f, &bits)
+	read := func() ([]int64, error) {
+		if err := binaryRead(f, &min); err != nil { return nil, err }
+		if err := binaryRead(f, &bits); err != nil { return nil, err }
+		if bits < 0 || bits > 64 {
+			return nil, fmt.Errorf("%w: IntGroup tail has %d bits per " +
+				"element", ErrTruncated, bits)
+		}
+		err := checkCount(f, int64(bit.ArrayBytes(int(bits), int(blocks))), 1)
+		if err != nil { return nil, err }
 
-		buf := g.ab.Read(f, int(bits), int(blocks))
+		buf, err := g.ab.Read(f, int(bits), int(blocks))
+		if err != nil { return nil, ioError(err) }
 		out := make([]int64, blocks)
 		for i := range out { out[i] = min + int64(buf[i] )}
-		return out
+		return out, nil
 	}
 
-	binaryRead(f, &g.N)
-	binaryRead(f, &startBlock)
-	binaryRead(f, &blocks)
-	g.mins = read()
-	g.bits = read()
+	for _, x := range []*int64{ &g.N, &startBlock, &blocks } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+	if err := checkBlocks(f, blocks); err != nil { return nil, err }
+	if err := g.readLengths(f, blocks); err != nil { return nil, err }
+	var err error
+	if g.mins, err = read(); err != nil { return nil, err }
+	if g.bits, err = read(); err != nil { return nil, err }
 
 	g.blockIndex = *newBlockIndex(int(startBlock))
 	for i := range g.bits {
-		g.addBlock(int64(bit.ArrayBytes(int(g.bits[i]), int(g.N))))
+		g.addBlock(int64(bit.ArrayBytes(int(g.bits[i]), g.blockLen(i))))
 	}
 
-	return g
+	return g, nil
 }
 
-func (g *intGroup) writeTail(f *os.File) {
-	write := func(x []int64) {
+func (g *intGroup) writeTail(f io.Writer) error {
+	write := func(x []int64) error {
 		buf := g.ab.Uint64(len(x))
 		min := int64Min(x)
 		for i := range x { buf[i] = uint64(x[i] - min) }
 		bits := g.ab.Bits(buf)
 
-		binaryWrite(f, min)
-		binaryWrite(f, int64(bits))
-		g.ab.Write(f, buf, bits)
+		if err := binaryWrite(f, min); err != nil { return err }
+		if err := binaryWrite(f, int64(bits)); err != nil { return err }
+		return g.ab.Write(f, buf, bits)
 	}
 
-	binaryWrite(f, int64(g.N))
-	binaryWrite(f, g.startBlock)
-	binaryWrite(f, g.blocks())
-	write(g.mins)
-	write(g.bits)
+	for _, x := range []int64{ g.N, g.startBlock, g.blocks() } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	if err := g.writeLengths(f); err != nil { return err }
+	if err := write(g.mins); err != nil { return err }
+	return write(g.bits)
 }
 
 func (g *intGroup) groupType() int64 {
@@ -236,117 +410,344 @@ func (g *intGroup) groupType() int64 {
 }
 
 func (g *intGroup) length(b int) int {
-	return int(g.N)
+	return g.blockLen(b - int(g.startBlock))
 }
 
-func (g *intGroup) writeData(f *os.File, x interface{}) {
+func (g *intGroup) blockLength() int64 {
+	return g.N
+}
+
+func (g *intGroup) encoder() group {
+	return newIntGroup(0, int(g.N))
+}
+
+func (g *intGroup) appendBlock(enc group) {
+	e := enc.(*intGroup)
+	g.appendIndex(&e.blockIndex)
+	g.appendLengths(&e.blockLengths)
+	g.mins = append(g.mins, e.mins[len(e.mins) - 1])
+	g.bits = append(g.bits, e.bits[len(e.bits) - 1])
+}
+
+func (g *intGroup) writeData(f io.Writer, x interface{}) error {
 	data := x.([]int64)
+	if err := g.addLen(len(data)); err != nil { return err }
 	min := int64Min(data)
 	
 	buf := g.ab.Uint64(len(data))
 	for i := range buf { buf[i] = uint64(data[i] - min) }
 	bits := g.ab.Bits(buf)
-	g.ab.Write(f, buf, bits)
+	if err := g.ab.Write(f, buf, bits); err != nil { return err }
 	
 	g.mins = append(g.mins, min)
 	g.bits = append(g.bits, int64(bits))
 
-	g.addBlock(int64(bit.ArrayBytes(bits, int(g.N))))
+	g.addBlock(int64(bit.ArrayBytes(bits, len(data))))
+	return nil
+}
+
+func (g *intGroup) readData(data []byte, b int, x interface{}) error {
+	out := x.([]int64)
+	bIdx := b - int(g.startBlock)
+	bits, min, n := g.bits[bIdx], g.mins[bIdx], g.blockLen(bIdx)
+	if bits == 0 {
+		for i := 0; i < n; i++ { out[i] = min }
+		return nil
+	}
+
+	buf := getUint64s(n)
+	defer putUint64s(buf)
+	arr := bit.Array{ Length: n, Bits: byte(bits), Data: data }
+	arr.Slice(*buf)
+	for i, x := range *buf { out[i] = min + int64(x) }
+	return nil
+}
+
+// Every eighth element of an intGroup block starts on a byte boundary, so
+// ranges are read starting from the one at or before start.
+
+func (g *intGroup) rangeBytes(b, start, end int) (lo, hi int64) {
+	bits := g.bits[b - int(g.startBlock)]
+	first := int64(start &^ 7)
+	return first*bits / 8, (int64(end)*bits + 7) / 8
 }
 
-func (g *intGroup) readData(f *os.File, b int, x interface{}) {	
+func (g *intGroup) readRange(
+	data []byte, b, start, end int, x interface{},
+) error {
 	out := x.([]int64)
 	bIdx := b - int(g.startBlock)
 	bits, min := g.bits[bIdx], g.mins[bIdx]
-	buf := g.ab.Read(f, int(bits), int(g.N))
-	for i := range buf { out[i] = min + int64(buf[i]) }
+
+	first := start &^ 7
+	arr := bit.Array{ Length: end - first, Bits: byte(bits), Data: data }
+	for i := start; i < end; i++ {
+		out[i - start] = min + int64(arr.Get(i - first))
+	}
+	return nil
 }
 
 /////////////////
 // FloatGroup //
 /////////////////
 
+// intCodec is a group which stores []int64 blocks of a fixed length. It is
+// used to store the quantized values of floatGroup.
+type intCodec interface {
+	concurrentGroup
+	blockLength() int64
+	blocks() int64
+	firstBlock() int64
+}
+
+// Bits of floatGroup.flags. Files before version 3 only use floatPeriodic.
+// Bits 2 and 3 store the group's Dequantization.
+const (
+	floatPeriodic uint8 = 1 << iota
+	floatLog
+
+	floatModeShift = 2
+	floatModeMask uint8 = 3 << floatModeShift
+)
+
+// Dequantization is a method for turning the quantized values stored by
+// FloatGroup back into floats. All methods are deterministic.
+type Dequantization uint8
+
+const (
+	// Dither places each value at a pseudo-random point within its cell.
+	// The random sequence is seeded by the block's index within its group,
+	// so the same block always decodes to the same values, even after it's
+	// copied or appended to another file. This is the default.
+	Dither Dequantization = iota
+	// Midpoint places each value at the center of its cell.
+	Midpoint
+	// LowerEdge places each value at the lower edge of its cell.
+	LowerEdge
+)
+
 type floatGroup struct {
-	ig *intGroup
+	ig intCodec
+	gt int64
 	low, high float32
 	pixels int64
-	periodic uint8
-	buf []int64
+	flags uint8
+	buf []int64 // Only used by writeData.
+	stats BlockStats // Only used by writeData.
+
+	// override replaces the Dequantization stored in flags if it's
+	// non-negative. Only set by Reader.SetDequantization.
+	override int
+}
+
+// dequantization returns the method used to reconstruct values.
+func (g *floatGroup) dequantization() Dequantization {
+	if g.override >= 0 { return Dequantization(g.override) }
+	return Dequantization((g.flags & floatModeMask) >> floatModeShift)
 }
 
 func newFloatGroup(
-	startBlock, N int, low, high float32, pixels int64, periodic bool,
+	ig intCodec, gt int64, low, high float32, pixels int64, flags uint8,
 ) group {
-	u8Periodic := uint8(0)
-	if periodic { u8Periodic = 1 }
 	return &floatGroup{
-		ig: newIntGroup(startBlock, N).(*intGroup),
-		low: low, high: high, pixels: pixels, periodic: u8Periodic,
+		ig: ig, gt: gt,
+		low: low, high: high, pixels: pixels, flags: flags, override: -1,
 	}
 }
 
 func (g *floatGroup) groupType() int64 {
-	return FloatGroup
+	return g.gt
 }
 func (g *floatGroup) length(b int) int {
 	return g.ig.length(b)
 }
 
+func (g *floatGroup) blocks() int64 {
+	return g.ig.blocks()
+}
+
 func (g *floatGroup) blockOffset(b int) int64 {
 	return g.ig.blockOffset(b)
 }
 
-func (g *floatGroup) readData(f *os.File, b int, x interface{}) {
-	out := x.([]float32)
-	g.buf = resizeInt64(g.buf, int(g.ig.N))
-	g.ig.readData(f, b, g.buf)
-	if g.periodic == 1 { bound(g.buf, 0, g.pixels) }
+func (g *floatGroup) blockSize(b int) int64 {
+	return g.ig.blockSize(b)
+}
+
+func (g *floatGroup) setStartBlock(b int) {
+	g.ig.setStartBlock(b)
+}
+
+func (g *floatGroup) readData(data []byte, b int, x interface{}) error {
+	buf := getInt64s(g.ig.length(b))
+	defer putInt64s(buf)
+	if err := g.ig.readData(data, b, *buf); err != nil { return err }
+	g.dequantize(*buf, b, 0, x.([]float32))
+	return nil
+}
+
+// rangeBytes returns the whole block if the quantized values are stored in a
+// group which can't read ranges.
+func (g *floatGroup) rangeBytes(b, start, end int) (lo, hi int64) {
+	if rg, ok := g.ig.(rangeGroup); ok { return rg.rangeBytes(b, start, end) }
+	return 0, g.blockSize(b)
+}
+
+func (g *floatGroup) readRange(
+	data []byte, b, start, end int, x interface{},
+) error {
+	buf := getInt64s(end - start)
+	defer putInt64s(buf)
+	if rg, ok := g.ig.(rangeGroup); ok {
+		if err := rg.readRange(data, b, start, end, *buf); err != nil {
+			return err
+		}
+	} else {
+		all := getInt64s(g.ig.length(b))
+		defer putInt64s(all)
+		if err := g.ig.readData(data, b, *all); err != nil { return err }
+		copy(*buf, (*all)[start:end])
+	}
+	g.dequantize(*buf, b, start, x.([]float32))
+	return nil
+}
+
+// dequantize converts the quantized values q into floats, where q[0] is
+// element first of block b.
+func (g *floatGroup) dequantize(q []int64, b, first int, out []float32) {
+	if g.flags & floatPeriodic != 0 { bound(q, 0, g.pixels) }
 
 	L := g.high - g.low
 	dx := L / float32(g.pixels)
-	for i := range g.buf {
-		out[i] = dx*float32(float64(g.buf[i]) + rand.Float64()) + g.low
+	switch g.dequantization() {
+	case Midpoint:
+		for i, x := range q { out[i] = dx*(float32(x) + 0.5) + g.low }
+	case LowerEdge:
+		for i, x := range q { out[i] = dx*float32(x) + g.low }
+	default:
+		bIdx := int64(b) - g.ig.firstBlock()
+		seed := splitmix64(uint64(bIdx)) + uint64(first)
+		for i, x := range q {
+			u := float64(splitmix64(seed + uint64(i)) >> 11) / (1 << 53)
+			out[i] = dx*float32(float64(x) + u) + g.low
+		}
+	}
+	if g.flags & floatLog != 0 {
+		for i := range q {
+			out[i] = float32(math.Pow(10, float64(out[i])))
+		}
 	}
 }
 
-func (g *floatGroup) writeData(f *os.File, x interface{}) {
+func (g *floatGroup) encoder() group {
+	ig := g.ig.encoder().(intCodec)
+	return newFloatGroup(ig, g.gt, g.low, g.high, g.pixels, g.flags)
+}
+
+func (g *floatGroup) appendBlock(enc group) {
+	g.ig.appendBlock(enc.(*floatGroup).ig)
+}
+
+func (g *floatGroup) writeData(f io.Writer, x interface{}) error {
 	data := x.([]float32)
-	g.buf = resizeInt64(g.buf, int(g.ig.N))
+	N := g.ig.blockLength()
+	if N != VariableLength && len(data) != int(N) {
+		return fmt.Errorf("%w: group has blocks of length %d, but got a " +
+			"block of length %d", ErrTypeMismatch, N, len(data))
+	}
+	g.buf = resizeInt64(g.buf, len(data))
 
 	dx := (g.high - g.low) / float32(g.pixels)
+	periodic := g.flags & floatPeriodic != 0
+	maxX := math.Nextafter32(g.high, float32(math.Inf(-1)))
 	
 	for i := range g.buf {
-		g.buf[i] = int64(math.Floor(float64((data[i] - g.low) / dx)))
+		x := data[i]
+		if g.flags & floatLog != 0 { x = float32(math.Log10(float64(x))) }
+		if periodic {
+			g.buf[i] = periodicCell(float64((x - g.low) / dx), g.pixels)
+			continue
+		}
+		// Clamp to [low, high), sending NaNs to low.
+		if !(x >= g.low) { x = g.low }
+		if x > maxX { x = maxX }
+		g.buf[i] = int64(math.Floor(float64((x - g.low) / dx)))
 	}
-	if g.periodic == 1 {
+	if periodic {
 		min := periodicMin(g.buf, g.pixels)
 		bound(g.buf, min, g.pixels)
 	}
 
-	g.ig.writeData(f, g.buf)
+	g.stats = emptyStats()
+	if len(data) > 0 {
+		qMin, qMax := quantizedRange(g.buf, g.pixels, periodic)
+		g.stats = cellStats(float64(g.low), float64(g.high), g.pixels,
+			qMin, qMax, g.flags & floatLog != 0)
+	}
+	for _, v := range data {
+		if math.IsNaN(float64(v)) { g.stats.Nulls++ }
+	}
+
+	return g.ig.writeData(f, g.buf)
 }
-func (g *floatGroup) writeTail(f *os.File) {
-	g.ig.writeTail(f)
-	binaryWrite(f, g.low)
-	binaryWrite(f, g.high)
-	binaryWrite(f, g.pixels)
-	binaryWrite(f, g.periodic)
+
+func (g *floatGroup) lastStats() BlockStats {
+	return g.stats
+}
+func (g *floatGroup) writeTail(f io.Writer) error {
+	if err := g.ig.writeTail(f); err != nil { return err }
+	for _, x := range []interface{}{ g.low, g.high, g.pixels, g.flags } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	return nil
 }
 
-func newFloatGroupFromTail(f *os.File) group {
-	g := &floatGroup{ }
-	g.ig = newIntGroupFromTail(f).(*intGroup)
-	binaryRead(f, &g.low)
-	binaryRead(f, &g.high)
-	binaryRead(f, &g.pixels)
-	binaryRead(f, &g.periodic)
-	return g
+func newFloatGroupFromTail(f io.Reader, gt int64) (group, error) {
+	g := &floatGroup{ gt: gt, override: -1 }
+	var err error
+	if gt == EntropyFloatGroup {
+		g.ig, err = newEntropyIntGroupFromTail(f)
+	} else {
+		var ig group
+		ig, err = newIntGroupFromTail(f)
+		if err == nil { g.ig = ig.(*intGroup) }
+	}
+	if err != nil { return nil, err }
+	
+	for _, x := range []interface{}{ &g.low, &g.high, &g.pixels, &g.flags } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+	return g, nil
 }
 
 ///////////////////////
 // utility functions //
 ///////////////////////
 
+// sliceLen returns the length of x if it is a slice and -1 otherwise.
+func sliceLen(x interface{}) int {
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Slice { return -1 }
+	return v.Len()
+}
+
+// sliceHead returns the first n elements of x if it is a slice and x
+// otherwise.
+func sliceHead(x interface{}, n int) interface{} {
+	v := reflect.ValueOf(x)
+	if v.Kind() != reflect.Slice || v.Len() == n { return x }
+	return v.Slice(0, n).Interface()
+}
+
+// splitmix64 is a fast, high quality hash for turning sequential integers into
+// pseudo-random bits.
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
 func int64Min(x []int64) int64 {
 	if len(x) == 0 { return 0 }
 	min := x[0]
@@ -371,6 +772,24 @@ func resizeInt64(x []int64, n int) []int64 {
 	return append(x, make([]int64, n - len(x))...)
 }
 
+func resizeUint64(x []uint64, n int) []uint64 {
+	if cap(x) >= n { return x[:n] }
+	x = x[:cap(x)]
+	return append(x, make([]uint64, n - len(x))...)
+}
+
+// periodicCell returns the cell that a value in a periodic group falls in,
+// where q is the value's distance from the group's lower limit in units of
+// cells. Cells are wrapped into [0, pixels). NaNs and infinities, including
+// the logarithms of zero and negative values, can't be wrapped and are sent
+// to cell 0, the same as NaNs in non-periodic groups.
+func periodicCell(q float64, pixels int64) int64 {
+	if math.IsNaN(q) || math.IsInf(q, 0) { return 0 }
+	q = math.Mod(math.Floor(q), float64(pixels))
+	if q < 0 { q += float64(pixels) }
+	return int64(q)
+}
+
 func bound(x []int64, min, pixels int64) {
 	for i := range x {
 		if x[i] < min {
@@ -0,0 +1,151 @@
+package minnow
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Starting with version 5, every header has a name and a schema stored in the
+// tail. Headers written with Writer.Header have empty names. A schema
+// describes the layout of the header's bytes with Go-like syntax:
+//
+//   type   = "int8" | "int16" | "int32" | "int64" |
+//            "uint8" | "uint16" | "uint32" | "uint64" |
+//            "float32" | "float64" | "complex64" | "complex128" | "bool" |
+//            "[" length "]" type |
+//            "struct{" field { "; " field } "}"
+//   field  = name " " type
+//
+// Values are little-endian and packed without padding, so a header's schema
+// is enough to decode it without knowing the Go type that wrote it. Fields
+// named "_" are padding and are always zero.
+
+// NamedHeader is the same as Header, but gives the header a name which it can
+// be looked up with by Reader.HeaderByName. Names must be unique and
+// non-empty.
+func (wr *Writer) NamedHeader(name string, x interface{}) (int, error) {
+	if name == "" {
+		return -1, fmt.Errorf("minnow: header names must be non-empty")
+	}
+	for i := range wr.headerNames {
+		if wr.headerNames[i] == name {
+			return -1, fmt.Errorf("minnow: header %d already has the " +
+				"name '%s'", i, name)
+		}
+	}
+
+	i, err := wr.Header(x)
+	if err != nil { return -1, err }
+	wr.headerNames[i] = name
+	return i, nil
+}
+
+// HeaderByName reads the header with the given name. An error wrapping
+// ErrHeaderName is returned if there is no such header, and one wrapping
+// ErrTypeMismatch if the schema of out doesn't match the header's.
+func (rd *Reader) HeaderByName(name string, out interface{}) error {
+	i := rd.HeaderIndex(name)
+	if i < 0 {
+		return fmt.Errorf("%w: '%s'", ErrHeaderName, name)
+	}
+	if s := schema(out); s != rd.headerSchemas[i] {
+		return fmt.Errorf("%w: header '%s' has schema %s, but the output " +
+			"buffer has schema %s", ErrTypeMismatch, name,
+			rd.headerSchemas[i], s)
+	}
+	return rd.Header(i, out)
+}
+
+// HeaderIndex returns the index of the header with the given name, or -1 if
+// there is no such header.
+func (rd *Reader) HeaderIndex(name string) int {
+	for i := range rd.headerNames {
+		if rd.headerNames[i] == name && name != "" { return i }
+	}
+	return -1
+}
+
+// HeaderName returns the name of the ith header. Unnamed headers and headers
+// in files written before version 5 have empty names.
+func (rd *Reader) HeaderName(i int) (string, error) {
+	if i < 0 || i >= rd.headers {
+		return "", fmt.Errorf("minnow: header %d is not in the range [0, %d)",
+			i, rd.headers)
+	}
+	return rd.headerNames[i], nil
+}
+
+// HeaderSchema returns the schema of the ith header. Headers in files written
+// before version 5 have empty schemas.
+func (rd *Reader) HeaderSchema(i int) (string, error) {
+	if i < 0 || i >= rd.headers {
+		return "", fmt.Errorf("minnow: header %d is not in the range [0, %d)",
+			i, rd.headers)
+	}
+	return rd.headerSchemas[i], nil
+}
+
+// schema returns the schema of x, which must have a fixed size. Top-level
+// slices are treated as arrays of their current length.
+func schema(x interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(x))
+	if v.Kind() == reflect.Slice {
+		return fmt.Sprintf("[%d]%s", v.Len(), typeSchema(v.Type().Elem()))
+	}
+	return typeSchema(v.Type())
+}
+
+// typeSchema returns the schema of the type t.
+func typeSchema(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), typeSchema(t.Elem()))
+	case reflect.Struct:
+		fields := make([]string, t.NumField())
+		for i := range fields {
+			f := t.Field(i)
+			fields[i] = f.Name + " " + typeSchema(f.Type)
+		}
+		return "struct{" + strings.Join(fields, "; ") + "}"
+	}
+	// The remaining kinds that binary.Size accepts are named the same way
+	// as their reflect.Kind.
+	return t.Kind().String()
+}
+
+// writeHeaderNames writes the name and schema of every header to f.
+func writeHeaderNames(f io.Writer, names, schemas []string) error {
+	for i := range names {
+		for _, s := range []string{ names[i], schemas[i] } {
+			if err := binaryWrite(f, int64(len(s))); err != nil { return err }
+			if _, err := io.WriteString(f, s); err != nil { return err }
+		}
+	}
+	return nil
+}
+
+// readHeaderNames reads the name and schema of n headers from f.
+func readHeaderNames(f io.Reader, n int) (names, schemas []string, err error) {
+	if err := checkCount(f, int64(n), 16); err != nil { return nil, nil, err }
+	names, schemas = make([]string, n), make([]string, n)
+	for i := 0; i < n; i++ {
+		for _, s := range []*string{ &names[i], &schemas[i] } {
+			var size int64
+			if err := binaryRead(f, &size); err != nil { return nil, nil, err }
+			if err := checkCount(f, size, 1); err != nil {
+				return nil, nil, fmt.Errorf("header %d has a name or " +
+					"schema that's too long: %w", i, err)
+			}
+			// Copying lets a corrupt size fail at the end of the file
+			// instead of allocating a huge buffer up front.
+			sb := &strings.Builder{ }
+			if _, err := io.CopyN(sb, f, size); err != nil {
+				return nil, nil, ioError(err)
+			}
+			*s = sb.String()
+		}
+	}
+	return names, schemas, nil
+}
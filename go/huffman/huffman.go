@@ -0,0 +1,174 @@
+/*package huffman implements canonical, length-limited Huffman codes. Codes are
+described entirely by the length of each symbol's code, so only those lengths
+need to be stored alongside the encoded data.*/
+package huffman
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/phil-mansfield/minnow/go/bit"
+)
+
+// MaxBits is the longest code length that Lengths will assign. It allows
+// lengths to be stored in four bits.
+const MaxBits = 15
+
+// ErrCorrupt is returned when data cannot be decoded with a Code.
+var ErrCorrupt = errors.New("huffman: corrupt data")
+
+// Lengths returns the code length of each symbol for a Huffman code built from
+// the symbol frequencies freqs. Symbols with a frequency of zero get a length
+// of zero, and no length is longer than MaxBits.
+func Lengths(freqs []uint64) []uint8 {
+	f := make([]uint64, len(freqs))
+	copy(f, freqs)
+	for {
+		lengths, max := unlimitedLengths(f)
+		if max <= MaxBits { return lengths }
+		// Flatten the distribution until the code is short enough.
+		for i := range f {
+			if f[i] > 0 { f[i] = (f[i] + 1) / 2 }
+		}
+	}
+}
+
+// node is a node in a Huffman tree. Leaves have sym >= 0.
+type node struct {
+	freq uint64
+	sym int
+	left, right *node
+}
+
+// unlimitedLengths returns the code lengths of a standard Huffman code along
+// with the longest code length.
+func unlimitedLengths(freqs []uint64) ([]uint8, int) {
+	lengths := make([]uint8, len(freqs))
+
+	nodes := []*node{ }
+	for i := range freqs {
+		if freqs[i] > 0 { nodes = append(nodes, &node{ freqs[i], i, nil, nil }) }
+	}
+	switch len(nodes) {
+	case 0:
+		return lengths, 0
+	case 1:
+		lengths[nodes[0].sym] = 1
+		return lengths, 1
+	}
+
+	// Merge the two least frequent nodes until only the root remains. Ties
+	// are broken by symbol so the result is deterministic.
+	sort.Slice(nodes, func(i, j int) bool { return less(nodes[i], nodes[j]) })
+	for len(nodes) > 1 {
+		parent := &node{
+			nodes[0].freq + nodes[1].freq, -1, nodes[0], nodes[1],
+		}
+		nodes = nodes[2:]
+		i := sort.Search(len(nodes), func(i int) bool {
+			return less(parent, nodes[i])
+		})
+		nodes = append(nodes, nil)
+		copy(nodes[i+1:], nodes[i:])
+		nodes[i] = parent
+	}
+
+	max := 0
+	var walk func(n *node, depth int)
+	walk = func(n *node, depth int) {
+		if n.sym >= 0 {
+			lengths[n.sym] = uint8(depth)
+			if depth > max { max = depth }
+			return
+		}
+		walk(n.left, depth + 1)
+		walk(n.right, depth + 1)
+	}
+	walk(nodes[0], 0)
+
+	return lengths, max
+}
+
+func less(a, b *node) bool {
+	if a.freq != b.freq { return a.freq < b.freq }
+	return a.sym < b.sym
+}
+
+// Code is a canonical Huffman code. It is safe to decode with a Code from
+// multiple goroutines.
+type Code struct {
+	lengths []uint8
+	codes []uint32
+	count [MaxBits + 1]int
+	symbols []int
+}
+
+// NewCode creates the canonical Huffman code with the given code lengths. An
+// error is returned if no prefix code has those lengths.
+func NewCode(lengths []uint8) (*Code, error) {
+	c := &Code{ lengths: lengths, codes: make([]uint32, len(lengths)) }
+	for sym, n := range lengths {
+		if n > MaxBits {
+			return nil, fmt.Errorf("%w: symbol %d has code length %d",
+				ErrCorrupt, sym, n)
+		}
+		c.count[n]++
+	}
+	c.count[0] = 0
+
+	// Check that the code isn't over-subscribed.
+	left := 1
+	for n := 1; n <= MaxBits; n++ {
+		left = 2*left - c.count[n]
+		if left < 0 {
+			return nil, fmt.Errorf("%w: code lengths are over-subscribed",
+				ErrCorrupt)
+		}
+	}
+
+	// Assign codes in order of length, then symbol.
+	next := [MaxBits + 2]uint32{ }
+	for n := 1; n <= MaxBits; n++ {
+		next[n + 1] = (next[n] + uint32(c.count[n])) << 1
+	}
+	offsets := [MaxBits + 2]int{ }
+	for n := 1; n <= MaxBits; n++ {
+		offsets[n + 1] = offsets[n] + c.count[n]
+	}
+	c.symbols = make([]int, offsets[MaxBits + 1])
+	for sym, n := range lengths {
+		if n == 0 { continue }
+		c.codes[sym] = next[n]
+		next[n]++
+		c.symbols[offsets[n]] = sym
+		offsets[n]++
+	}
+
+	return c, nil
+}
+
+// Write writes the code for sym to w.
+func (c *Code) Write(w *bit.StreamWriter, sym int) {
+	n, code := int(c.lengths[sym]), c.codes[sym]
+	for i := n - 1; i >= 0; i-- {
+		w.Write(uint64(code >> uint(i)) & 1, 1)
+	}
+}
+
+// Read reads a single symbol from r.
+func (c *Code) Read(r *bit.StreamReader) (int, error) {
+	code, first, index := 0, 0, 0
+	for n := 1; n <= MaxBits; n++ {
+		b, err := r.ReadBit()
+		if err != nil { return -1, err }
+		code |= int(b)
+
+		count := c.count[n]
+		if code - first < count { return c.symbols[index + code - first], nil }
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	return -1, fmt.Errorf("%w: invalid code", ErrCorrupt)
+}
@@ -0,0 +1,75 @@
+package huffman
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+
+	"github.com/phil-mansfield/minnow/go/bit"
+)
+
+func TestLengths(t *testing.T) {
+	tests := []struct{
+		freqs []uint64
+		lengths []uint8
+	} {
+		{ []uint64{ }, []uint8{ } },
+		{ []uint64{ 0, 5, 0 }, []uint8{ 0, 1, 0 } },
+		{ []uint64{ 1, 1 }, []uint8{ 1, 1 } },
+		{ []uint64{ 8, 4, 2, 1, 1 }, []uint8{ 1, 2, 3, 4, 4 } },
+		{ []uint64{ 1, 1, 1, 1 }, []uint8{ 2, 2, 2, 2 } },
+	}
+
+	for i := range tests {
+		lengths := Lengths(tests[i].freqs)
+		if !uint8sEq(lengths, tests[i].lengths) {
+			t.Errorf("%d) Expected lengths %d, got %d.",
+				i, tests[i].lengths, lengths)
+		}
+	}
+
+	// Fibonacci frequencies give the deepest possible trees.
+	freqs := make([]uint64, 40)
+	freqs[0], freqs[1] = 1, 1
+	for i := 2; i < len(freqs); i++ { freqs[i] = freqs[i-1] + freqs[i-2] }
+	for _, n := range Lengths(freqs) {
+		if n > MaxBits || n == 0 {
+			t.Errorf("Fibonacci code has length %d.", n)
+		}
+	}
+}
+
+func TestCode(t *testing.T) {
+	syms := make([]int, 10000)
+	freqs := make([]uint64, 100)
+	for i := range syms {
+		syms[i] = int(rand.ExpFloat64() * 5) % len(freqs)
+		freqs[syms[i]]++
+	}
+
+	c, err := NewCode(Lengths(freqs))
+	if err != nil { t.Fatal(err) }
+
+	w := &bit.StreamWriter{ }
+	for _, sym := range syms { c.Write(w, sym) }
+	r := bit.NewStreamReader(w.Bytes())
+	for i := range syms {
+		sym, err := c.Read(r)
+		if err != nil { t.Fatal(err) }
+		if sym != syms[i] {
+			t.Fatalf("%d) Expected symbol %d, got %d.", i, syms[i], sym)
+		}
+	}
+
+	if _, err := NewCode([]uint8{ 1, 1, 1 }); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for over-subscribed code, got %v.", err)
+	}
+}
+
+func uint8sEq(x, y []uint8) bool {
+	if len(x) != len(y) { return false }
+	for i := range x {
+		if x[i] != y[i] { return false }
+	}
+	return true
+}
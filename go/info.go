@@ -0,0 +1,153 @@
+package minnow
+
+// GroupInfo describes the layout of a group within a minnow file. It's
+// returned by Reader.Groups and is only a copy, so changing it does not
+// change the Reader.
+type GroupInfo struct {
+	// Type is the group type, e.g. IntGroup.
+	Type int64
+	// The group holds blocks [StartBlock, StartBlock + Blocks).
+	StartBlock, Blocks int
+	// N is the number of elements in each block or VariableLength. It's
+	// VariableLength for user-defined groups.
+	N int
+	// Lengths is the number of elements in each block.
+	Lengths []int
+	// Offsets is the byte offset of each block from the start of the file
+	// and Sizes is its encoded size in bytes.
+	Offsets, Sizes []int64
+
+	// Bits is the number of bits used to pack each value in each block.
+	// It's set for IntGroup, FloatGroup, DeltaIntGroup, BytesGroup (for
+	// element lengths), BoolGroup, BitmaskGroup, and vector groups.
+	Bits []int64
+	// Mins is the value subtracted from each value in each block before
+	// packing. It's set for IntGroup, FloatGroup, EntropyIntGroup, and
+	// EntropyFloatGroup, and vector groups. For float groups, it's in units
+	// of the quantization cells.
+	//
+	// Vector groups pack each component separately, so they have three Bits
+	// and Mins per block: component k of block i is at index 3*i + k.
+	Mins []int64
+
+	// Quantization is set for FloatGroup and EntropyFloatGroup, which have
+	// one, and vector groups, which have one per component.
+	Quantization []Quantization
+}
+
+// Quantization describes how a float group or one component of a vector
+// group is quantized. Values are stored as the index of the cell they fall in,
+// where the range [Low, High) is split into Pixels cells. If Log is set, the
+// range is in log10 of the values. Dequantization is the method stored in the
+// file, not the one set by Reader.SetDequantization.
+type Quantization struct {
+	Low, High float64
+	Pixels int64
+	Periodic, Log bool
+	Dequantization Dequantization
+}
+
+// describer is implemented by groups which can describe their own layout
+// beyond what's available through the group interface.
+type describer interface {
+	// describe fills in the fields of info which depend on the group type.
+	describe(info *GroupInfo)
+}
+
+// HeaderCount returns the number of headers in the file.
+func (rd *Reader) HeaderCount() int {
+	return rd.headers
+}
+
+// Groups returns descriptions of every group in the file, in the order
+// they were written.
+func (rd *Reader) Groups() []GroupInfo {
+	infos := make([]GroupInfo, rd.groups)
+	for i := range infos { infos[i].Type = rd.groupTypes[i] }
+	for b := 0; b < rd.blocks; b++ {
+		i := rd.blockIndex[b]
+		g, info := rd.readers[i], &infos[i]
+		info.Blocks++
+		info.Lengths = append(info.Lengths, g.length(b))
+		info.Offsets = append(info.Offsets,
+			rd.groupOffsets[i] + g.blockOffset(b))
+		info.Sizes = append(info.Sizes, g.blockSize(b))
+	}
+
+	start := 0
+	for i := range infos {
+		infos[i].StartBlock = start
+		start += infos[i].Blocks
+		infos[i].N = VariableLength
+		if d, ok := rd.readers[i].(describer); ok { d.describe(&infos[i]) }
+	}
+	return infos
+}
+
+// quantization returns the Quantization described by the arguments.
+func quantization(low, high float64, pixels int64, flags uint8) Quantization {
+	return Quantization{
+		Low: low, High: high, Pixels: pixels,
+		Periodic: flags & floatPeriodic != 0,
+		Log: flags & floatLog != 0,
+		Dequantization: Dequantization((flags & floatModeMask) >>
+			floatModeShift),
+	}
+}
+
+func (g *fixedSizeGroup) describe(info *GroupInfo) {
+	info.N = int(g.N)
+}
+
+func (g *intGroup) describe(info *GroupInfo) {
+	info.N = int(g.N)
+	info.Bits = append([]int64{ }, g.bits...)
+	info.Mins = append([]int64{ }, g.mins...)
+}
+
+func (g *floatGroup) describe(info *GroupInfo) {
+	g.ig.(describer).describe(info)
+	info.Quantization = []Quantization{
+		quantization(float64(g.low), float64(g.high), g.pixels, g.flags),
+	}
+}
+
+func (g *entropyIntGroup) describe(info *GroupInfo) {
+	info.N = int(g.N)
+	info.Mins = append([]int64{ }, g.mins...)
+}
+
+func (g *deltaIntGroup) describe(info *GroupInfo) {
+	info.N = int(g.N)
+	info.Bits = append([]int64{ }, g.bits...)
+}
+
+func (g *losslessFloatGroup) describe(info *GroupInfo) {
+	info.N = int(g.N)
+}
+
+func (g *bytesGroup) describe(info *GroupInfo) {
+	info.N = int(g.N)
+	info.Bits = append([]int64{ }, g.bits...)
+}
+
+func (g *flagGroup) describe(info *GroupInfo) {
+	info.N = int(g.N)
+	info.Bits = make([]int64, g.blocks())
+	for i := range info.Bits { info.Bits[i] = g.bits }
+}
+
+func (g *vecGroup) describe(info *GroupInfo) {
+	info.N = int(g.comps[0].N)
+	n := int(g.blocks())
+	info.Bits, info.Mins = make([]int64, 3*n), make([]int64, 3*n)
+	for k := 0; k < 3; k++ {
+		for i := 0; i < n; i++ {
+			info.Bits[3*i + k] = g.comps[k].bits[i]
+			info.Mins[3*i + k] = g.comps[k].mins[i]
+		}
+		info.Quantization = append(info.Quantization, quantization(
+			g.low[k], g.high[k], g.pixels[k], g.flags,
+		))
+	}
+}
@@ -0,0 +1,188 @@
+package minnow
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// journalMagic is the magic number at the start of journal files.
+const journalMagic = 0xacedad10
+
+// journalHeader starts a journal file. It's followed by TailSize bytes: the
+// tail of the file at the time of the checkpoint, including its checksum. That
+// is followed by NameSize bytes: the base name of the temporary file that the
+// Writer is writing to, if it was returned by Create.
+type journalHeader struct {
+	Magic uint64
+	Header minnowHeader
+	TailSize, NameSize int64
+}
+
+// JournalFile returns the name of the journal used by a journaled Writer
+// which is writing to fname.
+func JournalFile(fname string) string { return fname + ".journal" }
+
+// Journal makes the Writer save a checkpoint to JournalFile(fname) after every
+// n blocks. Normally, blocks written by a Writer can't be read until it's
+// closed. If the program stops before then, Recover can rebuild the file from
+// the last checkpoint instead. Close removes the journal.
+//
+// A checkpoint contains a copy of the entire tail and waits for the file to
+// be written to disk, so n should be large enough that they're rare.
+// Only Writers returned by Create and OpenAppend can be journaled.
+func (wr *Writer) Journal(n int) error {
+	if wr.fname == "" {
+		return fmt.Errorf("minnow: only Writers returned by Create or " +
+			"OpenAppend can be journaled")
+	} else if n < 1 {
+		return fmt.Errorf("minnow: journal interval must be positive, not %d",
+			n)
+	}
+	wr.journalEvery, wr.sinceJournal = n, 0
+	return nil
+}
+
+// journalBlock is called after every block is added and writes a checkpoint
+// if enough blocks have been added since the last one.
+func (wr *Writer) journalBlock() error {
+	if wr.journalEvery <= 0 { return nil }
+	wr.sinceJournal++
+	if wr.sinceJournal < wr.journalEvery { return nil }
+	wr.sinceJournal = 0
+	return wr.checkpoint()
+}
+
+// checkpoint writes the tail of everything written so far to the journal.
+func (wr *Writer) checkpoint() error {
+	if err := wr.drain(); err != nil { return err }
+	tailStart, err := wr.tell()
+	if err != nil { return err }
+
+	tail := &bytes.Buffer{ }
+	hd, err := wr.encodeTail(tail, tailStart)
+	if err != nil { return err }
+
+	// The journal can't point to blocks that aren't on disk yet.
+	if s, ok := wr.f.(interface{ Sync() error }); ok {
+		if err := s.Sync(); err != nil { return err }
+	}
+
+	// The old journal is replaced by renaming the new one over it, so there's
+	// always a complete checkpoint on disk.
+	jname := JournalFile(wr.fname)
+	f, err := os.Create(jname + ".tmp")
+	if err != nil { return err }
+	tmpName := ""
+	if wr.tmpName != "" { tmpName = filepath.Base(wr.tmpName) }
+	jh := journalHeader{
+		journalMagic, hd, int64(tail.Len()), int64(len(tmpName)),
+	}
+	err = binaryWrite(f, jh)
+	if err == nil { _, err = f.Write(tail.Bytes()) }
+	if err == nil { _, err = f.Write([]byte(tmpName)) }
+	if err == nil { err = f.Sync() }
+	if cerr := f.Close(); err == nil { err = cerr }
+	if err != nil {
+		os.Remove(jname + ".tmp")
+		return err
+	}
+	return os.Rename(jname + ".tmp", jname)
+}
+
+// Recover rebuilds fname from the last checkpoint in its journal after a
+// journaled Writer stopped without being closed. Blocks and headers added after
+// the checkpoint are lost. If the Writer was returned by Create, the file is
+// recovered from the temporary file named in the journal and then renamed to
+// fname. If the file already has a tail which is at least as new as the
+// checkpoint, e.g. because the Writer stopped after writing it, its contents
+// are left as they are. The journal is removed once fname is valid.
+func Recover(fname string) error {
+	jname := JournalFile(fname)
+	jh, tail, tmpName, err := readJournal(jname)
+	if err != nil { return err }
+
+	src := fname
+	if tmpName != "" {
+		tmpName = filepath.Join(filepath.Dir(fname), tmpName)
+		if _, err := os.Stat(tmpName); err == nil { src = tmpName }
+	}
+
+	f, err := os.OpenFile(src, os.O_RDWR, 0)
+	if err != nil { return err }
+
+	err = recoverFile(f, src, jh, tail)
+	if cerr := f.Close(); err == nil { err = cerr }
+	if err != nil { return err }
+
+	if src != fname {
+		if err := os.Rename(src, fname); err != nil { return err }
+	}
+	return os.Remove(jname)
+}
+
+// recoverFile writes tail and the minnowHeader in jh to f, unless f already
+// has a newer tail.
+func recoverFile(
+	f *os.File, fname string, jh journalHeader, tail []byte,
+) error {
+	old := minnowHeader{ }
+	err := binaryRead(io.NewSectionReader(f, 0, math.MaxInt64), &old)
+	if err == nil && old.Magic == Magic &&
+		old.TailStart >= jh.Header.TailStart {
+		if _, err := newReader(f, fname); err == nil { return nil }
+	}
+
+	info, err := f.Stat()
+	if err != nil { return err }
+	if info.Size() < jh.Header.TailStart {
+		return fmt.Errorf("%w: %s is %d bytes long, but its journal has a " +
+			"checkpoint at byte %d", ErrTruncated, fname, info.Size(),
+			jh.Header.TailStart)
+	}
+
+	// Write the tail first, so the header never points to an incomplete one.
+	if _, err := f.WriteAt(tail, jh.Header.TailStart); err != nil {
+		return err
+	}
+	end := jh.Header.TailStart + int64(len(tail))
+	if err := f.Truncate(end); err != nil { return err }
+	if err := f.Sync(); err != nil { return err }
+
+	hd := &bytes.Buffer{ }
+	if err := binaryWrite(hd, jh.Header); err != nil { return err }
+	if _, err := f.WriteAt(hd.Bytes(), 0); err != nil { return err }
+	if err := f.Sync(); err != nil { return err }
+
+	rd, err := newReader(f, fname)
+	if err != nil { return err }
+	return rd.Verify()
+}
+
+// readJournal reads the journal file jname and returns its header, its tail,
+// and the name of the temporary file in it.
+func readJournal(jname string) (journalHeader, []byte, string, error) {
+	jh := journalHeader{ }
+	data, err := ioutil.ReadFile(jname)
+	if err != nil { return jh, nil, "", err }
+
+	r := bytes.NewReader(data)
+	if err := binaryRead(r, &jh); err != nil {
+		return jh, nil, "", fmt.Errorf("%s: %w", jname, err)
+	} else if jh.Magic != journalMagic {
+		return jh, nil, "", fmt.Errorf("%w: %s has magic number %x, not %x",
+			ErrNotMinnow, jname, jh.Magic, journalMagic)
+	} else if jh.TailSize < 0 || jh.NameSize < 0 ||
+		jh.TailSize + jh.NameSize != int64(r.Len()) {
+		return jh, nil, "", fmt.Errorf("%w: %s should have %d bytes after " +
+			"its header, but has %d", ErrTruncated, jname,
+			jh.TailSize + jh.NameSize, r.Len())
+	}
+	start := int64(len(data) - r.Len())
+	tail := data[start:start + jh.TailSize]
+	return jh, tail, string(data[start + jh.TailSize:]), nil
+}
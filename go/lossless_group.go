@@ -0,0 +1,154 @@
+package minnow
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/phil-mansfield/minnow/go/lz"
+)
+
+////////////////////////
+// LosslessFloatGroup //
+////////////////////////
+
+// losslessFloatGroup stores float64s or float32s bit-exactly. Each value is
+// XORed with the previous one, which zeroes the sign, exponent and leading
+// mantissa bits shared by neighbors. The bytes are then shuffled so that the
+// ith byte of every value is stored together, making those zeros contiguous,
+// and the result is LZ compressed.
+type losslessFloatGroup struct {
+	blockIndex
+	blockLengths
+	width int // Bytes per value.
+	gt int64
+
+	words []uint64 // Only used by writeData.
+	buf, comp []byte
+}
+
+func newLosslessFloatGroup(startBlock, N int, gt int64) *losslessFloatGroup {
+	return &losslessFloatGroup{
+		blockIndex: *newBlockIndex(startBlock),
+		blockLengths: blockLengths{ N: int64(N) },
+		width: losslessWidth(gt), gt: gt,
+	}
+}
+
+func newLosslessFloatGroupFromTail(
+	f io.Reader, gt int64,
+) (*losslessFloatGroup, error) {
+	g := &losslessFloatGroup{ width: losslessWidth(gt), gt: gt }
+	var startBlock, blocks int64
+	for _, x := range []*int64{ &g.N, &startBlock, &blocks } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+	if err := checkBlocks(f, blocks); err != nil { return nil, err }
+	if err := g.readLengths(f, blocks); err != nil { return nil, err }
+
+	if err := checkCount(f, blocks, 8); err != nil { return nil, err }
+	sizes := make([]int64, blocks)
+	if err := binaryRead(f, sizes); err != nil { return nil, err }
+	g.blockIndex = *newBlockIndex(int(startBlock))
+	for i := range sizes { g.addBlock(sizes[i]) }
+
+	return g, nil
+}
+
+func losslessWidth(gt int64) int {
+	if gt == LosslessFloat32Group { return 4 }
+	return 8
+}
+
+func (g *losslessFloatGroup) writeTail(f io.Writer) error {
+	for _, x := range []int64{ g.N, g.startBlock, g.blocks() } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	if err := g.writeLengths(f); err != nil { return err }
+	sizes := make([]int64, g.blocks())
+	for i := range sizes { sizes[i] = g.blockSize(i + int(g.startBlock)) }
+	return binaryWrite(f, sizes)
+}
+
+func (g *losslessFloatGroup) groupType() int64 {
+	return g.gt
+}
+
+func (g *losslessFloatGroup) length(b int) int {
+	return g.blockLen(b - int(g.startBlock))
+}
+
+func (g *losslessFloatGroup) encoder() group {
+	return newLosslessFloatGroup(0, int(g.N), g.gt)
+}
+
+func (g *losslessFloatGroup) appendBlock(enc group) {
+	e := enc.(*losslessFloatGroup)
+	g.appendIndex(&e.blockIndex)
+	g.appendLengths(&e.blockLengths)
+}
+
+func (g *losslessFloatGroup) writeData(f io.Writer, x interface{}) error {
+	n := sliceLen(x)
+	if err := g.addLen(n); err != nil { return err }
+
+	g.words = resizeUint64(g.words, n)
+	switch data := x.(type) {
+	case []float64:
+		for i := range data { g.words[i] = math.Float64bits(data[i]) }
+	case []float32:
+		for i := range data { g.words[i] = uint64(math.Float32bits(data[i])) }
+	}
+
+	for i := len(g.words) - 1; i > 0; i-- { g.words[i] ^= g.words[i-1] }
+
+	if len(g.buf) < g.width*n { g.buf = make([]byte, g.width*n) }
+	shuffle(g.words, g.width, g.buf)
+
+	g.comp = lz.Compress(g.comp[:0], g.buf[:g.width*n])
+	if _, err := f.Write(g.comp); err != nil { return err }
+	g.addBlock(int64(len(g.comp)))
+	return nil
+}
+
+func (g *losslessFloatGroup) readData(data []byte, b int, x interface{}) error {
+	n := g.length(b)
+	buf := getBytes(g.width*n)
+	defer putBytes(buf)
+	if err := lz.Decompress(*buf, data); err != nil {
+		return fmt.Errorf("minnow: block %d: %w", b, err)
+	}
+
+	words := getUint64s(n)
+	defer putUint64s(words)
+	unshuffle(*buf, g.width, *words)
+	for i := 1; i < len(*words); i++ { (*words)[i] ^= (*words)[i-1] }
+
+	switch out := x.(type) {
+	case []float64:
+		for i, w := range *words { out[i] = math.Float64frombits(w) }
+	case []float32:
+		for i, w := range *words { out[i] = math.Float32frombits(uint32(w)) }
+	}
+	return nil
+}
+
+// shuffle writes the lowest width bytes of each element of x into buf so that
+// the kth bytes of every element are next to one another.
+func shuffle(x []uint64, width int, buf []byte) {
+	tmp := [8]byte{ }
+	for i := range x {
+		binary.LittleEndian.PutUint64(tmp[:], x[i])
+		for k := 0; k < width; k++ { buf[k*len(x) + i] = tmp[k] }
+	}
+}
+
+// unshuffle inverts shuffle.
+func unshuffle(buf []byte, width int, x []uint64) {
+	tmp := [8]byte{ }
+	for i := range x {
+		for k := 0; k < width; k++ { tmp[k] = buf[k*len(x) + i] }
+		x[i] = binary.LittleEndian.Uint64(tmp[:])
+	}
+}
@@ -0,0 +1,131 @@
+/*package lz implements a small LZ77 compressor. It favors simplicity over
+compression ratio and is intended to be run on data that has already been
+transformed so that it contains long runs and repeated byte sequences.
+
+Compressed data is a sequence of (literals, match) pairs. Each pair is written
+as the number of literals, the literal bytes, the length of the match, and the
+distance back to the start of the match, with all integers stored as
+uvarints. The final pair has a match length of zero and no distance.*/
+package lz
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const (
+	minMatch = 4
+	hashBits = 14
+	maxOffset = 1 << 20
+)
+
+// ErrCorrupt is returned when compressed data cannot be decoded.
+var ErrCorrupt = errors.New("lz: corrupt data")
+
+// Compress appends the compressed form of src to dst and returns the result.
+func Compress(dst, src []byte) []byte {
+	// table maps hashes to one plus the last position they occurred at.
+	table := make([]int32, 1 << hashBits)
+
+	anchor, i := 0, 0
+	for i + minMatch <= len(src) {
+		h := hash(src[i:])
+		cand := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if cand < 0 || i - cand > maxOffset ||
+			load32(src[cand:]) != load32(src[i:]) {
+			i++
+			continue
+		}
+
+		n := minMatch
+		for i + n < len(src) && src[cand + n] == src[i + n] { n++ }
+
+		dst = appendUvarint(dst, uint64(i - anchor))
+		dst = append(dst, src[anchor:i]...)
+		dst = appendUvarint(dst, uint64(n))
+		dst = appendUvarint(dst, uint64(i - cand))
+
+		i += n
+		anchor = i
+	}
+
+	dst = appendUvarint(dst, uint64(len(src) - anchor))
+	dst = append(dst, src[anchor:]...)
+	return appendUvarint(dst, 0)
+}
+
+// Decompress decompresses src into dst, which must have exactly the length of
+// the original data.
+func Decompress(dst, src []byte) error {
+	pos := 0
+	for {
+		lits, n := binary.Uvarint(src)
+		if n <= 0 || lits > uint64(len(src) - n) ||
+			lits > uint64(len(dst) - pos) {
+			return ErrCorrupt
+		}
+		src = src[n:]
+		pos += copy(dst[pos:], src[:lits])
+		src = src[lits:]
+
+		length, n := binary.Uvarint(src)
+		if n <= 0 || length > uint64(len(dst) - pos) { return ErrCorrupt }
+		src = src[n:]
+		if length == 0 { break }
+
+		offset, n := binary.Uvarint(src)
+		if n <= 0 || offset == 0 || offset > uint64(pos) { return ErrCorrupt }
+		src = src[n:]
+
+		// Matches may overlap the bytes they produce, so copy one byte at a
+		// time.
+		from := pos - int(offset)
+		for i := 0; i < int(length); i++ { dst[pos + i] = dst[from + i] }
+		pos += int(length)
+	}
+
+	if len(src) != 0 || pos != len(dst) { return ErrCorrupt }
+	return nil
+}
+
+// DecompressedLen returns the length of the data that src decompresses to
+// without decompressing it, so callers can check it before allocating dst.
+// A nil error does not mean that Decompress will succeed.
+func DecompressedLen(src []byte) (uint64, error) {
+	total := uint64(0)
+	for {
+		lits, n := binary.Uvarint(src)
+		if n <= 0 || lits > uint64(len(src) - n) { return 0, ErrCorrupt }
+		src = src[n + int(lits):]
+		total += lits
+
+		length, n := binary.Uvarint(src)
+		if n <= 0 || length > math.MaxUint64 - total { return 0, ErrCorrupt }
+		src = src[n:]
+		if length == 0 { break }
+		total += length
+
+		if _, n = binary.Uvarint(src); n <= 0 { return 0, ErrCorrupt }
+		src = src[n:]
+	}
+
+	if len(src) != 0 { return 0, ErrCorrupt }
+	return total, nil
+}
+
+func load32(b []byte) uint32 {
+	return binary.LittleEndian.Uint32(b)
+}
+
+func hash(b []byte) uint32 {
+	return (load32(b) * 2654435761) >> (32 - hashBits)
+}
+
+func appendUvarint(dst []byte, x uint64) []byte {
+	buf := [binary.MaxVarintLen64]byte{ }
+	n := binary.PutUvarint(buf[:], x)
+	return append(dst, buf[:n]...)
+}
@@ -0,0 +1,70 @@
+package lz
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	random := make([]byte, 5000)
+	rand.Read(random)
+	repeated := bytes.Repeat([]byte("meow meow purr "), 300)
+	mixed := append(append([]byte{ }, random[:100]...), make([]byte, 3000)...)
+	mixed = append(mixed, random[:100]...)
+
+	tests := [][]byte{
+		{ }, { 1 }, { 1, 2, 3, 4, 5 }, make([]byte, 10000),
+		random, repeated, mixed,
+	}
+
+	for i, src := range tests {
+		comp := Compress(nil, src)
+		out := make([]byte, len(src))
+		if err := Decompress(out, comp); err != nil {
+			t.Fatalf("%d) %s", i, err.Error())
+		}
+		if !bytes.Equal(out, src) {
+			t.Errorf("%d) Decompressed data does not match.", i)
+		}
+		if n, err := DecompressedLen(comp); err != nil || n != uint64(len(src)) {
+			t.Errorf("%d) Expected DecompressedLen = %d, got %d and %v.",
+				i, len(src), n, err)
+		}
+	}
+
+	if comp := Compress(nil, make([]byte, 10000)); len(comp) > 20 {
+		t.Errorf("Zeros compressed to %d bytes.", len(comp))
+	}
+	if comp := Compress(nil, repeated); len(comp) > len(repeated) / 10 {
+		t.Errorf("Repeated text compressed to %d bytes.", len(comp))
+	}
+}
+
+func TestCorrupt(t *testing.T) {
+	src := bytes.Repeat([]byte("meow"), 100)
+	comp := Compress(nil, src)
+	tests := [][]byte{
+		{ }, comp[:len(comp) - 1], append(append([]byte{ }, comp...), 0),
+		{ 0, 5, 1 }, { 10, 1, 2 },
+	}
+	for i := range tests {
+		err := Decompress(make([]byte, len(src)), tests[i])
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%d) Expected ErrCorrupt, got %v.", i, err)
+		}
+	}
+
+	// A match can't make the decompressed length overflow.
+	huge := appendUvarint([]byte{ 1, 'a' }, math.MaxUint64)
+	if _, err := DecompressedLen(append(huge, 1, 0, 0));
+		!errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for an overflowing length, got %v.", err)
+	}
+	if err := Decompress(make([]byte, len(src) + 1), comp);
+		!errors.Is(err, ErrCorrupt) {
+		t.Errorf("Expected ErrCorrupt for a long buffer, got %v.", err)
+	}
+}
@@ -2,6 +2,7 @@ package minh
 
 import (
 	"fmt"
+	"io"
 	"strings"
 	
 	minnow "github.com/phil-mansfield/minnow/go"
@@ -22,21 +23,50 @@ type BoundaryWriter struct {
 	cellBuf []int
 }
 
-func CreateBoundary(fname string) *BoundaryWriter {
+// CreateBoundary creates a new boundary minh file and returns a corresponding
+// BoundaryWriter. The file doesn't appear at fname until Close succeeds.
+func CreateBoundary(fname string) (*BoundaryWriter, error) {
+	f, err := minnow.Create(fname)
+	if err != nil { return nil, err }
 	wr := &BoundaryWriter{ }
-	wr.create(fname, boundaryFileType)
+	if err := wr.init(f, boundaryFileType); err != nil { return nil, err }
+	return wr, nil
+}
+
+// NewBoundaryWriter returns a BoundaryWriter which writes a boundary minh file
+// to f. Closing the BoundaryWriter does not close f.
+func NewBoundaryWriter(f io.WriteSeeker) (*BoundaryWriter, error) {
+	mf, err := minnow.NewWriter(f)
+	if err != nil { return nil, err }
+	wr := &BoundaryWriter{ }
+	if err := wr.init(mf, boundaryFileType); err != nil { return nil, err }
+	return wr, nil
+}
+
+// MustCreateBoundary is the same as CreateBoundary, but panics on errors.
+func MustCreateBoundary(fname string) *BoundaryWriter {
+	wr, err := CreateBoundary(fname)
+	if err != nil { panic(err.Error()) }
 	return wr
 }
 
-func (minh *BoundaryWriter) Header(text string) {
-	minh.f.Header([]byte(text))
+// Header writes the text header of the original catalogue to the file.
+func (minh *BoundaryWriter) Header(text string) error {
+	_, err := minh.f.NamedHeader(headerNames[0], []byte(text))
+	return err
 }
 
-func (minh *BoundaryWriter) Block(cols []interface{}) {
-	panic("Block() cannot be called for BoundaryWriter. Use")
+// Block cannot be called for a BoundaryWriter and always returns an error.
+// Use Coordinates and Column instead.
+func (minh *BoundaryWriter) Block(cols []interface{}) error {
+	return fmt.Errorf("Block() cannot be called for BoundaryWriter. Use " +
+		"Coordinates() and Column() instead.")
 }
 
-func (minh *BoundaryWriter) Coordinates(x, y, z []float32) {
+// Coordinates splits the file into cells and boundary regions based on the
+// given coordinates and writes the "boundary" column. It must be called before
+// Column.
+func (minh *BoundaryWriter) Coordinates(x, y, z []float32) error {
 	minh.scaledBoundary = minh.boundary / (minh.l / float32(minh.cells))
 	minh.cellBuf = make([]int, 8)
 
@@ -46,27 +76,27 @@ func (minh *BoundaryWriter) Coordinates(x, y, z []float32) {
 
 	minh.cellIndex = indices
 
-	minh.boundaryColumn(boundaryFlag)
+	return minh.boundaryColumn(boundaryFlag)
 }
 
 // indices returns the indices of the points in each cell+boundary region
 // as well as the boundary flags for each region.
 func (minh *BoundaryWriter) indices(
 	coord [3][]float32, sizes []int,
-) (indices [][]int, boundaryFlag [][]int8) {
+) (indices [][]int, boundaryFlag [][]bool) {
 	c := minh.cells
 	dx := minh.l / float32(c)
 
 	// Initialize buffers
-	indices, boundaryFlag = make([][]int, c*c*c), make([][]int8, c*c*c)
+	indices, boundaryFlag = make([][]int, c*c*c), make([][]bool, c*c*c)
 	curr := make([]int, c*c*c)
 	for i := range indices { 
 		indices[i] = make([]int, sizes[i])
-		boundaryFlag[i] = make([]int8, sizes[i])
+		boundaryFlag[i] = make([]bool, sizes[i])
 	}
 
 	// set boundaryFlag and index.
-	update := func(g, i int, flag int8) {
+	update := func(g, i int, flag bool) {
 		indices[g][curr[g]] = i
 		boundaryFlag[g][curr[g]] = flag
 		curr[g]++
@@ -78,8 +108,8 @@ func (minh *BoundaryWriter) indices(
 		for k := 0; k < 3; k++ { vec[k] = coord[k][i] / dx }
 		idx, reg := minh.idxReg(vec)
 		gs := minh.hostCells(idx, reg)
-		update(gs[0], i, 0)
-		for _, g := range gs[1:] { update(g, i, 1) }
+		update(gs[0], i, false)
+		for _, g := range gs[1:] { update(g, i, true) }
 	}
 
 	return indices, boundaryFlag
@@ -181,76 +211,108 @@ func (minh *BoundaryWriter) region(ix int, x float32) int {
 
 // Column writes a column with the given name, type information, and data
 // to the BoundaryWriter. This column is split up into cells and boundaries.
-func (minh *BoundaryWriter) Column(name string, col Column, x interface{}) {
+func (minh *BoundaryWriter) Column(
+	name string, col Column, x interface{},
+) error {
+	if err := minnow.TypeMatch(x, col.Type); err != nil {
+		return fmt.Errorf("column '%s': %w", name, err)
+	}
+
 	minh.cols = append(minh.cols, col)
 	minh.names = append(minh.names, name)
 	
+	// Each cell has a different number of points, so the whole column is
+	// written as a single group with variable-length blocks.
+	N, lim := minnow.VariableLength, [2]float32{ col.Low, col.High }
+	var err error
+	switch col.Type {
+	case Int64: err = minh.f.FixedSizeGroup(minnow.Int64Group, N)
+	case Int: err = minh.f.IntGroup(N)
+	case EntropyInt: err = minh.f.EntropyIntGroup(N)
+	case DeltaInt: err = minh.f.DeltaIntGroup(N)
+	case Float32: err = minh.f.FixedSizeGroup(minnow.Float32Group, N)
+	case LosslessFloat32:
+		err = minh.f.LosslessFloatGroup(minnow.LosslessFloat32Group, N)
+	case Float:
+		err = minh.f.FloatGroup(N, lim, col.Dx, floatOptions(col)...)
+	case EntropyFloat:
+		err = minh.f.EntropyFloatGroup(N, lim, col.Dx, floatOptions(col)...)
+	case Bytes: err = minh.f.BytesGroup(N)
+	case Bool: err = minh.f.BoolGroup(N)
+	case Bitmask: err = minh.f.BitmaskGroup(N, int(col.Bits))
+	default:
+		return fmt.Errorf("%w: can't write column with type flag %d",
+			minnow.ErrUnknownGroup, col.Type)
+	}
+	if err != nil { return fmt.Errorf("column '%s': %w", name, err) }
+
 	c := minh.cells
 
 	for i := 0; i < c*c*c; i++ {
 		idx := minh.cellIndex[i]
 		N := len(idx)
 
-		switch col.Type {
-		case Int64, Int:
+		switch x := x.(type) {
+		case []int64:
 			minh.i64Buf = expandInt64(minh.i64Buf, N)
 			buf := minh.i64Buf
-			ix := x.([]int64)
-			for j := range idx { buf[j] = ix[idx[j]] }
-
-			if col.Type == Int64 {
-				minh.f.FixedSizeGroup(minnow.Int64Group, N)
-			} else {
-				minh.f.IntGroup(N)
-			}
-			minh.f.Data(minh.i64Buf)
-		case Float32, Float:
+			for j := range idx { buf[j] = x[idx[j]] }
+			_, err = minh.f.Data(buf)
+		case []float32:
 			minh.f32Buf = expandFloat32(minh.f32Buf, N)
 			buf := minh.f32Buf
-			fx := x.([]float32)
-			for j := range idx { buf[j] = fx[idx[j]] }
-
-			if col.Type == Float32 {
-				minh.f.FixedSizeGroup(minnow.Float32Group, N)
-			} else {
-				lim := [2]float32{ col.Low, col.High }
-				minh.f.FloatGroup(N, lim, col.Dx)
-				processFloatGroup(minh.f32Buf, col)
-			}
-			minh.f.Data(minh.f32Buf)
-		default:
-			panic(fmt.Sprintf("Can't write column with type flag %d", col.Type))
+			for j := range idx { buf[j] = x[idx[j]] }
+			_, err = minh.f.Data(buf)
+		case []string:
+			buf := make([]string, N)
+			for j := range idx { buf[j] = x[idx[j]] }
+			_, err = minh.f.Data(buf)
+		case [][]byte:
+			buf := make([][]byte, N)
+			for j := range idx { buf[j] = x[idx[j]] }
+			_, err = minh.f.Data(buf)
+		case []bool:
+			buf := make([]bool, N)
+			for j := range idx { buf[j] = x[idx[j]] }
+			_, err = minh.f.Data(buf)
+		case []uint64:
+			buf := make([]uint64, N)
+			for j := range idx { buf[j] = x[idx[j]] }
+			_, err = minh.f.Data(buf)
 		}
-	}	
+		if err != nil { return fmt.Errorf("column '%s': %w", name, err) }
+	}
+
+	return nil
 }
 
-func (minh *BoundaryWriter) boundaryColumn(boundaryFlag [][]int8) {
-	minh.cols = append(minh.cols, Column{ Type: Int })
+func (minh *BoundaryWriter) boundaryColumn(boundaryFlag [][]bool) error {
+	minh.cols = append(minh.cols, Column{ Type: Bool })
 	minh.names = append(minh.names, "boundary")
 
 	c := minh.cells
 
+	if err := minh.f.BoolGroup(minnow.VariableLength); err != nil { return err }
 	for i := 0; i < c*c*c; i++ {
-		N := len(boundaryFlag[i])
-		minh.i64Buf = expandInt64(minh.i64Buf, N)
-		for j := range boundaryFlag[i] { 
-			minh.i64Buf[j] = int64(boundaryFlag[i][j])
-		}
-		minh.f.IntGroup(N)
-		minh.f.Data(minh.i64Buf)
-
-		minh.blockSizes = append(minh.blockSizes, int64(N))
+		if _, err := minh.f.Data(boundaryFlag[i]); err != nil { return err }
+		minh.blockSizes = append(minh.blockSizes, int64(len(boundaryFlag[i])))
 	}
 
 	minh.blocks = len(boundaryFlag)
+	return nil
 }
 
-// Close finalizes and closes the BoundaryWriter.
-func (minh *BoundaryWriter) Close() {
-	minh.f.Header([]byte(strings.Join(minh.names, "$")))
-	minh.f.Header(minh.cols)
-	minh.f.Header(geometry{ minh.l, minh.boundary, int64(minh.cells) })
-	minh.f.Header(int64(minh.blocks))
-	minh.f.Header(minh.blockSizes)
-	minh.f.Close()
+// Close finalizes and closes the BoundaryWriter. If the headers can't be
+// written, the file is aborted.
+func (minh *BoundaryWriter) Close() error {
+	hds := []interface{}{
+		[]byte(strings.Join(minh.names, "$")), minh.cols,
+		geometry{ minh.l, minh.boundary, int64(minh.cells) },
+		int64(minh.blocks), minh.blockSizes,
+	}
+	if err := writeHeaders(minh.f, headerNames[1:], hds); err != nil {
+		minh.f.Abort()
+		return err
+	}
+	return minh.f.Close()
 }
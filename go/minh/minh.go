@@ -1,7 +1,12 @@
 package minh
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"math"
@@ -14,7 +19,23 @@ import (
 
 const (
 	Magic = 0xbaff1ed
-	Version = 0
+	// Version is the version of the minh headers written by Writer. Readers
+	// can read any version from MinVersion to Version.
+	//
+	// Version history:
+	//   0 - Initial format.
+	//   1 - Log columns are log-scaled by minnow float groups.
+	//   2 - The boundary column of boundary files is a Bool column.
+	//   3 - Basic files store each column in a single group.
+	Version = 3
+	MinVersion = 0
+)
+
+var (
+	// ErrNotMinh is returned when a minnow file is not a minh file.
+	ErrNotMinh = errors.New("minh: not a minh file")
+	// ErrColumnName is returned when a column name is not in the file.
+	ErrColumnName = errors.New("minh: unknown column name")
 )
 
 const (
@@ -35,6 +56,14 @@ const (
 	Float32
 	Int
 	Float
+	EntropyInt
+	EntropyFloat
+	DeltaInt
+	LosslessFloat64
+	LosslessFloat32
+	Bytes
+	Bool
+	Bitmask
 )
 
 type Writer struct {
@@ -42,16 +71,23 @@ type Writer struct {
 	blocks int
 	cols []Column
 	blockSizes []int64
-	buf []float32
 	l, boundary float32
 	cells int
+	// colFiles are temporary minnow files, named colNames, which the blocks
+	// of each column are streamed into until Close copies them to f. If f
+	// wasn't opened by Create, they're kept in the temporary directory colDir.
+	colFiles []*minnow.Writer
+	colNames []string
+	colDir string
 }
 
 type Column struct {
 	Type int64
 	Log int32
 	Low, High, Dx float32
-	Buffer [232]byte
+	// Bits is the number of bits in each element of a Bitmask column.
+	Bits int32
+	Buffer [228]byte
 }
 
 func (c Column) String() string {
@@ -69,90 +105,252 @@ type geometry struct {
 	Cells int64
 }
 
-func Create(fname string) *Writer {
+// Create creates a new minh file and returns a corresponding Writer. As with
+// minnow.Create, the file doesn't appear at fname until Close succeeds. Until
+// then, each column is written to its own temporary file next to it.
+func Create(fname string) (*Writer, error) {
+	f, err := minnow.Create(fname)
+	if err != nil { return nil, err }
+	wr := &Writer{ }
+	if err := wr.init(f, basicFileType); err != nil { return nil, err }
+	return wr, nil
+}
+
+// NewWriter returns a Writer which writes a minh file to f. Closing the Writer
+// does not close f. Until the Writer is closed, each column is written to its
+// own file in a new directory under os.TempDir.
+func NewWriter(f io.WriteSeeker) (*Writer, error) {
+	mf, err := minnow.NewWriter(f)
+	if err != nil { return nil, err }
 	wr := &Writer{ }
-	wr.create(fname, basicFileType)
+	if err := wr.init(mf, basicFileType); err != nil { return nil, err }
+	return wr, nil
+}
+
+// MustCreate is the same as Create, but panics on errors.
+func MustCreate(fname string) *Writer {
+	wr, err := Create(fname)
+	if err != nil { panic(err.Error()) }
 	return wr
 }
 
-func (wr *Writer) create(fname string, fileType int64) {
+// init writes the minh header to f. f is aborted if this fails.
+func (wr *Writer) init(f *minnow.Writer, fileType int64) error {
 	if unsafe.Sizeof(Column{}) != 256 {
 		panic(fmt.Sprintf("Sizeof(Column{}) = %d, not 256. Change buffer size.",
 			unsafe.Sizeof(Column{})))
 	}
 
-	wr.f = minnow.Create(fname)
-	wr.f.Header(idHeader{ Magic, Version, fileType })
+	wr.f = f
+	_, err := wr.f.NamedHeader("minh", idHeader{ Magic, Version, fileType })
+	if err != nil { f.Abort() }
+	return err
 }
 
-func (minh *Writer) Header(names []string, text string, cols []Column) {
-	minh.f.Header([]byte(text))
-	minh.f.Header([]byte(strings.Join(names, "$")))
-	minh.f.Header(cols)
+// Header writes the column names, the text header of the original catalogue,
+// and the column types to the file.
+func (minh *Writer) Header(names []string, text string, cols []Column) error {
+	hds := []interface{}{
+		[]byte(text), []byte(strings.Join(names, "$")), cols,
+	}
+	err := writeHeaders(minh.f, headerNames[:3], hds)
+	if err != nil { return err }
 	minh.cols = cols
+	return minh.startColumns()
 }
 
 func (minh *Writer) Geometry(L, boundary float32, cells int) {
 	minh.l, minh.boundary, minh.cells = L, boundary, cells 
 }
 
-func (minh *Writer) Block(cols []interface{}) {
-	if len(cols) != len(minh.cols) {
-		panic(fmt.Sprintf("Expected %d columns, got %d.", 
-			len(minh.cols), len(cols)))
+// Block adds a block of rows to the file. cols must contain one slice per
+// column and all slices must have the same length. Each column is stored in a
+// single group, so blocks are encoded into a separate temporary file for each
+// column, and Close copies the encoded columns into the file.
+func (minh *Writer) Block(cols []interface{}) error {
+	if len(cols) != len(minh.cols) || len(cols) == 0 {
+		return fmt.Errorf("%w: expected %d columns, got %d",
+			minnow.ErrTypeMismatch, len(minh.cols), len(cols))
 	}
+	N := reflect.ValueOf(cols[0]).Len()
 	for i := range cols {
 		colType := minh.cols[i].Type
 		if err := minnow.TypeMatch(cols[i], colType); err != nil {
-			panic(fmt.Sprintf("Column %d: %s", i, err.Error()))
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+		if Ni := reflect.ValueOf(cols[i]).Len(); N != Ni {
+			return fmt.Errorf("%w: len(cols[%d]) = %d instead of %d",
+				minnow.ErrTypeMismatch, i, Ni, N)
 		}
 	}
-	
-	N := reflect.ValueOf(cols[0]).Len()
+
+	for i := range cols {
+		if _, err := minh.colFiles[i].Data(cols[i]); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
+		}
+	}
+
 	minh.blockSizes = append(minh.blockSizes, int64(N))
 	minh.blocks++
 
-	for i := range cols {
-		if Ni := reflect.ValueOf(cols[0]).Len(); N != Ni {
-			panic(fmt.Sprintf("len(cols[%d]) = %d instead of %d", Ni, i, N))
+	return nil
+}
+
+// startColumns creates a temporary minnow file for each column, containing a
+// single group that the column's blocks are written to. The files are named
+// after the temporary file that f is written to, so they're unique to this
+// Writer.
+func (minh *Writer) startColumns() error {
+	base := minh.f.TempName()
+	if base == "" {
+		dir, err := ioutil.TempDir("", "minh")
+		if err != nil { return err }
+		minh.colDir, base = dir, filepath.Join(dir, "minh")
+	}
+
+	minh.colFiles = make([]*minnow.Writer, len(minh.cols))
+	minh.colNames = make([]string, len(minh.cols))
+	for i := range minh.cols {
+		minh.colNames[i] = fmt.Sprintf("%s.col%d", base, i)
+		f, err := minnow.Create(minh.colNames[i])
+		if err != nil { return err }
+		minh.colFiles[i] = f
+		if err := startColumn(f, minh.cols[i]); err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
 		}
+	}
+	return nil
+}
 
-		colType := minh.cols[i].Type
-		switch {
-		case colType >= minnow.Int64Group && colType <= minnow.Float32Group:
-			minh.f.FixedSizeGroup(colType, N)
-			minh.f.Data(cols[i])
-		case colType == minnow.IntGroup:
-			minh.f.IntGroup(N)
-			minh.f.Data(cols[i])
-		case colType == minnow.FloatGroup:
-			lim := [2]float32{ minh.cols[i].Low, minh.cols[i].High }
-			x := cols[i].([]float32)
-			minh.buf = expandFloat32(minh.buf, len(x))
-			for j := range x { minh.buf[j] = x[j] }
-			processFloatGroup(minh.buf, minh.cols[i])
-
-			minh.f.FloatGroup(N, lim, minh.cols[i].Dx)
-			minh.f.Data(minh.buf)
+// startColumn starts a group in f which can hold the blocks of col.
+func startColumn(f *minnow.Writer, col Column) error {
+	N, colType := minnow.VariableLength, col.Type
+	switch {
+	case colType >= minnow.Int64Group && colType <= minnow.Float32Group:
+		return f.FixedSizeGroup(colType, N)
+	case colType == minnow.IntGroup:
+		return f.IntGroup(N)
+	case colType == minnow.EntropyIntGroup:
+		return f.EntropyIntGroup(N)
+	case colType == minnow.DeltaIntGroup:
+		return f.DeltaIntGroup(N)
+	case colType == minnow.LosslessFloat64Group ||
+		colType == minnow.LosslessFloat32Group:
+		return f.LosslessFloatGroup(colType, N)
+	case colType == minnow.FloatGroup:
+		lim := [2]float32{ col.Low, col.High }
+		return f.FloatGroup(N, lim, col.Dx, floatOptions(col)...)
+	case colType == minnow.EntropyFloatGroup:
+		lim := [2]float32{ col.Low, col.High }
+		return f.EntropyFloatGroup(N, lim, col.Dx, floatOptions(col)...)
+	case colType == minnow.BytesGroup:
+		return f.BytesGroup(N)
+	case colType == minnow.BoolGroup:
+		return f.BoolGroup(N)
+	case colType == minnow.BitmaskGroup:
+		return f.BitmaskGroup(N, int(col.Bits))
+	}
+	return fmt.Errorf("%w: can't write column with type flag %d",
+		minnow.ErrUnknownGroup, colType)
+}
+
+// copyColumn finishes the file of column i, copies its group to the end of f,
+// and removes it.
+func (minh *Writer) copyColumn(i int) error {
+	if err := minh.colFiles[i].Close(); err != nil { return err }
+	minh.colFiles[i] = nil
+
+	rd, err := minnow.Open(minh.colNames[i])
+	if err != nil { return err }
+	err = minh.f.CopyGroup(rd, 0)
+	if cerr := rd.Close(); err == nil { err = cerr }
+	if err != nil { return err }
+	return os.Remove(minh.colNames[i])
+}
+
+// removeColumns aborts the column files which haven't been closed yet and
+// removes the ones which have. The first error is returned.
+func (minh *Writer) removeColumns() error {
+	var err error
+	for i, f := range minh.colFiles {
+		if f != nil {
+			if aerr := f.Abort(); err == nil { err = aerr }
 		}
+		rerr := os.Remove(minh.colNames[i])
+		if rerr != nil && !os.IsNotExist(rerr) && err == nil { err = rerr }
 	}
+	minh.colFiles, minh.colNames = nil, nil
+
+	if minh.colDir != "" {
+		if rerr := os.RemoveAll(minh.colDir); err == nil { err = rerr }
+		minh.colDir = ""
+	}
+	return err
+}
+
+// floatOptions returns the options used to store a quantized float column.
+// Values outside [Low, High) are clamped, and log columns are log-scaled by
+// the group itself.
+func floatOptions(col Column) []minnow.FloatOption {
+	opts := []minnow.FloatOption{ minnow.NonPeriodic() }
+	if col.Log != 0 { opts = append(opts, minnow.Log()) }
+	return opts
 }
 
-func processFloatGroup(buf []float32, col Column) {
-	for j := range buf {
-		if col.Log != 0 { buf[j] = float32(math.Log10(float64(buf[j]))) }
-		if buf[j] < col.Low { buf[j] = col.Low }
-		if buf[j] >= col.High {
-			buf[j] = math.Nextafter32(col.High, float32(math.Inf(-1)))
+// Close writes the columns and the remaining headers and closes the file. If a
+// column or header can't be written, the file is aborted.
+func (minh *Writer) Close() error {
+	for i := range minh.colFiles {
+		if err := minh.copyColumn(i); err != nil {
+			minh.Abort()
+			return fmt.Errorf("column %d: %w", i, err)
 		}
 	}
+	if err := minh.removeColumns(); err != nil {
+		minh.Abort()
+		return err
+	}
+
+	hds := []interface{}{
+		geometry{ minh.l, minh.boundary, int64(minh.cells) },
+		int64(minh.blocks), minh.blockSizes,
+	}
+	if err := writeHeaders(minh.f, headerNames[3:], hds); err != nil {
+		minh.f.Abort()
+		return err
+	}
+	return minh.f.Close()
 }
 
-func (minh *Writer) Close() {
-	minh.f.Header(geometry{ minh.l, minh.boundary, int64(minh.cells) })
-	minh.f.Header(int64(minh.blocks))
-	minh.f.Header(minh.blockSizes)
-	minh.f.Close()
+// Abort stops the Writer without completing the file and removes its
+// temporary column files. A file opened by Create is removed. See
+// minnow.Writer.Abort.
+func (minh *Writer) Abort() error {
+	err := minh.f.Abort()
+	if cerr := minh.removeColumns(); err == nil { err = cerr }
+	return err
+}
+
+// headerNames are the names of the headers which follow the id header, in the
+// order they're written.
+var headerNames = []string{
+	"text", "names", "columns", "geometry", "blocks", "block_lengths",
+}
+
+// writeHeaders writes each element of hds to f as a header with the
+// corresponding name.
+func writeHeaders(f *minnow.Writer, names []string, hds []interface{}) error {
+	for i, hd := range hds {
+		if _, err := f.NamedHeader(names[i], hd); err != nil { return err }
+	}
+	return nil
+}
+
+// headerIndex returns the index of the header with the given name. Files
+// written before minnow had named headers fall back to index i.
+func headerIndex(f *minnow.Reader, name string, i int) int {
+	if j := f.HeaderIndex(name); j >= 0 { return j }
+	return i
 }
 
 func expandFloat32(buf []float32, N int) []float32 {
@@ -167,6 +365,9 @@ func expandInt64(buf []int64, N int) []int64 {
 	return append(buf, make([]int64, N - len(buf))...)
 }
 
+// Reader represents an open minh file. Its exported fields must not be
+// modified, but once opened, its methods are safe for concurrent use, so
+// different blocks can be decoded in parallel from a single Reader.
 type Reader struct {
 	Names []string
 	Text string
@@ -178,39 +379,79 @@ type Reader struct {
 
 
 	f *minnow.Reader
-	fileType int64
+	fileType, version int64
+}
+
+// Open opens a minh file.
+func Open(fname string) (*Reader, error) {
+	f, err := minnow.Open(fname)
+	if err != nil { return nil, err }
+	minh, err := open(f, fname)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return minh, nil
+}
+
+// NewReader returns a Reader for the minh file stored in r. Closing the Reader
+// does not close r.
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	f, err := minnow.NewReader(r)
+	if err != nil { return nil, err }
+	return open(f, "minh file")
+}
+
+// MustOpen is the same as Open, but panics on errors.
+func MustOpen(fname string) *Reader {
+	rd, err := Open(fname)
+	if err != nil { panic(err.Error()) }
+	return rd
 }
 
-func Open(fname string) *Reader {
-	f := minnow.Open(fname)
+func open(f *minnow.Reader, fname string) (*Reader, error) {
 	hd := &idHeader{ }
-	f.Header(0, hd)
+	if err := f.Header(headerIndex(f, "minh", 0), hd); err != nil {
+		return nil, fmt.Errorf("%w: %s does not start with a minh " +
+			"header: %v", ErrNotMinh, fname, err)
+	}
 
 	if hd.Magic != Magic {
-		panic(fmt.Sprintf("%s is not a minh file. Expected magic number " + 
-			"%d, but got %d.", fname, Magic, hd.Magic))
-	} else if hd.Version < Version {
-		panic(fmt.Sprintf("%s written with minh version %d, but reader " + 
-			"is version %d.", fname, hd.Version, Version))
+		return nil, fmt.Errorf("%w: %s has magic number %d, not %d",
+			ErrNotMinh, fname, hd.Magic, Magic)
+	} else if hd.Version < MinVersion || hd.Version > Version {
+		return nil, fmt.Errorf("%w: %s written with minh version %d, but " +
+			"reader supports versions %d to %d", minnow.ErrVersion, fname,
+			hd.Version, MinVersion, Version)
 	}
 
-	byteText := make([]byte, f.HeaderSize(1))
-	byteNames := make([]byte, f.HeaderSize(2))
-	cols := make([]Column, f.HeaderSize(3)/int(unsafe.Sizeof(Column{})))
+	idx := make([]int, len(headerNames))
+	sizes := make([]int, len(headerNames))
+	for i := range idx {
+		idx[i] = headerIndex(f, headerNames[i], i + 1)
+		size, err := f.HeaderSize(idx[i])
+		if err != nil { return nil, fmt.Errorf("%w: %v", ErrNotMinh, err) }
+		sizes[i] = size
+	}
+
+	byteText := make([]byte, sizes[0])
+	byteNames := make([]byte, sizes[1])
+	cols := make([]Column, sizes[2]/int(unsafe.Sizeof(Column{})))
 	geom := &geometry{ }
 	i64Blocks := int64(0)
-	i64BlockLengths := make([]int64, f.HeaderSize(6) / 8)
+	i64BlockLengths := make([]int64, sizes[5] / 8)
 	
-	f.Header(1, byteText)
-	f.Header(2, byteNames)
-	f.Header(3, cols)
-	f.Header(4, geom)
-	f.Header(5, &i64Blocks)
-	f.Header(6, i64BlockLengths)
+	hds := []interface{}{
+		byteText, byteNames, cols, geom, &i64Blocks, i64BlockLengths,
+	}
+	for i := range hds {
+		if err := f.Header(idx[i], hds[i]); err != nil { return nil, err }
+	}
 	
 	minh := &Reader{
 		f: f,
 		fileType: hd.FileType,
+		version: hd.Version,
 		Names: strings.Split(string(byteNames), "$"),
 		Text: string(byteText),
 		Columns: cols,
@@ -226,10 +467,11 @@ func Open(fname string) *Reader {
 		minh.Length += int(i64BlockLengths[i])
 	}
 
-	return minh
+	return minh, nil
 }
 
-func (rd *Reader) Ints(names []string) map[string][]int64 {
+// Ints reads the integer columns with the given names.
+func (rd *Reader) Ints(names []string) (map[string][]int64, error) {
 	out := map[string][]int64{ }
 	for _, name := range names { out[name] = make([]int64, rd.Length) }
 	end := 0
@@ -240,13 +482,14 @@ func (rd *Reader) Ints(names []string) map[string][]int64 {
 		bOut := map[string][]int64{ }
 
 		for _, name := range names { bOut[name] = out[name][start:end] }
-		rd.IntBlock(b, bOut)
+		if err := rd.IntBlock(b, bOut); err != nil { return nil, err }
 	}
 
-	return out
+	return out, nil
 }
 
-func (rd *Reader) Floats(names []string) map[string][]float32 {
+// Floats reads the floating point columns with the given names.
+func (rd *Reader) Floats(names []string) (map[string][]float32, error) {
 	out := map[string][]float32{ }
 	for _, name := range names { out[name] = make([]float32, rd.Length) }
 
@@ -258,61 +501,109 @@ func (rd *Reader) Floats(names []string) map[string][]float32 {
 		bOut := map[string][]float32{ }
 
 		for _, name := range names { bOut[name] = out[name][start:end] }
-		rd.FloatBlock(b, bOut)
+		if err := rd.FloatBlock(b, bOut); err != nil { return nil, err }
+	}
+
+	return out, nil
+}
+
+// Strings reads the Bytes columns with the given names.
+func (rd *Reader) Strings(names []string) (map[string][]string, error) {
+	out := map[string][]string{ }
+	for _, name := range names { out[name] = make([]string, rd.Length) }
+	end := 0
+
+	for b := 0; b < rd.Blocks; b++ {
+		start := end
+		end = start + rd.BlockLengths[b]
+		bOut := map[string][]string{ }
+
+		for _, name := range names { bOut[name] = out[name][start:end] }
+		if err := rd.StringBlock(b, bOut); err != nil { return nil, err }
 	}
 
-	return out
+	return out, nil
 }
 
-func (rd *Reader) IntBlock(b int, out map[string][]int64) {
+// Bools reads the Bool columns with the given names.
+func (rd *Reader) Bools(names []string) (map[string][]bool, error) {
+	out := map[string][]bool{ }
+	for _, name := range names { out[name] = make([]bool, rd.Length) }
+	end := 0
+
+	for b := 0; b < rd.Blocks; b++ {
+		start := end
+		end = start + rd.BlockLengths[b]
+		bOut := map[string][]bool{ }
+
+		for _, name := range names { bOut[name] = out[name][start:end] }
+		if err := rd.BoolBlock(b, bOut); err != nil { return nil, err }
+	}
+
+	return out, nil
+}
+
+// Bitmasks reads the Bitmask columns with the given names.
+func (rd *Reader) Bitmasks(names []string) (map[string][]uint64, error) {
+	out := map[string][]uint64{ }
+	for _, name := range names { out[name] = make([]uint64, rd.Length) }
+	end := 0
+
+	for b := 0; b < rd.Blocks; b++ {
+		start := end
+		end = start + rd.BlockLengths[b]
+		bOut := map[string][]uint64{ }
+
+		for _, name := range names { bOut[name] = out[name][start:end] }
+		if err := rd.BitmaskBlock(b, bOut); err != nil { return nil, err }
+	}
+
+	return out, nil
+}
+
+// IntBlock reads block b of the integer columns named by the keys of out into
+// its values. Values which are too short are expanded.
+func (rd *Reader) IntBlock(b int, out map[string][]int64) error {
 	runtime.GC()
 
 	for name, arr := range out {
 		arr = expandInt64(arr, rd.BlockLengths[b])
 
-		if len(arr) != rd.BlockLengths[b] {
-			panic(fmt.Sprintf("Reader.BlockLengths[%d] = %d, but " + 
-				"len(out[%s]) = %d", rd.BlockLengths[b], b, name, len(arr)))
-		}
-
-		var idx int
-		c := findName(name, rd.Names)
-		if rd.fileType == basicFileType {
-			idx = c + b*len(rd.Columns)
-		} else {
-			idx = c*rd.Blocks + b
-		}
+		c, err := findName(name, rd.Names)
+		if err != nil { return err }
+		idx := rd.dataIndex(c, b)
 
 		if err := minnow.TypeMatch(arr, rd.Columns[c].Type); err != nil {
-			panic(fmt.Sprintf("Column '%s': %s", name, err.Error()))
+			return fmt.Errorf("column '%s': %w", name, err)
 		}
 
-		rd.f.Data(idx, arr)
+		if err := rd.f.Data(idx, arr); err != nil { return err }
 
 		out[name] = arr
 	}
+	return nil
 }
 
-func (rd *Reader) FloatBlock(b int, out map[string][]float32) {
+// FloatBlock reads block b of the floating point columns named by the keys of
+// out into its values. Values which are too short are expanded.
+func (rd *Reader) FloatBlock(b int, out map[string][]float32) error {
 	runtime.GC()
 	for name, arr := range out {
 		arr = expandFloat32(arr, rd.BlockLengths[b])
 
-		c := findName(name, rd.Names)
-		var idx int
-		if rd.fileType == basicFileType {
-			idx = c + b*len(rd.Columns)
-		} else {
-			idx = c*rd.Blocks + b
-		}
+		c, err := findName(name, rd.Names)
+		if err != nil { return err }
+		idx := rd.dataIndex(c, b)
 
 		if err := minnow.TypeMatch(arr, rd.Columns[c].Type); err != nil {
-			panic(fmt.Sprintf("Column '%s': %s", name, err.Error()))
+			return fmt.Errorf("column '%s': %w", name, err)
 		}
 
-		rd.f.Data(idx, arr)
+		if err := rd.f.Data(idx, arr); err != nil { return err }
 
-		if rd.Columns[c].Log != 0 {
+		// Before version 1, log scaling was done by minh rather than by
+		// the float group.
+		if rd.Columns[c].Log != 0 && rd.version < 1 {
 			for i := range arr {
 				arr[i] = float32(math.Pow(10, float64(arr[i])))
 			}
@@ -320,15 +611,111 @@ func (rd *Reader) FloatBlock(b int, out map[string][]float32) {
 
 		out[name] = arr
 	}
+	return nil
+}
+
+// StringBlock reads block b of the Bytes columns named by the keys of out into
+// its values. Values which are too short are expanded.
+func (rd *Reader) StringBlock(b int, out map[string][]string) error {
+	for name, arr := range out {
+		if len(arr) < rd.BlockLengths[b] {
+			arr = append(arr, make([]string, rd.BlockLengths[b] - len(arr))...)
+		}
+		arr = arr[:rd.BlockLengths[b]]
+
+		c, err := findName(name, rd.Names)
+		if err != nil { return err }
+		idx := rd.dataIndex(c, b)
+
+		if err := minnow.TypeMatch(arr, rd.Columns[c].Type); err != nil {
+			return fmt.Errorf("column '%s': %w", name, err)
+		}
+
+		if err := rd.f.Data(idx, arr); err != nil { return err }
+
+		out[name] = arr
+	}
+	return nil
+}
+
+// BoolBlock reads block b of the Bool columns named by the keys of out into
+// its values. Values which are too short are expanded. Integer columns, like
+// the boundary column of files written before version 2, can also be read, in
+// which case non-zero values are true.
+func (rd *Reader) BoolBlock(b int, out map[string][]bool) error {
+	for name, arr := range out {
+		n := rd.BlockLengths[b]
+		if len(arr) < n { arr = append(arr, make([]bool, n - len(arr))...) }
+		arr = arr[:n]
+
+		c, err := findName(name, rd.Names)
+		if err != nil { return err }
+		idx := rd.dataIndex(c, b)
+
+		if rd.Columns[c].Type == Bool {
+			if err := rd.f.Data(idx, arr); err != nil { return err }
+		} else {
+			ints := make([]int64, n)
+			if err := minnow.TypeMatch(ints, rd.Columns[c].Type); err != nil {
+				return fmt.Errorf("column '%s': %w", name, err)
+			}
+			if err := rd.f.Data(idx, ints); err != nil { return err }
+			for i := range arr { arr[i] = ints[i] != 0 }
+		}
+
+		out[name] = arr
+	}
+	return nil
+}
+
+// BitmaskBlock reads block b of the Bitmask columns named by the keys of out
+// into its values. Values which are too short are expanded.
+func (rd *Reader) BitmaskBlock(b int, out map[string][]uint64) error {
+	for name, arr := range out {
+		n := rd.BlockLengths[b]
+		if len(arr) < n { arr = append(arr, make([]uint64, n - len(arr))...) }
+		arr = arr[:n]
+
+		c, err := findName(name, rd.Names)
+		if err != nil { return err }
+		idx := rd.dataIndex(c, b)
+
+		if err := minnow.TypeMatch(arr, rd.Columns[c].Type); err != nil {
+			return fmt.Errorf("column '%s': %w", name, err)
+		}
+
+		if err := rd.f.Data(idx, arr); err != nil { return err }
+
+		out[name] = arr
+	}
+	return nil
+}
+
+// dataIndex returns the index of the minnow block which holds block b of
+// column c. Before version 3, basic files started a new group for every column
+// of every block, so their blocks are stored row by row.
+func (rd *Reader) dataIndex(c, b int) int {
+	if rd.fileType == basicFileType && rd.version < 3 {
+		return c + b*len(rd.Columns)
+	}
+	return c*rd.Blocks + b
+}
+
+// SetDequantization overrides how quantized float columns are reconstructed.
+// It should not be called concurrently with other methods.
+func (rd *Reader) SetDequantization(mode minnow.Dequantization) {
+	rd.f.SetDequantization(mode)
 }
 
-func (rd *Reader) Close() {
-	rd.f.Close()
+// Close closes the file.
+func (rd *Reader) Close() error {
+	return rd.f.Close()
 }
 
-func findName(name string, names []string) int {
+func findName(name string, names []string) (int, error) {
 	for i := range names {
-		if name == names[i] { return i }
+		if name == names[i] { return i, nil }
 	}
-	panic(fmt.Sprintf("Name %s not in Reader.Names = %s.", name, names))
+	return -1, fmt.Errorf("%w: %s not in Reader.Names = %s",
+		ErrColumnName, name, names)
 }
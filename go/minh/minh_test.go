@@ -1,7 +1,9 @@
 package minh
 
 import (
+	"errors"
 	"math"
+	"os"
 	"testing"
 
 	minnow "github.com/phil-mansfield/minnow/go"
@@ -52,7 +54,7 @@ func TestReaderWriter(t *testing.T) {
 
 	blocks := [][]interface{}{ block1, block2}
 
-	wr := Create(fname)
+	wr := MustCreate(fname)
 	wr.Header(names, text, columns)
 	wr.Geometry(L, boundary, cells)
 	for _, block := range blocks { wr.Block(block) }
@@ -63,7 +65,14 @@ func TestReaderWriter(t *testing.T) {
 
 	blocks = append(blocks, joinedBlocks)
 
-	rd := Open(fname)
+	// Each column is a single group, no matter how many blocks there are.
+	mf := minnow.MustOpen(fname)
+	if groups := len(mf.Groups()); groups != len(columns) {
+		t.Errorf("Expected %d groups, got %d.", len(columns), groups)
+	}
+	mf.Close()
+
+	rd := MustOpen(fname)
 
 	if !stringsEq(rd.Names, names) || rd.Text != text ||
 		!columnsEq(rd.Columns, columns) || rd.Blocks != 2 ||
@@ -81,8 +90,11 @@ func TestReaderWriter(t *testing.T) {
 			rd.IntBlock(b, intOut)
 			rd.FloatBlock(b, floatOut)
 		} else {
-			intOut = rd.Ints([]string{"int64", "int"})
-			floatOut = rd.Floats([]string{"float32", "float", "log"})
+			var err error
+			intOut, err = rd.Ints([]string{"int64", "int"})
+			if err != nil { t.Fatal(err) }
+			floatOut, err = rd.Floats([]string{"float32", "float", "log"})
+			if err != nil { t.Fatal(err) }
 		}
 
 		int64Col := block[0].([]int64)
@@ -117,6 +129,320 @@ func TestReaderWriter(t *testing.T) {
 }
 
 
+func TestCodecColumns(t *testing.T) {
+	fname := "../../test_files/codec_minh.test"
+
+	ids := []int64{5, 5, 5, 6, 1 << 40, -3}
+	mass := []float32{1e10, 1e10, 2e10, 1e12, 1e10, 1e11}
+	sorted := []int64{1000, 1001, 1003, 1004, 1004, 1010}
+	spin := []float32{0.01, 0.02, 0.0125, 0.5, 1e-7, 0.01}
+	finder := []string{"Rockstar", "Rockstar", "", "AHF", "Rockstar", "AHF"}
+	mmp := []bool{true, false, false, true, true, false}
+	flags := []uint64{0, 1, 5, 7, 2, 4}
+	wr := MustCreate(fname)
+	names := []string{
+		"id", "mass", "sorted", "spin", "finder", "mmp?", "flags",
+	}
+	err := wr.Header(names, "", []Column{
+		{Type: EntropyInt},
+		{Type: EntropyFloat, Log: 1, Low: 9, High: 13, Dx: 0.01},
+		{Type: DeltaInt},
+		{Type: LosslessFloat32},
+		{Type: Bytes},
+		{Type: Bool},
+		{Type: Bitmask, Bits: 3},
+	})
+	if err != nil { t.Fatal(err) }
+	err = wr.Block([]interface{}{
+		ids, mass, sorted, spin, finder, mmp, flags,
+	})
+	if err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd := MustOpen(fname)
+	defer rd.Close()
+	mf := minnow.MustOpen(fname)
+	defer mf.Close()
+	blocks := int64(0)
+	if err := mf.HeaderByName("blocks", &blocks); err != nil || blocks != 1 {
+		t.Errorf("Expected 'blocks' header to be 1, got %d and %v.",
+			blocks, err)
+	}
+	intOut, err := rd.Ints([]string{"id", "sorted"})
+	if err != nil { t.Fatal(err) }
+	floatOut, err := rd.Floats([]string{"mass", "spin"})
+	if err != nil { t.Fatal(err) }
+	strOut, err := rd.Strings([]string{"finder"})
+	if err != nil { t.Fatal(err) }
+	boolOut, err := rd.Bools([]string{"mmp?", "id"})
+	if err != nil { t.Fatal(err) }
+	maskOut, err := rd.Bitmasks([]string{"flags"})
+	if err != nil { t.Fatal(err) }
+	if _, err := rd.Strings([]string{"id"}); !errors.Is(err,
+		minnow.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+
+	if !int64sEq(intOut["id"], ids) {
+		t.Errorf("Expected ids %d, got %d.", ids, intOut["id"])
+	}
+	if !int64sEq(intOut["sorted"], sorted) {
+		t.Errorf("Expected sorted column %d, got %d.", sorted, intOut["sorted"])
+	}
+	if !float32sEq(floatOut["spin"], spin, 0) {
+		t.Errorf("Expected spins %g, got %g.", spin, floatOut["spin"])
+	}
+	if !log32sEq(floatOut["mass"], mass, 0.01) {
+		t.Errorf("Expected masses %g, got %g.", mass, floatOut["mass"])
+	}
+	if !stringsEq(strOut["finder"], finder) {
+		t.Errorf("Expected finders %q, got %q.", finder, strOut["finder"])
+	}
+	if !boolsEq(boolOut["mmp?"], mmp) {
+		t.Errorf("Expected mmp? flags %t, got %t.", mmp, boolOut["mmp?"])
+	}
+	for i := range ids {
+		if boolOut["id"][i] != (ids[i] != 0) {
+			t.Errorf("Expected id %d to read as %t.", ids[i], ids[i] != 0)
+		}
+		if maskOut["flags"][i] != flags[i] {
+			t.Errorf("Expected flags %d, got %d.", flags, maskOut["flags"])
+			break
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	fname := "../../test_files/errors_minh.test"
+
+	f := minnow.MustCreate(fname)
+	f.Header(int64(0))
+	f.Close()
+
+	if _, err := Open(fname); !errors.Is(err, ErrNotMinh) {
+		t.Errorf("Expected ErrNotMinh, got %v.", err)
+	}
+
+	wr := MustCreate(fname)
+	wr.Header([]string{"id"}, "", []Column{{Type: Int64}})
+	if err := wr.Block([]interface{}{ []float32{1} });
+		!errors.Is(err, minnow.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	if err := wr.Block([]interface{}{ []int64{1} }); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	// Columns are encoded as blocks are added.
+	wr = MustCreate(fname)
+	wr.Header([]string{"flags"}, "", []Column{{Type: Bitmask, Bits: 2}})
+	if err := wr.Block([]interface{}{ }); !errors.Is(err,
+		minnow.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for an empty block, got %v.", err)
+	}
+	if err := wr.Block([]interface{}{ []uint64{7} }); err == nil {
+		t.Errorf("Expected error from Block for an oversized bitmask.")
+	}
+	if err := wr.Abort(); err != nil { t.Fatal(err) }
+
+	// Files whose headers can't be written are aborted by Close.
+	failName := "../../test_files/errors_minh_fail.test"
+	os.Remove(failName)
+	wr = MustCreate(failName)
+	wr.Header([]string{"id"}, "", []Column{{Type: Int64}})
+	wr.f.NamedHeader("geometry", int64(0))
+	if err := wr.Close(); err == nil {
+		t.Errorf("Expected error from Close for a duplicate header.")
+	}
+	if _, err := os.Stat(failName); !os.IsNotExist(err) {
+		t.Errorf("Expected Close to not create %s, got %v.", failName, err)
+	}
+	if tmp := wr.f.TempName(); tmp != "" {
+		if _, err := os.Stat(tmp); !os.IsNotExist(err) {
+			t.Errorf("Expected Close to remove %s, got %v.", tmp, err)
+		}
+	}
+
+	// Aborted Writers leave the existing file alone.
+	bw := MustCreateBoundary(fname)
+	if err := bw.Header("aborted"); err != nil { t.Fatal(err) }
+	if err := bw.Abort(); err != nil { t.Fatal(err) }
+
+	rd := MustOpen(fname)
+	defer rd.Close()
+	if rd.fileType != basicFileType {
+		t.Errorf("Expected aborted BoundaryWriter to leave the file unchanged.")
+	}
+	if _, err := rd.Ints([]string{"meow"}); !errors.Is(err, ErrColumnName) {
+		t.Errorf("Expected ErrColumnName, got %v.", err)
+	}
+	if _, err := rd.Floats([]string{"id"});
+		!errors.Is(err, minnow.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+}
+
+// TestColumnFiles checks that columns are streamed to temporary files which
+// are removed by Close and Abort.
+func TestColumnFiles(t *testing.T) {
+	fname := "../../test_files/column_files_minh.test"
+	for _, abort := range []bool{ false, true } {
+		wr := MustCreate(fname)
+		err := wr.Header([]string{"id", "x"}, "",
+			[]Column{{Type: Int64}, {Type: Float32}})
+		if err != nil { t.Fatal(err) }
+		err = wr.Block([]interface{}{ []int64{1, 2}, []float32{3, 4} })
+		if err != nil { t.Fatal(err) }
+
+		names := append([]string{ }, wr.colNames...)
+		for _, f := range wr.colFiles {
+			name := f.TempName()
+			names = append(names, name)
+			if _, err := os.Stat(name); err != nil {
+				t.Errorf("Expected %s to exist before Close, got %v.",
+					name, err)
+			}
+		}
+
+		if abort {
+			err = wr.Abort()
+		} else {
+			err = wr.Close()
+		}
+		if err != nil { t.Fatal(err) }
+
+		for _, name := range names {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("abort = %v: expected %s to be removed, got %v.",
+					abort, name, err)
+			}
+		}
+	}
+
+	rd := MustOpen(fname)
+	defer rd.Close()
+	x, err := rd.Floats([]string{"x"})
+	if err != nil { t.Fatal(err) }
+	if len(x["x"]) != 2 || x["x"][0] != 3 || x["x"][1] != 4 {
+		t.Errorf("Expected x = [3 4], got %v.", x["x"])
+	}
+
+	// Writers which weren't opened by Create keep their columns in a
+	// temporary directory.
+	buf := minnow.NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	err = wr.Header([]string{"id"}, "", []Column{{Type: Int64}})
+	if err != nil { t.Fatal(err) }
+	dir := wr.colDir
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("Expected %s to exist before Close, got %v.", dir, err)
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, got %v.", dir, err)
+	}
+}
+
+// TestVersion1 checks that minh files written with version 1 of the minnow
+// format can still be read.
+func TestVersion1(t *testing.T) {
+	rd, err := Open("testdata/v1.minh")
+	if err != nil { t.Fatal(err) }
+	defer rd.Close()
+
+	if rd.Text != "v1 golden file" || rd.Length != 5 || rd.Blocks != 2 {
+		t.Errorf("Expected text 'v1 golden file' with 5 rows in 2 blocks, " +
+			"got '%s' with %d rows in %d blocks.", rd.Text, rd.Length, rd.Blocks)
+	}
+
+	ints, err := rd.Ints([]string{"id"})
+	if err != nil { t.Fatal(err) }
+	if !int64sEq(ints["id"], []int64{1, 2, 3, 4, 5}) {
+		t.Errorf("Expected ids 1 to 5, got %d.", ints["id"])
+	}
+
+	floats, err := rd.Floats([]string{"x", "mass"})
+	if err != nil { t.Fatal(err) }
+	x := []float32{1.5, 2.5, 9.75, 0.25, 5}
+	mass := []float32{1e10, 2e11, 3e12, 4e10, 5e11}
+	if !float32sEq(floats["x"], x, 0.01) {
+		t.Errorf("Expected x = %g, got %g.", x, floats["x"])
+	}
+	if !float32sEq(floats["mass"], mass, 0) {
+		t.Errorf("Expected mass = %g, got %g.", mass, floats["mass"])
+	}
+}
+
+func TestBlocksWhere(t *testing.T) {
+	fname := "../../test_files/blocks_where_minh.test"
+
+	wr := MustCreate(fname)
+	err := wr.Header([]string{ "id", "mvir" }, "", []Column{
+		{Type: Int},
+		{Type: Float, Log: 1, Low: 9, High: 15, Dx: 0.01},
+	})
+	if err != nil { t.Fatal(err) }
+	blocks := [][]interface{}{
+		{ []int64{ 1, 2, 3 }, []float32{ 1e10, 5e10, 1e11 } },
+		{ []int64{ 4, 5, 6 }, []float32{ 1e12, 5e13, 2e12 } },
+		{ []int64{ 7, 8, 9 }, []float32{ 1e11, 2e12, 3e11 } },
+	}
+	for _, cols := range blocks {
+		if err := wr.Block(cols); err != nil { t.Fatal(err) }
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd := MustOpen(fname)
+	defer rd.Close()
+
+	tests := []struct {
+		preds []string
+		blocks []int
+	} {
+		{ []string{ }, []int{ 0, 1, 2 } },
+		{ []string{ "mvir > 1e13" }, []int{ 1 } },
+		{ []string{ "mvir<=2e11" }, []int{ 0, 2 } },
+		{ []string{ "mvir >= 1e12", "id < 5" }, []int{ 1 } },
+		{ []string{ "id == 8" }, []int{ 2 } },
+		{ []string{ "mvir > 1e16" }, []int{ } },
+	}
+	for i := range tests {
+		preds := make([]Predicate, len(tests[i].preds))
+		for j := range preds {
+			preds[j], err = ParsePredicate(tests[i].preds[j])
+			if err != nil { t.Fatal(err) }
+		}
+		blocks, err := rd.BlocksWhere(preds...)
+		if err != nil { t.Fatal(err) }
+		if !intsEq(blocks, tests[i].blocks) {
+			t.Errorf("%d) Expected blocks %d for %q, got %d.",
+				i, tests[i].blocks, tests[i].preds, blocks)
+		}
+	}
+
+	for _, s := range []string{ "mvir", "mvir ~ 1e13", "mvir > big" } {
+		if _, err := ParsePredicate(s); err == nil {
+			t.Errorf("Expected error parsing '%s'.", s)
+		}
+	}
+	_, err = rd.BlocksWhere(Predicate{ "rvir", 0, 1 })
+	if !errors.Is(err, ErrColumnName) {
+		t.Errorf("Expected ErrColumnName, got %v.", err)
+	}
+
+	// Files without statistics never skip blocks.
+	old, err := Open("testdata/v1.minh")
+	if err != nil { t.Fatal(err) }
+	defer old.Close()
+	oldBlocks, err := old.BlocksWhere(Predicate{ "mass", 1e20, math.Inf(1) })
+	if err != nil { t.Fatal(err) }
+	if !intsEq(oldBlocks, []int{ 0, 1 }) {
+		t.Errorf("Expected all blocks of v1 file, got %d.", oldBlocks)
+	}
+}
+
 func TestBoundaryRegion(t *testing.T) {
 	L := float32(90.0)
 	Bnd := float32(10.0)
@@ -343,17 +669,17 @@ func TestBoundary(t *testing.T) {
 	}
 	blocks := []struct{
 		x []float32
-		boundaryFlag []int64
+		boundaryFlag []bool
 		id []int64
 	} {
-		{[]float32{25, 50, 26}, []int64{0, 1, 1}, []int64{0, 1, 2}},
-		{[]float32{50}, []int64{1}, []int64{1}},
-		{[]float32{50}, []int64{1}, []int64{1}},
-		{[]float32{50}, []int64{1}, []int64{1}},
-		{[]float32{50, 26}, []int64{1, 0}, []int64{1, 2}},
-		{[]float32{50}, []int64{1}, []int64{1}},
-		{[]float32{50}, []int64{1}, []int64{1}},
-		{[]float32{50}, []int64{0}, []int64{1}},
+		{[]float32{25, 50, 26}, []bool{false, true, true}, []int64{0, 1, 2}},
+		{[]float32{50}, []bool{true}, []int64{1}},
+		{[]float32{50}, []bool{true}, []int64{1}},
+		{[]float32{50}, []bool{true}, []int64{1}},
+		{[]float32{50, 26}, []bool{true, false}, []int64{1, 2}},
+		{[]float32{50}, []bool{true}, []int64{1}},
+		{[]float32{50}, []bool{true}, []int64{1}},
+		{[]float32{50}, []bool{false}, []int64{1}},
 	}
 
 	coord := [3][]float32{
@@ -367,28 +693,34 @@ func TestBoundary(t *testing.T) {
 
 	id := make([]int64, len(vecs))
 	for i := range id { id[i] = int64(i) }
+	name := []string{ "a", "b", "c" }
 
-	f := CreateBoundary(fname)
+	f := MustCreateBoundary(fname)
 	f.Header("This is my header string.")
 	f.Geometry(100.0, 20.0, 2)
 	f.Coordinates(coord[0], coord[1], coord[2])
 	f.Column("id", Column{Type: Int64}, id)
 	f.Column("x", Column{Type: Float32}, coord[0])
+	f.Column("name", Column{Type: Bytes}, name)
 	f.Close()
 
-	rd := Open(fname)
+	rd := MustOpen(fname)
 
-	iOut := map[string][]int64 { "boundary": nil, "id": nil }
+	iOut := map[string][]int64 { "id": nil }
+	bOut := map[string][]bool { "boundary": nil }
 	fOut := map[string][]float32 { "x": nil }
 		_ = fOut
+	sOut := map[string][]string { "name": nil }
 
 	for b := 0; b < 8; b++ {
 		rd.IntBlock(b, iOut)
+		if err := rd.BoolBlock(b, bOut); err != nil { t.Fatal(err) }
 		rd.FloatBlock(b, fOut)
+		if err := rd.StringBlock(b, sOut); err != nil { t.Fatal(err) }
 
-		if !int64sEq(iOut["boundary"], blocks[b].boundaryFlag) {
-			t.Errorf("Expected boundary[%d] = %d, but got %d.", b,
-				blocks[b].boundaryFlag, iOut["boundary"])
+		if !boolsEq(bOut["boundary"], blocks[b].boundaryFlag) {
+			t.Errorf("Expected boundary[%d] = %t, but got %t.", b,
+				blocks[b].boundaryFlag, bOut["boundary"])
 		}
 		if !int64sEq(iOut["id"], blocks[b].id) {
 			t.Errorf("Expected id[%d] = %d, but got %d.", b,
@@ -398,6 +730,12 @@ func TestBoundary(t *testing.T) {
 			t.Errorf("Expected x[%d] = %g, but got %g.", b,
 				blocks[b].x, fOut["x"])
 		}
+		for i, j := range blocks[b].id {
+			if sOut["name"][i] != name[j] {
+				t.Errorf("Expected name[%d][%d] = %q, but got %q.", b, i,
+					name[j], sOut["name"][i])
+			}
+		}
 	}
 
 	rd.Close()
@@ -409,6 +747,12 @@ func stringsEq(x, y []string) bool {
 	return true
 }
 
+func boolsEq(x, y []bool) bool {
+	if len(x) != len(y) { return false }
+	for i := range x { if x[i] != y[i] { return false } }
+	return true
+}
+
 func intsEq(x, y []int) bool {
 	if len(x) != len(y) { return false }
 	for i := range x { if x[i] != y[i] { return false } }
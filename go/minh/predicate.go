@@ -0,0 +1,87 @@
+package minh
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Predicate is a range of values, [Low, High], that rows of the named column
+// are selected by. Use infinite limits for one-sided ranges.
+type Predicate struct {
+	Name string
+	Low, High float64
+}
+
+// ParsePredicate parses a predicate of the form "name op value", where op is
+// one of <, <=, >, >=, or ==, e.g. "mvir > 1e13". Since Predicates are only
+// used to skip blocks, strict and non-strict comparisons are the same.
+func ParsePredicate(s string) (Predicate, error) {
+	i := strings.IndexAny(s, "<>=")
+	if i < 0 {
+		return Predicate{ }, fmt.Errorf("minh: predicate '%s' has no " +
+			"comparison operator", s)
+	}
+	j := i + 1
+	if j < len(s) && s[j] == '=' { j++ }
+	name, op := strings.TrimSpace(s[:i]), s[i:j]
+
+	x, err := strconv.ParseFloat(strings.TrimSpace(s[j:]), 64)
+	if err != nil {
+		return Predicate{ }, fmt.Errorf("minh: predicate '%s': %w", s, err)
+	}
+
+	p := Predicate{ name, math.Inf(-1), math.Inf(+1) }
+	switch op {
+	case "<", "<=": p.High = x
+	case ">", ">=": p.Low = x
+	case "==": p.Low, p.High = x, x
+	default:
+		return Predicate{ }, fmt.Errorf("minh: predicate '%s' has unknown " +
+			"operator '%s'", s, op)
+	}
+	return p, nil
+}
+
+// BlocksWhere returns the blocks which could contain rows that satisfy every
+// predicate. Other blocks are skipped based on the statistics of their
+// columns, without being read. Files written with minnow versions before 6
+// don't have statistics, so none of their blocks are skipped.
+func (rd *Reader) BlocksWhere(preds ...Predicate) ([]int, error) {
+	cols := make([]int, len(preds))
+	for i := range preds {
+		c, err := findName(preds[i].Name, rd.Names)
+		if err != nil { return nil, err }
+		cols[i] = c
+	}
+
+	blocks := []int{ }
+	for b := 0; b < rd.Blocks; b++ {
+		ok := true
+		for i, p := range preds {
+			stats, err := rd.f.BlockStats(rd.dataIndex(cols[i], b))
+			if err != nil { return nil, err }
+
+			low, high := p.Low, p.High
+			// Before version 1, log columns were stored as log10 values.
+			if rd.Columns[cols[i]].Log != 0 && rd.version < 1 {
+				low, high = log10Limit(low), log10Limit(high)
+			}
+
+			if !stats.Contains(low, high) {
+				ok = false
+				break
+			}
+		}
+		if ok { blocks = append(blocks, b) }
+	}
+	return blocks, nil
+}
+
+// log10Limit returns log10(x), sending non-positive values to -Inf, since
+// every value of a log column is positive.
+func log10Limit(x float64) float64 {
+	if x <= 0 { return math.Inf(-1) }
+	return math.Log10(x)
+}
@@ -4,5 +4,17 @@ format itself is more general and lends itself well to storing compressed data
 blocks.*/
 package minnow
 
-const Version = 1
+// Version is the version of the file format. Writers always emit the current
+// Version, while Readers can read any version from MinVersion to Version.
+//
+// Version history:
+//   1 - Initial format.
+//   2 - Adds checksums to the end of the tail.
+//   3 - Float groups can be log-scaled, flagged in their tails.
+//   4 - Groups can have VariableLength blocks, with lengths in their tails.
+//   5 - Headers have names and schemas, stored after the group tails.
+//   6 - Blocks have statistics, stored after the header names.
+const Version = 6
+// MinVersion is the oldest version of the file format that can be read.
+const MinVersion = 1
 const Magic = 0xacedad
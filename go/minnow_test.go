@@ -1,7 +1,19 @@
 package minnow
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
 	"testing"
+
+	"github.com/phil-mansfield/minnow/go/lz"
 )
 
 type int64RecordHead struct {
@@ -19,7 +31,7 @@ func createInt64Record(fname string, xs [][]int64, text string) {
 
 	// Create the file
 
-	f := Create(fname)
+	f := MustCreate(fname)
 	defer f.Close()
 
 	f.Header(hd)
@@ -35,13 +47,14 @@ func createInt64Record(fname string, xs [][]int64, text string) {
 func readInt64Record(fname string) (xs [][]int64, text string) {
 	// Open and confirm type.
 
-	f := Open(fname)
+	f := MustOpen(fname)
 
 	// Header stuff.
 
 	hd := &int64RecordHead{ }
 	f.Header(0, hd)
-	bText := make([]byte, f.HeaderSize(1))
+	size, _ := f.HeaderSize(1)
+	bText := make([]byte, size)
 	f.Header(1, bText)
 	lengths := make([]uint64, hd.Blocks)
 	f.Header(2, lengths)
@@ -62,7 +75,7 @@ type groupRecordHeader struct {
 }
 
 func createGroupRecord(fname string, ix []int32, fx []float64, text string) {
-	f := Create(fname)
+	f := MustCreate(fname)
 	defer f.Close()
 
 	in, fn := len(ix) / 4, len(fx) / 2
@@ -86,13 +99,14 @@ func createGroupRecord(fname string, ix []int32, fx []float64, text string) {
 }
 
 func readGroupRecord(fname string) ([]int32, []float64, string) {
-	f := Open(fname)
+	f := MustOpen(fname)
 	defer f.Close()
 
 	iHd, fHd := &groupRecordHeader{}, &groupRecordHeader{}
 	f.Header(0, iHd)
 	f.Header(1, fHd)
-	bText := make([]byte, f.HeaderSize(2))
+	size, _ := f.HeaderSize(2)
+	bText := make([]byte, size)
 	f.Header(2, bText)
 
 	ix, fx := make([]int32, iHd.Blocks*iHd.N), make([]float64, fHd.Blocks*fHd.N)
@@ -107,7 +121,7 @@ func readGroupRecord(fname string) ([]int32, []float64, string) {
 }
 
 func createBitIntRecord(fname string, x1 []int64, x2 [][]int64, x3 []int64) {
-	f := Create(fname)
+	f := MustCreate(fname)
 	defer f.Close()
 
 	f.IntGroup(len(x1))
@@ -122,16 +136,21 @@ func createBitIntRecord(fname string, x1 []int64, x2 [][]int64, x3 []int64) {
 }
 
 func readBitIntRecord(fname string) ([]int64, [][]int64, []int64) {
-	f := Open(fname)
+	f := MustOpen(fname)
 	defer f.Close()
 
 	var x2Len int64
 	f.Header(0, &x2Len)
 
-	x1 := make([]int64, f.DataLen(0))
+	n, _ := f.DataLen(0)
+	x1 := make([]int64, n)
 	x2 := make([][]int64, x2Len)
-	for i := range x2 { x2[i] = make([]int64, f.DataLen(1 + i))}
-	x3 := make([]int64, f.DataLen(int(x2Len) + 1))
+	for i := range x2 {
+		n, _ = f.DataLen(1 + i)
+		x2[i] = make([]int64, n)
+	}
+	n, _ = f.DataLen(int(x2Len) + 1)
+	x3 := make([]int64, n)
 
 	f.Data(0, x1)
 	for i := range x2 { f.Data(i+1, x2[i]) }
@@ -155,7 +174,7 @@ func createQFloatRecord(
 		X2Blocks: int64(len(x2)),
 	}
 
-	f := Create(fname)
+	f := MustCreate(fname)
 	defer f.Close()
 
 	f.Header(hd)
@@ -168,7 +187,7 @@ func createQFloatRecord(
 func readQFloatRecord(fname string) (x1, x2 [][]float32) {
 	hd := &qFloatRecordHeader{ }
 	
-	f := Open(fname)
+	f := MustOpen(fname)
 	defer f.Close()
 
 	f.Header(0, hd)
@@ -176,12 +195,14 @@ func readQFloatRecord(fname string) (x1, x2 [][]float32) {
 	x2 = make([][]float32, hd.X2Blocks)
 
 	for i1 := range x1 {
-		x1[i1] = make([]float32, f.DataLen(i1))
+		n, _ := f.DataLen(i1)
+		x1[i1] = make([]float32, n)
 		f.Data(i1, x1[i1])
 	}
 	for i2 := range x2 {
 		idx := i2 + int(hd.X1Blocks)
-		x2[i2] = make([]float32, f.DataLen(idx))
+		n, _ := f.DataLen(idx)
+		x2[i2] = make([]float32, n)
 		f.Data(idx, x2[i2])
 	}
 
@@ -309,34 +330,2309 @@ func TestQFloatRecord(t *testing.T) {
 	}
 }
 
-func int32sEq(x, y []int32) bool {
-	if len(x) != len(y) { return false }
-	for i := range x {
-		if x[i] != y[i] { return false }
+func TestBuffer(t *testing.T) {
+	prefix := []byte("meow meow")
+	buf := &Buffer{ }
+	buf.Write(prefix)
+
+	x1 := []int64{100, 101, 102, 104}
+	x2 := []float32{-50, 0, 50, 49}
+	text := []byte("I'm a caaaat")
+
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	wr.Header(text)
+	wr.IntGroup(len(x1))
+	wr.Data(x1)
+	wr.FixedSizeGroup(Float32Group, len(x2))
+	wr.Data(x2)
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	if pos, _ := buf.Seek(0, io.SeekCurrent); pos != int64(buf.Len()) {
+		t.Errorf("Writer left the Buffer at %d, not at its end, %d.",
+			pos, buf.Len())
+	}
+
+	sr := io.NewSectionReader(buf, int64(len(prefix)),
+		int64(buf.Len() - len(prefix)))
+	rd, err := NewReader(sr)
+	if err != nil { t.Fatal(err) }
+	defer rd.Close()
+
+	size, err := rd.HeaderSize(0)
+	if err != nil { t.Fatal(err) }
+	rdText := make([]byte, size)
+	rdX1, rdX2 := make([]int64, len(x1)), make([]float32, len(x2))
+	if err := rd.Header(0, rdText); err != nil { t.Fatal(err) }
+	if err := rd.Data(0, rdX1); err != nil { t.Fatal(err) }
+	if err := rd.Data(1, rdX2); err != nil { t.Fatal(err) }
+
+	if string(rdText) != string(text) {
+		t.Errorf("Wrote text = '%s', but read text = '%s'", text, rdText)
+	}
+	if !int64sEq(x1, rdX1) {
+		t.Errorf("Wrote x1 = %d, but read x1 = %d", x1, rdX1)
+	}
+	if !float32sEq(x2, rdX2, 0) {
+		t.Errorf("Wrote x2 = %g, but read x2 = %g", x2, rdX2)
+	}
+	if string(buf.Bytes()[:len(prefix)]) != string(prefix) {
+		t.Errorf("Writer overwrote data before its starting position.")
 	}
-	return true
 }
 
-func int64sEq(x, y []int64) bool {
-	if len(x) != len(y) { return false }
-	for i := range x {
-		if x[i] != y[i] { return false }
+func TestConcurrentReads(t *testing.T) {
+	fname := "../test_files/concurrent_reads.test"
+	blocks, n := 50, 100
+
+	xs := make([][]int64, blocks)
+	for i := range xs {
+		xs[i] = make([]int64, n)
+		for j := range xs[i] { xs[i][j] = int64(i*j - 7*j) }
+	}
+
+	wr := MustCreate(fname)
+	wr.IntGroup(n)
+	for i := range xs[:blocks/2] { wr.Data(xs[i]) }
+	wr.FixedSizeGroup(Int64Group, n)
+	for i := range xs[blocks/2:] { wr.Data(xs[i + blocks/2]) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd := MustOpen(fname)
+	defer rd.Close()
+
+	workers := 8
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			out := make([]int64, n)
+			for k := 0; k < 20; k++ {
+				for b := (w + k) % blocks; b < blocks; b += workers {
+					if err := rd.Data(b, out); err != nil {
+						errs <- err
+						return
+					} else if !int64sEq(out, xs[b]) {
+						errs <- fmt.Errorf("Wrote block %d = %d, but read " +
+							"%d.", b, xs[b], out)
+						return
+					}
+				}
+			}
+			errs <- nil
+		}(w)
+	}
+
+	for w := 0; w < workers; w++ {
+		if err := <-errs; err != nil { t.Error(err.Error()) }
 	}
-	return true
 }
 
-func float32sEq(x, y []float32, eps float32) bool {
-	if len(x) != len(y) { return false }
-	for i := range x {
-		if x[i] + eps < y[i] || x[i] - eps > y[i] { return false }
+func TestErrors(t *testing.T) {
+	fname := "../test_files/errors.test"
+
+	// Files which aren't minnow files.
+
+	if err := ioutil.WriteFile(fname, []byte("meow"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(fname); !errors.Is(err, ErrNotMinnow) {
+		t.Errorf("Expected ErrNotMinnow for a short file, got %v.", err)
+	}
+	if err := ioutil.WriteFile(fname, make([]byte, 100), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(fname); !errors.Is(err, ErrNotMinnow) {
+		t.Errorf("Expected ErrNotMinnow for an empty header, got %v.", err)
+	}
+
+	// Type mismatches.
+
+	wr, err := Create(fname)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{1, 2, 3}); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("Expected ErrNoGroup, got %v.", err)
+	}
+	if err := wr.IntGroup(3); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]float32{1, 2, 3}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	if _, err := wr.Data([]int64{1, 2, 3}); err != nil { t.Fatal(err) }
+	if _, err := wr.Header(int64(7)); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := Open(fname)
+	if err != nil { t.Fatal(err) }
+	if err := rd.Data(0, make([]float32, 3)); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	if err := rd.Data(0, make([]int64, 2)); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for a short buffer, got %v.", err)
+	}
+	if err := rd.Header(0, &[2]int64{}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for a header, got %v.", err)
+	}
+	for _, out := range []interface{}{ make([]complex64, 3), int64(0), nil } {
+		if err := rd.Data(0, out); !errors.Is(err, ErrTypeMismatch) {
+			t.Errorf("Expected ErrTypeMismatch for %T, got %v.", out, err)
+		}
+	}
+
+	// Out-of-range indices.
+
+	if _, err := rd.HeaderSize(1); err == nil {
+		t.Errorf("Expected error from HeaderSize(1).")
+	}
+	if _, err := rd.HeaderName(-1); err == nil {
+		t.Errorf("Expected error from HeaderName(-1).")
+	}
+	if _, err := rd.HeaderSchema(1); err == nil {
+		t.Errorf("Expected error from HeaderSchema(1).")
+	}
+	if _, err := rd.DataType(1); err == nil {
+		t.Errorf("Expected error from DataType(1).")
+	}
+	if _, err := rd.DataLen(-1); err == nil {
+		t.Errorf("Expected error from DataLen(-1).")
+	}
+	rd.Close()
+
+	wr, err = Create(fname)
+	if err != nil { t.Fatal(err) }
+	lim := [3][2]float64{ { 0, 1 }, { 0, 1 }, { 0, 1 } }
+	err = wr.VecGroup(Vec32Group, 1, lim, [3]float64{ 0.1, 0.1, 0.1 })
+	if err != nil { t.Fatal(err) }
+	_, err = wr.Data(make([]complex64, 1))
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for a vector, got %v.", err)
+	}
+	if err := wr.Abort(); err != nil { t.Fatal(err) }
+
+	// Truncated files.
+
+	data, err := ioutil.ReadFile(fname)
+	if err != nil { t.Fatal(err) }
+	err = ioutil.WriteFile(fname, data[:len(data) - 1], 0644)
+	if err != nil { t.Fatal(err) }
+	if _, err := Open(fname); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v.", err)
 	}
-	return true
 }
 
-func float64sExactEq(x, y []float64) bool {
-	if len(x) != len(y) { return false }
-	for i := range x {
-		if x[i] != y[i] { return false }
+func TestChecksums(t *testing.T) {
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Header(int64(7)); err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(4); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{1, 2, 3, 4}); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{5, 6, 7, 8}); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	if err := rd.Verify(); err != nil {
+		t.Errorf("Expected valid file to verify, got %v.", err)
 	}
-	return true
+
+	// Corrupt the last byte of the second block, which starts right before
+	// the tail.
+	data := buf.Bytes()
+	hd := &minnowHeader{ }
+	if err := binaryRead(bytes.NewReader(data), hd); err != nil {
+		t.Fatal(err)
+	}
+	data[hd.TailStart - 1] ^= 0xff
+
+	var csErr *ChecksumError
+	if err := rd.Verify(); !errors.As(err, &csErr) {
+		t.Fatalf("Expected *ChecksumError, got %v.", err)
+	} else if len(csErr.Headers) != 0 || len(csErr.Blocks) != 1 ||
+		csErr.Blocks[0] != 1 || !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected block 1 to be corrupt, got %v.", err)
+	}
+
+	out := make([]int64, 4)
+	if err := rd.Data(1, out); err != nil {
+		t.Errorf("Expected Data to ignore checksums by default, got %v.", err)
+	}
+	rd.VerifyOnRead(true)
+	if err := rd.Data(1, out); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected ErrChecksum from Data, got %v.", err)
+	}
+	if err := rd.Data(0, out); err != nil { t.Error(err) }
+	if err := rd.Header(0, new(int64)); err != nil { t.Error(err) }
+	data[hd.TailStart - 1] ^= 0xff
+
+	// Corrupt the tail.
+	data[hd.TailStart] ^= 0xff
+	if _, err := NewReader(buf); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected ErrChecksum for a corrupt tail, got %v.", err)
+	}
+}
+
+// TestCorruptTail checks that flipping any bit of a tail gives an error
+// instead of a panic or a huge allocation.
+func TestCorruptTail(t *testing.T) {
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.NamedHeader("x", int64(7)); err != nil {
+		t.Fatal(err)
+	}
+
+	lim := [3][2]float64{ { 0, 10 }, { 0, 10 }, { 0, 10 } }
+	groups := []func() error{
+		func() error { return wr.FixedSizeGroup(Int64Group, VariableLength) },
+		func() error { return wr.IntGroup(VariableLength) },
+		func() error { return wr.EntropyIntGroup(VariableLength) },
+		func() error { return wr.DeltaIntGroup(VariableLength) },
+		func() error { return wr.BytesGroup(VariableLength) },
+		func() error { return wr.BoolGroup(VariableLength) },
+		func() error {
+			return wr.LosslessFloatGroup(LosslessFloat32Group, VariableLength)
+		},
+		func() error {
+			return wr.EntropyFloatGroup(2, [2]float32{ 0, 10 }, 0.1)
+		},
+		func() error {
+			return wr.VecGroup(Vec32Group, 1, lim, [3]float64{ 1, 1, 1 })
+		},
+	}
+	blocks := []interface{}{
+		[]int64{ 1, 2 }, []int64{ 3, 4 }, []int64{ 5, 6 }, []int64{ 7, 8 },
+		[][]byte{ []byte("a"), []byte("bc") }, []bool{ true, false },
+		[]float32{ 1.5, 2.5 }, []float32{ 3.5, 4.5 },
+		[][3]float32{ { 1, 2, 3 } },
+	}
+	for i := range groups {
+		if err := groups[i](); err != nil { t.Fatal(err) }
+		if _, err := wr.Data(blocks[i]); err != nil { t.Fatal(err) }
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	data := buf.Bytes()
+	hd := &minnowHeader{ }
+	if err := binaryRead(bytes.NewReader(data), hd); err != nil {
+		t.Fatal(err)
+	}
+
+	// A corrupt length can make the tail run past its checksum, which looks
+	// the same as a truncated file.
+	for i := int(hd.TailStart); i < len(data); i++ {
+		for k := uint(0); k < 8; k++ {
+			data[i] ^= 1 << k
+			_, err := NewReader(buf)
+			if !errors.Is(err, ErrChecksum) && !errors.Is(err, ErrTruncated) {
+				t.Errorf("Expected ErrChecksum after flipping bit %d of " +
+					"byte %d, got %v.", k, i, err)
+			}
+			data[i] ^= 1 << k
+		}
+	}
+
+	// Without the checksum at the end of the file, the tail has to be parsed
+	// before it can be checked.
+	junk := NewBuffer(append(append([]byte{ }, data...), 1, 2, 3, 4, 5))
+	for i := int(hd.TailStart); i < len(data); i++ {
+		junk.Bytes()[i] ^= 0x40
+		if _, err := NewReader(junk); err == nil {
+			t.Errorf("Expected error after corrupting byte %d.", i)
+		}
+		junk.Bytes()[i] ^= 0x40
+	}
+	if _, err := NewReader(junk); err != nil { t.Error(err) }
+}
+
+// countingReader counts the bytes read from a Buffer.
+type countingReader struct {
+	*Buffer
+	n int64
+}
+
+func (r *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Buffer.ReadAt(p, off)
+	r.n += int64(n)
+	return n, err
+}
+
+func TestTailReads(t *testing.T) {
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	wr.IntGroup(3)
+	wr.Data([]int64{ 1, 2, 3 })
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	size := int64(buf.Len())
+
+	// Blocks from an append which was never closed follow the tail, but only
+	// the tail is read.
+	buf.Write(make([]byte, 1 << 20))
+	r := &countingReader{ Buffer: buf }
+	if _, err := NewReader(r); err != nil { t.Fatal(err) }
+	if r.n > 2*size + 4096 {
+		t.Errorf("Read %d bytes from a %d byte file.", r.n, size)
+	}
+}
+
+func TestBadLengths(t *testing.T) {
+	// Tails with valid checksums can still hold lengths which don't match
+	// their blocks.
+	for _, n := range []int64{ -1, 3, 1 << 62 } {
+		buf := NewBuffer(nil)
+		wr, err := NewWriter(buf)
+		if err != nil { t.Fatal(err) }
+		wr.FixedSizeGroup(Int64Group, VariableLength)
+		if _, err := wr.Data([]int64{ 1, 2 }); err != nil {
+			t.Fatal(err)
+		}
+		wr.writers[0].(*fixedSizeGroup).lengths[0] = n
+		if err := wr.Close(); err != nil { t.Fatal(err) }
+
+		if _, err := NewReader(buf); !errors.Is(err, ErrTruncated) {
+			t.Errorf("Expected ErrTruncated for length %d, got %v.", n, err)
+		}
+	}
+}
+
+func TestBadBits(t *testing.T) {
+	// Bit widths and lengths in the tails of delta and bytes groups are
+	// checked when the file is opened, even if the checksum matches.
+	tests := []struct{
+		name string
+		bits, n int64
+	}{
+		{ "negative bits", -1, 3 }, { "too many bits", 65, 3 },
+		{ "too many elements", 8, 1 << 40 },
+	}
+	groups := []struct{
+		name string
+		start func(wr *Writer) error
+		data interface{}
+		set func(g group, bits, n int64)
+	}{
+		{
+			"DeltaIntGroup",
+			func(wr *Writer) error { return wr.DeltaIntGroup(VariableLength) },
+			[]int64{ 1, 5, 2 },
+			func(g group, bits, n int64) {
+				g.(*deltaIntGroup).bits[0] = bits
+				g.(*deltaIntGroup).lengths[0] = n
+			},
+		},
+		{
+			"BytesGroup",
+			func(wr *Writer) error { return wr.BytesGroup(VariableLength) },
+			[]string{ "a", "bc", "def" },
+			func(g group, bits, n int64) {
+				g.(*bytesGroup).bits[0] = bits
+				g.(*bytesGroup).lengths[0] = n
+			},
+		},
+	}
+
+	for _, gt := range groups {
+		for _, test := range tests {
+			buf := NewBuffer(nil)
+			wr, err := NewWriter(buf)
+			if err != nil { t.Fatal(err) }
+			if err := gt.start(wr); err != nil { t.Fatal(err) }
+			if _, err := wr.Data(gt.data); err != nil { t.Fatal(err) }
+			gt.set(wr.writers[0], test.bits, test.n)
+			if err := wr.Close(); err != nil { t.Fatal(err) }
+
+			if _, err := NewReader(buf); !errors.Is(err, ErrTruncated) {
+				t.Errorf("%s, %s: expected ErrTruncated, got %v.",
+					gt.name, test.name, err)
+			}
+		}
+	}
+}
+
+// TestVersion1 checks that files written by version 1 of the format can still
+// be read. testdata/v1.minw was written by the version 1 Writer and must never
+// be regenerated.
+func TestVersion1(t *testing.T) {
+	rd, err := Open("testdata/v1.minw")
+	if err != nil { t.Fatal(err) }
+	defer rd.Close()
+
+	if rd.Version() != 1 {
+		t.Errorf("Expected version 1, got %d.", rd.Version())
+	}
+	if err := rd.Verify(); !errors.Is(err, ErrVersion) {
+		t.Errorf("Expected ErrVersion from Verify, got %v.", err)
+	}
+	rd.VerifyOnRead(true)
+
+	hd := struct{ A int64; B float64 }{ }
+	if err := rd.Header(0, &hd); err != nil { t.Fatal(err) }
+	if hd.A != 7 || hd.B != 2.5 {
+		t.Errorf("Expected header {7 2.5}, got %v.", hd)
+	}
+	size, err := rd.HeaderSize(1)
+	if err != nil { t.Fatal(err) }
+	text := make([]byte, size)
+	if err := rd.Header(1, text); err != nil { t.Fatal(err) }
+	if string(text) != "version 1" {
+		t.Errorf("Expected header 'version 1', got '%s'.", text)
+	}
+
+	if rd.Blocks() != 5 { t.Fatalf("Expected 5 blocks, got %d.", rd.Blocks()) }
+
+	i32 := make([]int32, 5)
+	for b, exp := range [][]int32{ {1, -2, 3, -4, 5}, {6, 7, 8, 9, 10} } {
+		if err := rd.Data(b, i32); err != nil { t.Fatal(err) }
+		if !int32sEq(i32, exp) {
+			t.Errorf("Expected block %d to be %d, got %d.", b, exp, i32)
+		}
+	}
+	i64 := make([]int64, 4)
+	for b, exp := range [][]int64{ {100, 101, 103, 107}, {-5, -5, -5, -5} } {
+		if err := rd.Data(b + 2, i64); err != nil { t.Fatal(err) }
+		if !int64sEq(i64, exp) {
+			t.Errorf("Expected block %d to be %d, got %d.", b + 2, exp, i64)
+		}
+	}
+	f32, exp := make([]float32, 4), []float32{ 0.5, 25.25, 50, 99.99 }
+	if err := rd.Data(4, f32); err != nil { t.Fatal(err) }
+	if !float32sEq(f32, exp, 0.01) {
+		t.Errorf("Expected block 4 to be %g, got %g.", exp, f32)
+	}
+}
+
+func TestUnknownVersion(t *testing.T) {
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	data := buf.Bytes()
+	data[8] = Version + 1
+	if _, err := NewReader(buf); !errors.Is(err, ErrVersion) {
+		t.Errorf("Expected ErrVersion, got %v.", err)
+	}
+}
+
+func TestEntropyGroups(t *testing.T) {
+	// Geometrically distributed values, like halo particle counts.
+	N := 10000
+	skewed := make([]int64, N)
+	for i := range skewed {
+		skewed[i] = 20 + int64(rand.ExpFloat64()*3)
+	}
+	skewed[17] = 1 << 50
+	blocks := [][]int64{ skewed, make([]int64, N) }
+	for i := range blocks[1] { blocks[1][i] = -7 }
+
+	floats := make([]float32, N)
+	for i := range floats { floats[i] = float32(rand.ExpFloat64()) }
+
+	sizes := []int{ }
+	for _, entropy := range []bool{ false, true } {
+		buf := NewBuffer(nil)
+		wr, err := NewWriter(buf)
+		if err != nil { t.Fatal(err) }
+		if entropy {
+			err = wr.EntropyIntGroup(N)
+		} else {
+			err = wr.IntGroup(N)
+		}
+		if err != nil { t.Fatal(err) }
+		for _, x := range blocks {
+			if _, err := wr.Data(x); err != nil { t.Fatal(err) }
+		}
+		size, err := wr.tell()
+		if err != nil { t.Fatal(err) }
+		sizes = append(sizes, int(size))
+
+		if entropy {
+			err = wr.EntropyFloatGroup(N, [2]float32{0, 100}, 0.01)
+			if err != nil { t.Fatal(err) }
+			if _, err := wr.Data(floats); err != nil { t.Fatal(err) }
+		}
+		if err := wr.Close(); err != nil { t.Fatal(err) }
+
+		rd, err := NewReader(buf)
+		if err != nil { t.Fatal(err) }
+		out := make([]int64, N)
+		for b := range blocks {
+			if err := rd.Data(b, out); err != nil { t.Fatal(err) }
+			if !int64sEq(out, blocks[b]) {
+				t.Errorf("entropy = %v: block %d read incorrectly.", entropy, b)
+			}
+		}
+		if entropy {
+			if gt, err := rd.DataType(2); err != nil ||
+				gt != EntropyFloatGroup {
+				t.Errorf("Expected EntropyFloatGroup, got %d and %v.",
+					gt, err)
+			}
+			fOut := make([]float32, N)
+			if err := rd.Data(2, fOut); err != nil { t.Fatal(err) }
+			if !float32sEq(fOut, floats, 0.01) {
+				t.Errorf("Float block read incorrectly.")
+			}
+		}
+	}
+
+	if sizes[1] >= sizes[0] {
+		t.Errorf("Entropy coded blocks have size %d, but bit-packed blocks " +
+			"have size %d.", sizes[1], sizes[0])
+	}
+}
+
+func TestFloatOptions(t *testing.T) {
+	lim, dx := [2]float32{0, 10}, float32(0.01)
+	x := []float32{ -1, 0.5, 9.995, 12 }
+	nonPeriodic := []float32{ 0, 0.5, 9.995, 10 }
+	periodic := []float32{ 9, 0.5, 9.995, 2 }
+	logX := []float32{ 1e3, 2e5, 5e8, 1e9 }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	err = wr.FloatGroup(4, lim, dx)
+	if err == nil { _, err = wr.Data(x) }
+	if err == nil { err = wr.FloatGroup(4, lim, dx, NonPeriodic()) }
+	if err == nil { _, err = wr.Data(x) }
+	if err == nil {
+		err = wr.EntropyFloatGroup(4, lim, dx, Linear(), Log(), NonPeriodic())
+	}
+	if err == nil { _, err = wr.Data(logX) }
+	if err == nil { err = wr.Close() }
+	if err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	flags := []uint8{ floatPeriodic, 0, floatLog }
+	for i := range flags {
+		if f := rd.readers[i].(*floatGroup).flags; f != flags[i] {
+			t.Errorf("Expected group %d to have flags %b, got %b.",
+				i, flags[i], f)
+		}
+	}
+
+	out := make([]float32, 4)
+	for b, exp := range [][]float32{ periodic, nonPeriodic } {
+		if err := rd.Data(b, out); err != nil { t.Fatal(err) }
+		for i := range out {
+			// Values at the edges of a periodic box can land on either side.
+			d := out[i] - exp[i]
+			if b == 0 && d > 5 { d -= 10 }
+			if b == 0 && d < -5 { d += 10 }
+			if d > dx || d < -dx {
+				t.Errorf("%d) Expected %g, got %g.", b, exp, out)
+				break
+			}
+		}
+	}
+
+	if err := rd.Data(2, out); err != nil { t.Fatal(err) }
+	for i := range out {
+		if r := out[i] / logX[i]; r < 0.97 || r > 1.03 {
+			t.Errorf("Expected %g, got %g.", logX, out)
+			break
+		}
+	}
+}
+
+// TestUnquantizable checks that values which can't be placed in a cell are
+// read back as the lower limit of the group.
+func TestUnquantizable(t *testing.T) {
+	nan, inf := float32(math.NaN()), float32(math.Inf(1))
+	lim, dx := [2]float32{ 0, 4 }, float32(0.5)
+	vlim := [3][2]float64{ { 0, 4 }, { 0, 4 }, { 0, 4 } }
+	vdx := [3]float64{ 0.5, 0.5, 0.5 }
+
+	tests := []struct{
+		opts []FloatOption
+		x, exp []float32
+	}{
+		{
+			[]FloatOption{ Log(), Periodic() },
+			[]float32{ 0, -1, nan, 100 }, []float32{ 1, 1, 1, 100 },
+		},
+		{
+			[]FloatOption{ Log(), NonPeriodic() },
+			[]float32{ 0, -1, nan, 100 }, []float32{ 1, 1, 1, 100 },
+		},
+		{
+			[]FloatOption{ Periodic() },
+			[]float32{ nan, inf, -inf, 2.5 }, []float32{ 0, 0, 0, 2.5 },
+		},
+		{
+			[]FloatOption{ NonPeriodic() },
+			[]float32{ nan, inf, -inf, 2.5 }, []float32{ 0, 3.5, 0, 2.5 },
+		},
+	}
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	for _, test := range tests {
+		opts := append([]FloatOption{ Dequantize(LowerEdge) }, test.opts...)
+		vec := make([][3]float32, len(test.x))
+		for i := range vec { vec[i] = [3]float32{ test.x[i], 1, 1 } }
+
+		err = wr.FloatGroup(len(test.x), lim, dx, opts...)
+		if err == nil { _, err = wr.Data(test.x) }
+		if err == nil {
+			err = wr.VecGroup(Vec32Group, len(vec), vlim, vdx, opts...)
+		}
+		if err == nil { _, err = wr.Data(vec) }
+		if err != nil { t.Fatal(err) }
+	}
+	// Periodic values far outside the limits are wrapped, too.
+	err = wr.FloatGroup(2, lim, dx, Dequantize(LowerEdge))
+	if err == nil { _, err = wr.Data([]float32{ 1e30, -1e30 }) }
+	if err == nil { err = wr.Close() }
+	if err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	for i, test := range tests {
+		out := make([]float32, len(test.x))
+		vec := make([][3]float32, len(test.x))
+		if err := rd.Data(2*i, out); err != nil { t.Fatal(err) }
+		if err := rd.Data(2*i + 1, vec); err != nil { t.Fatal(err) }
+		for j := range out {
+			if !float32sEq(out[j:j+1], test.exp[j:j+1], 1e-3*test.exp[j]) {
+				t.Errorf("%d) Expected %g for %g, got %g.",
+					i, test.exp[j], test.x[j], out[j])
+			}
+			if !float32sEq(vec[j][:1], test.exp[j:j+1], 1e-3*test.exp[j]) {
+				t.Errorf("%d) Expected vector component %g for %g, got %g.",
+					i, test.exp[j], test.x[j], vec[j][0])
+			}
+		}
+	}
+
+	out := make([]float32, 2)
+	if err := rd.Data(2*len(tests), out); err != nil { t.Fatal(err) }
+	for j := range out {
+		if !(out[j] >= lim[0] && out[j] < lim[1]) {
+			t.Errorf("Expected wrapped value in [%g, %g), got %g.",
+				lim[0], lim[1], out[j])
+		}
+	}
+}
+
+func TestDequantization(t *testing.T) {
+	lim, dx := [2]float32{0, 10}, float32(1)
+	x := []float32{ 0.5, 1.2, 3.7, 9.9 }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	err = wr.FloatGroup(4, lim, dx, NonPeriodic())
+	if err == nil { _, err = wr.Data(x) }
+	if err == nil { _, err = wr.Data(x) }
+	if err == nil { err = wr.FloatGroup(4, lim, dx, Dequantize(Midpoint)) }
+	if err == nil { _, err = wr.Data(x) }
+	if err == nil { err = wr.Close() }
+	if err != nil { t.Fatal(err) }
+
+	read := func(rd *Reader, b int) []float32 {
+		out := make([]float32, 4)
+		if err := rd.Data(b, out); err != nil { t.Fatal(err) }
+		return out
+	}
+
+	rd1, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	rd2, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+
+	// Dithering is reproducible, but differs between blocks.
+	d1, d2 := read(rd1, 0), read(rd2, 0)
+	if !float32sEq(d1, d2, 0) {
+		t.Errorf("Dithered reads differ: %g vs %g.", d1, d2)
+	}
+	if float32sEq(d1, read(rd1, 1), 0) {
+		t.Errorf("Blocks 0 and 1 have identical dithering.")
+	}
+	if !float32sEq(d1, []float32{ 0.5, 1.5, 3.5, 9.5 }, 0.5) {
+		t.Errorf("Dithered values %g are outside their cells.", d1)
+	}
+
+	midpoint := []float32{ 0.5, 1.5, 3.5, 9.5 }
+	if out := read(rd1, 2); !float32sEq(out, midpoint, 0) {
+		t.Errorf("Expected midpoints %g, got %g.", midpoint, out)
+	}
+
+	rd1.SetDequantization(LowerEdge)
+	lower := []float32{ 0, 1, 3, 9 }
+	for b := 0; b < 3; b++ {
+		if out := read(rd1, b); !float32sEq(out, lower, 0) {
+			t.Errorf("%d) Expected lower edges %g, got %g.", b, lower, out)
+		}
+	}
+}
+
+func TestDeltaIntGroup(t *testing.T) {
+	N := 1000
+	sorted, shuffled := make([]int64, N), make([]int64, N)
+	for i := range sorted { sorted[i] = 1 << 40 + int64(3*i + rand.Intn(3)) }
+	for i, j := range rand.Perm(N) { shuffled[i] = sorted[j] }
+	nearlySorted := append([]int64{ }, sorted...)
+	nearlySorted[10], nearlySorted[11] = nearlySorted[11], nearlySorted[10]
+	extreme := make([]int64, N)
+	for i := range extreme {
+		extreme[i] = math.MaxInt64
+		if i % 2 == 1 { extreme[i] = math.MinInt64 }
+	}
+	blocks := [][]int64{ sorted, shuffled, nearlySorted, extreme, make([]int64, N) }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if err := wr.DeltaIntGroup(N); err != nil { t.Fatal(err) }
+	for _, x := range blocks {
+		if _, err := wr.Data(x); err != nil { t.Fatal(err) }
+	}
+	if err := wr.DeltaIntGroup(0); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ }); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	g := rd.readers[0].(*deltaIntGroup)
+	// The differences in the extreme block wrap around to +/-1.
+	modes := []uint8{ deltaMode, offsetMode, deltaMode, deltaMode, offsetMode }
+	for b := range blocks {
+		out := make([]int64, N)
+		if err := rd.Data(b, out); err != nil { t.Fatal(err) }
+		if !int64sEq(out, blocks[b]) {
+			t.Errorf("Block %d read incorrectly.", b)
+		}
+		if g.modes[b] != modes[b] {
+			t.Errorf("Expected block %d to have mode %d, got %d.",
+				b, modes[b], g.modes[b])
+		}
+	}
+	if g.blockSize(0) >= g.blockSize(1) {
+		t.Errorf("Sorted block has size %d, but shuffled block has size %d.",
+			g.blockSize(0), g.blockSize(1))
+	}
+	if err := rd.Data(len(blocks), []int64{ }); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLosslessFloatGroup(t *testing.T) {
+	N := 1000
+	f64 := make([]float64, N)
+	for i := range f64 { f64[i] = 1 / (1 + float64(i)/float64(N)) }
+	special := []float64{
+		0, math.Copysign(0, -1), math.Inf(1), math.Inf(-1), math.NaN(),
+		math.SmallestNonzeroFloat64, math.MaxFloat64, -1e-300,
+	}
+	copy(f64[100:], special)
+	f32 := make([]float32, N)
+	for i := range f32 { f32[i] = float32(f64[i]) }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if err := wr.LosslessFloatGroup(Float64Group, N);
+		!errors.Is(err, ErrUnknownGroup) {
+		t.Errorf("Expected ErrUnknownGroup, got %v.", err)
+	}
+	err = wr.LosslessFloatGroup(LosslessFloat64Group, N)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data(f64); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(f32); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	err = wr.LosslessFloatGroup(LosslessFloat32Group, N)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data(f32); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	out64, out32 := make([]float64, N), make([]float32, N)
+	if err := rd.Data(0, out64); err != nil { t.Fatal(err) }
+	if err := rd.Data(1, out32); err != nil { t.Fatal(err) }
+	for i := range out64 {
+		if math.Float64bits(out64[i]) != math.Float64bits(f64[i]) {
+			t.Errorf("Expected float64 %d to be %g, got %g.", i, f64[i], out64[i])
+		}
+		if math.Float32bits(out32[i]) != math.Float32bits(f32[i]) {
+			t.Errorf("Expected float32 %d to be %g, got %g.", i, f32[i], out32[i])
+		}
+	}
+
+	g := rd.readers[0].(*losslessFloatGroup)
+	if size := g.blockSize(0); size >= int64(8*N) {
+		t.Errorf("float64 block has size %d, not less than %d.", size, 8*N)
+	}
+}
+
+// varintGroup is a user-defined group which stores []int64 blocks as varints.
+type varintGroup struct {
+	lengths, offsets []int64
+}
+
+// panicGroup is a varintGroup whose BlockSize always panics.
+type panicGroup struct {
+	*varintGroup
+}
+
+func (g *panicGroup) BlockSize(b int) int64 { panic("corrupt block") }
+
+const (
+	varintGroupType = MinUserGroup + 1
+	panicGroupType = MinUserGroup + 3
+)
+
+func readVarintGroup(tail io.Reader) (*varintGroup, error) {
+	var blocks int64
+	if err := binaryRead(tail, &blocks); err != nil { return nil, err }
+	g := &varintGroup{
+		make([]int64, blocks), make([]int64, blocks + 1),
+	}
+	if err := binaryRead(tail, g.lengths); err != nil { return nil, err }
+	if err := binaryRead(tail, g.offsets); err != nil { return nil, err }
+	return g, nil
+}
+
+func init() {
+	RegisterGroup(varintGroupType, func(tail io.Reader) (Group, error) {
+		return readVarintGroup(tail)
+	})
+	RegisterGroup(panicGroupType, func(tail io.Reader) (Group, error) {
+		g, err := readVarintGroup(tail)
+		if err != nil { return nil, err }
+		return &panicGroup{ g }, nil
+	})
+}
+
+func (g *varintGroup) Blocks() int { return len(g.lengths) }
+
+func (g *varintGroup) Length(b int) int { return int(g.lengths[b]) }
+
+func (g *varintGroup) WriteData(f io.Writer, x interface{}) error {
+	xx, ok := x.([]int64)
+	if !ok { return fmt.Errorf("%w: got %T", ErrTypeMismatch, x) }
+
+	buf := make([]byte, binary.MaxVarintLen64*len(xx))
+	n := 0
+	for i := range xx { n += binary.PutVarint(buf[n:], xx[i]) }
+	if _, err := f.Write(buf[:n]); err != nil { return err }
+
+	if len(g.offsets) == 0 { g.offsets = []int64{0} }
+	g.lengths = append(g.lengths, int64(len(xx)))
+	g.offsets = append(g.offsets, g.offsets[len(g.offsets) - 1] + int64(n))
+	return nil
+}
+
+func (g *varintGroup) WriteTail(f io.Writer) error {
+	if err := binaryWrite(f, int64(len(g.lengths))); err != nil { return err }
+	if err := binaryWrite(f, g.lengths); err != nil { return err }
+	return binaryWrite(f, g.offsets)
+}
+
+func (g *varintGroup) BlockOffset(b int) int64 { return g.offsets[b] }
+
+func (g *varintGroup) BlockSize(b int) int64 {
+	return g.offsets[b + 1] - g.offsets[b]
+}
+
+func (g *varintGroup) ReadData(data []byte, b int, x interface{}) error {
+	xx, ok := x.([]int64)
+	if !ok { return fmt.Errorf("%w: got %T", ErrTypeMismatch, x) }
+	for i := 0; i < g.Length(b); i++ {
+		var n int
+		xx[i], n = binary.Varint(data)
+		data = data[n:]
+	}
+	return nil
+}
+
+func TestUserGroup(t *testing.T) {
+	blocks := [][]int64{ {1, -1, 1000000}, {}, {7, 8, 9, 10} }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(2); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{3, 4}); err != nil { t.Fatal(err) }
+	if err := wr.Group(varintGroupType + 1, &varintGroup{ });
+		!errors.Is(err, ErrUnknownGroup) {
+		t.Errorf("Expected ErrUnknownGroup, got %v.", err)
+	}
+	if err := wr.Group(varintGroupType, &varintGroup{ }); err != nil {
+		t.Fatal(err)
+	}
+	for i := range blocks {
+		if _, err := wr.Data(blocks[i]); err != nil { t.Fatal(err) }
+	}
+	if _, err := wr.Data([]int32{1}); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	if err := rd.Verify(); err != nil { t.Error(err) }
+	for i := range blocks {
+		if gt, _ := rd.DataType(i + 1); gt != varintGroupType {
+			t.Errorf("Expected block %d to have type %d, got %d.",
+				i + 1, varintGroupType, gt)
+		}
+		n, err := rd.DataLen(i + 1)
+		if err != nil { t.Fatal(err) }
+		out := make([]int64, n)
+		if err := rd.Data(i + 1, out); err != nil { t.Fatal(err) }
+		if !int64sEq(out, blocks[i]) {
+			t.Errorf("Expected block %d to be %d, got %d.", i + 1, blocks[i], out)
+		}
+	}
+
+	// Files with unregistered groups are intact, so they aren't reported as
+	// corrupt, unless their tails can't be checked.
+	buf = NewBuffer(nil)
+	wr, err = NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	wr.Group(varintGroupType, &varintGroup{ })
+	wr.Data(blocks[0])
+	wr.writers[0].(*userGroup).gt = varintGroupType + 1
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	_, err = NewReader(buf)
+	if !errors.Is(err, ErrUnknownGroup) || errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected only ErrUnknownGroup, got %v.", err)
+	}
+	buf.Write([]byte("junk"))
+	_, err = NewReader(buf)
+	if !errors.Is(err, ErrUnknownGroup) || !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected ErrUnknownGroup and ErrChecksum, got %v.", err)
+	}
+
+	// User groups whose tails don't match the file return errors instead of
+	// panicking, even if they have valid checksums.
+	corrupt := []struct{
+		name string
+		f func(g *varintGroup)
+		gt int64
+	}{
+		{ "extra block", func(g *varintGroup) {
+			g.lengths = append(g.lengths, 1)
+			g.offsets = append(g.offsets, g.offsets[len(g.offsets) - 1] + 1)
+		}, varintGroupType },
+		{ "missing offset", func(g *varintGroup) {
+			g.offsets = g.offsets[:len(g.offsets) - 1]
+		}, varintGroupType },
+		{ "negative length", func(g *varintGroup) {
+			g.lengths[0] = -1
+		}, varintGroupType },
+		{ "panic", func(g *varintGroup) { }, panicGroupType },
+	}
+	for _, c := range corrupt {
+		buf = NewBuffer(nil)
+		wr, err = NewWriter(buf)
+		if err != nil { t.Fatal(err) }
+		vg := &varintGroup{ }
+		wr.Group(varintGroupType, vg)
+		wr.Data(blocks[0])
+		c.f(vg)
+		wr.writers[0].(*userGroup).gt = c.gt
+		if err := wr.Close(); err != nil { t.Fatal(err) }
+		if _, err = NewReader(buf); err == nil {
+			t.Errorf("%s: expected error from NewReader.", c.name)
+		}
+	}
+
+	for _, id := range []int64{ IntGroup, varintGroupType } {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected RegisterGroup(%d) to panic.", id)
+				}
+			}()
+			RegisterGroup(id, nil)
+		}()
+	}
+}
+
+func TestVariableLength(t *testing.T) {
+	lengths := []int{ 5, 0, 1000, 1, 37 }
+	ix, fx := make([][]int64, len(lengths)), make([][]float32, len(lengths))
+	for i, n := range lengths {
+		ix[i], fx[i] = make([]int64, n), make([]float32, n)
+		for j := range ix[i] {
+			ix[i][j] = int64(3*j + i*i)
+			fx[i][j] = float32(j % 100) + 0.5
+		}
+	}
+
+	groups := []func(wr *Writer) error{
+		func(wr *Writer) error {
+			return wr.FixedSizeGroup(Int64Group, VariableLength)
+		},
+		func(wr *Writer) error { return wr.IntGroup(VariableLength) },
+		func(wr *Writer) error { return wr.EntropyIntGroup(VariableLength) },
+		func(wr *Writer) error { return wr.DeltaIntGroup(VariableLength) },
+		func(wr *Writer) error {
+			return wr.LosslessFloatGroup(LosslessFloat32Group, VariableLength)
+		},
+		func(wr *Writer) error {
+			return wr.FloatGroup(VariableLength, [2]float32{ 0, 100 }, 0.01)
+		},
+		func(wr *Writer) error {
+			return wr.EntropyFloatGroup(VariableLength,
+				[2]float32{ 0, 100 }, 0.01, NonPeriodic())
+		},
+	}
+	isFloat := []bool{ false, false, false, false, true, true, true }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	for i := range groups {
+		if err := groups[i](wr); err != nil { t.Fatal(err) }
+		for j := range lengths {
+			if isFloat[i] {
+				_, err = wr.Data(fx[j])
+			} else {
+				_, err = wr.Data(ix[j])
+			}
+			if err != nil { t.Fatalf("group %d, block %d: %v", i, j, err) }
+		}
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	for i := range groups {
+		for j, n := range lengths {
+			b := i*len(lengths) + j
+			if m, err := rd.DataLen(b); err != nil || m != n {
+				t.Errorf("Expected block %d to have length %d, got %d " +
+					"and %v.", b, n, m, err)
+			}
+			if isFloat[i] {
+				out := make([]float32, n)
+				if err := rd.Data(b, out); err != nil { t.Fatal(err) }
+				if !float32sEq(out, fx[j], 0.01) {
+					t.Errorf("Expected block %d to be %.3g, got %.3g.",
+						b, fx[j], out)
+				}
+			} else {
+				out := make([]int64, n)
+				if err := rd.Data(b, out); err != nil { t.Fatal(err) }
+				if !int64sEq(out, ix[j]) {
+					t.Errorf("Expected block %d to be %d, got %d.",
+						b, ix[j], out)
+				}
+			}
+		}
+	}
+
+	// Fixed-length groups still reject blocks of the wrong length.
+	wr, err = NewWriter(NewBuffer(nil))
+	if err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(5); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(ix[2]); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+}
+
+func TestBytesGroup(t *testing.T) {
+	names := []string{
+		"", "Rockstar", "consistent-trees", "Rockstar", "",
+		"/path/to/trees/tree_0_0_0.dat", "/path/to/trees/tree_0_0_1.dat",
+		string([]byte{ 0, 255, 0, 255 }),
+	}
+	raw := make([][]byte, len(names))
+	for i := range names { raw[i] = []byte(names[i]) }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if err := wr.BytesGroup(len(names)); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(names); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(raw); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 1 }); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	if _, err := wr.Data(names[:3]); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	err = wr.BytesGroup(VariableLength)
+	if err != nil { t.Fatal(err) }
+	for _, x := range [][]string{ names[:3], { }, { "", "" } } {
+		if _, err := wr.Data(x); err != nil { t.Fatal(err) }
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	expected := [][]string{ names, names, names[:3], { }, { "", "" } }
+	for b := range expected {
+		str, byt := make([]string, len(expected[b])), make([][]byte, 100)
+		if err := rd.Data(b, str); err != nil { t.Fatal(err) }
+		if err := rd.Data(b, byt); err != nil { t.Fatal(err) }
+		for i := range expected[b] {
+			if str[i] != expected[b][i] || string(byt[i]) != expected[b][i] {
+				t.Errorf("Expected element %d of block %d to be %q, got " +
+					"%q and %q.", i, b, expected[b][i], str[i], byt[i])
+			}
+		}
+	}
+	if err := rd.Data(0, make([]float32, len(names)));
+		!errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+
+	// Corrupt element lengths are caught before the payload is allocated.
+	g := newBytesGroup(0, 2)
+	block := &bytes.Buffer{ }
+	err = g.writeData(block, []string{ "ab", "c" })
+	if err != nil { t.Fatal(err) }
+	data := block.Bytes()
+	data[0] = 0xff
+	if err := g.readData(data, 0, make([]string, 2));
+		!errors.Is(err, lz.ErrCorrupt) {
+		t.Errorf("Expected lz.ErrCorrupt, got %v.", err)
+	}
+}
+
+func TestFlagGroups(t *testing.T) {
+	N := 77
+	flags, masks, wide := make([]bool, N), make([]uint64, N), make([]uint64, N)
+	for i := range flags {
+		flags[i] = i % 3 == 0 || i % 7 == 0
+		masks[i] = uint64(i*i) % 32
+		wide[i] = uint64(i) * 0x9e3779b97f4a7c15
+	}
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if err := wr.BitmaskGroup(N, 0); err == nil {
+		t.Errorf("Expected error for 0-bit BitmaskGroup.")
+	}
+	if err := wr.BoolGroup(N); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(flags); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(masks); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	if err := wr.BitmaskGroup(N, 5); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(masks); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(wide); err == nil {
+		t.Errorf("Expected error for mask wider than 5 bits.")
+	}
+	if err := wr.BitmaskGroup(VariableLength, 64); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wr.Data(wide); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(wide[:10]); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	if size := rd.readers[0].blockSize(0); size != int64((N + 7) / 8) {
+		t.Errorf("Expected bool block to have size %d, got %d.",
+			(N + 7) / 8, size)
+	}
+	flagOut := make([]bool, N)
+	if err := rd.Data(0, flagOut); err != nil { t.Fatal(err) }
+	for i := range flags {
+		if flagOut[i] != flags[i] {
+			t.Errorf("Expected flag %d to be %t, got %t.", i, flags[i],
+				flagOut[i])
+		}
+	}
+	for b, x := range [][]uint64{ masks, wide, wide[:10] } {
+		out := make([]uint64, len(x))
+		if err := rd.Data(b + 1, out); err != nil { t.Fatal(err) }
+		for i := range x {
+			if out[i] != x[i] {
+				t.Errorf("Expected element %d of block %d to be %x, got %x.",
+					i, b + 1, x[i], out[i])
+			}
+		}
+	}
+}
+
+func TestVecGroup(t *testing.T) {
+	N := 500
+	pos32, vel64 := make([][3]float32, N), make([][3]float64, N)
+	for i := range pos32 {
+		pos32[i] = [3]float32{
+			float32(i) / 5, 100 - float32(i) / 5, float32(i % 10) + 99.5,
+		}
+		vel64[i] = [3]float64{
+			float64(i) - 250, 1e-3*float64(i), 1e6 + 1e-5*float64(i),
+		}
+	}
+	posLim := [3][2]float64{ { 0, 100 }, { 0, 100 }, { 0, 100 } }
+	posDx := [3]float64{ 0.01, 0.01, 0.01 }
+	velLim := [3][2]float64{ { -1000, 1000 }, { 0, 1 }, { 1e6, 1e6 + 1 } }
+	velDx := [3]float64{ 0.1, 1e-4, 1e-6 }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	err = wr.VecGroup(FloatGroup, N, posLim, posDx)
+	if !errors.Is(err, ErrUnknownGroup) {
+		t.Errorf("Expected ErrUnknownGroup, got %v.", err)
+	}
+	if err := wr.VecGroup(Vec32Group, N, posLim, posDx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wr.Data(pos32); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(vel64); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	err = wr.VecGroup(Vec64Group, VariableLength, velLim, velDx, NonPeriodic())
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data(vel64); err != nil { t.Fatal(err) }
+	if _, err := wr.Data(vel64[:7]); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	posOut := make([][3]float32, N)
+	if err := rd.Data(0, posOut); err != nil { t.Fatal(err) }
+	for i := range pos32 {
+		for k := 0; k < 3; k++ {
+			// Positions are periodic, so 99.5 to 100.5 wraps around.
+			want := pos32[i][k]
+			if want >= 100 { want -= 100 }
+			if d := posOut[i][k] - want; d > 0.01 || d < -0.01 {
+				t.Errorf("Expected pos[%d][%d] = %g, got %g.", i, k,
+					want, posOut[i][k])
+			}
+		}
+	}
+
+	rd.SetDequantization(Midpoint)
+	for b, n := range []int{ N, 7 } {
+		velOut := make([][3]float64, n)
+		if err := rd.Data(b + 1, velOut); err != nil { t.Fatal(err) }
+		for i := range velOut {
+			for k := 0; k < 3; k++ {
+				if d := velOut[i][k] - vel64[i][k]; math.Abs(d) > velDx[k] {
+					t.Errorf("Expected vel[%d][%d] = %.10g, got %.10g.", i, k,
+						vel64[i][k], velOut[i][k])
+				}
+			}
+		}
+	}
+}
+
+// TestDitherCopy checks that dithered blocks decode to exactly the same values
+// after they're copied to a different position in another file.
+func TestDitherCopy(t *testing.T) {
+	fx := [][]float32{ { 1.25, 2.5, 3.75, 9.9 }, { 0.1, 0.2, 0.3, 0.4 } }
+	vec := [][3]float32{ { 1, 2, 3 }, { 4, 5, 6 } }
+	lim := [3][2]float64{ { 0, 10 }, { 0, 10 }, { 0, 10 } }
+	dx := [3]float64{ 0.5, 0.5, 0.5 }
+
+	src := NewBuffer(nil)
+	wr, err := NewWriter(src)
+	if err != nil { t.Fatal(err) }
+	wr.IntGroup(2)
+	wr.Data([]int64{ 1, 2 })
+	wr.FloatGroup(len(fx[0]), [2]float32{ 0, 10 }, 0.5)
+	for _, x := range fx { wr.Data(x) }
+	wr.VecGroup(Vec32Group, len(vec), lim, dx)
+	wr.Data(vec)
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	srcRd, err := NewReader(src)
+	if err != nil { t.Fatal(err) }
+
+	dst := NewBuffer(nil)
+	wr, err = NewWriter(dst)
+	if err != nil { t.Fatal(err) }
+	for _, i := range []int{ 2, 1 } {
+		if err := wr.CopyGroup(srcRd, i); err != nil { t.Fatal(err) }
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	dstRd, err := NewReader(dst)
+	if err != nil { t.Fatal(err) }
+
+	// Blocks 1 and 2 of src are blocks 1 and 2 of dst, and block 3 of src is
+	// block 0 of dst.
+	for b := range fx {
+		exp, out := make([]float32, len(fx[b])), make([]float32, len(fx[b]))
+		if err := srcRd.Data(b + 1, exp); err != nil { t.Fatal(err) }
+		if err := dstRd.Data(b + 1, out); err != nil { t.Fatal(err) }
+		for i := range exp {
+			if math.Float32bits(exp[i]) != math.Float32bits(out[i]) {
+				t.Errorf("Expected element %d of float block %d to be %g " +
+					"after copying, got %g.", i, b, exp[i], out[i])
+			}
+		}
+	}
+
+	exp, out := make([][3]float32, len(vec)), make([][3]float32, len(vec))
+	if err := srcRd.Data(3, exp); err != nil { t.Fatal(err) }
+	if err := dstRd.Data(0, out); err != nil { t.Fatal(err) }
+	for i := range exp {
+		for k := 0; k < 3; k++ {
+			if math.Float32bits(exp[i][k]) != math.Float32bits(out[i][k]) {
+				t.Errorf("Expected vec[%d][%d] to be %g after copying, got " +
+					"%g.", i, k, exp[i][k], out[i][k])
+			}
+		}
+	}
+}
+
+func TestCopyGroup(t *testing.T) {
+	x1, x2 := []int64{ 5, 7, 9, 1000 }, []int64{ -3, 4 }
+	x3 := []float64{ 1.5, -2.5, 1e10 }
+	vec := [][3]float32{ { 1, 2, 3 }, { 4, 5, 6 } }
+	lim := [3][2]float64{ { 0, 10 }, { 0, 10 }, { 0, 10 } }
+	dx := [3]float64{ 1e-3, 1e-3, 1e-3 }
+
+	src := NewBuffer(nil)
+	wr, err := NewWriter(src)
+	if err != nil { t.Fatal(err) }
+	wr.IntGroup(VariableLength)
+	wr.Data(x1)
+	wr.Data(x2)
+	wr.FixedSizeGroup(Float64Group, len(x3))
+	wr.Data(x3)
+	wr.VecGroup(Vec32Group, len(vec), lim, dx)
+	wr.Data(vec)
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	srcRd, err := NewReader(src)
+	if err != nil { t.Fatal(err) }
+
+	// The header leaves the file unaligned, so the fixed size group has to be
+	// padded.
+	dst := NewBuffer(nil)
+	wr, err = NewWriter(dst)
+	if err != nil { t.Fatal(err) }
+	wr.Header([]byte("abc"))
+	wr.FixedSizeGroup(Int8Group, 1)
+	wr.Data([]int8{ 3 })
+	for _, i := range []int{ 2, 0, 1 } {
+		if err := wr.CopyGroup(srcRd, i); err != nil { t.Fatal(err) }
+	}
+	if _, err := wr.Data([]int64{ 1 }); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("Expected ErrNoGroup after CopyGroup, got %v.", err)
+	}
+	if err := wr.CopyGroup(srcRd, 3); err == nil {
+		t.Errorf("Expected error for an out of range group.")
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(dst)
+	if err != nil { t.Fatal(err) }
+	if err := rd.Verify(); err != nil { t.Fatal(err) }
+	if rd.Blocks() != 5 {
+		t.Fatalf("Expected 5 blocks, got %d.", rd.Blocks())
+	}
+
+	vecOut := make([][3]float32, len(vec))
+	if err := rd.Data(1, vecOut); err != nil { t.Fatal(err) }
+	for i := range vec {
+		for k := 0; k < 3; k++ {
+			if d := vecOut[i][k] - vec[i][k]; d > 1e-3 || d < -1e-3 {
+				t.Errorf("Expected vec[%d][%d] = %g, got %g.", i, k,
+					vec[i][k], vecOut[i][k])
+			}
+		}
+	}
+	for b, x := range [][]int64{ x1, x2 } {
+		out := make([]int64, len(x))
+		if err := rd.Data(b + 2, out); err != nil { t.Fatal(err) }
+		if !int64sEq(x, out) {
+			t.Errorf("Expected block %d = %d, got %d.", b + 2, x, out)
+		}
+	}
+	out3 := make([]float64, len(x3))
+	if err := rd.Data(4, out3); err != nil { t.Fatal(err) }
+	for i := range x3 {
+		if out3[i] != x3[i] {
+			t.Errorf("Expected x3 = %g, got %g.", x3, out3)
+			break
+		}
+	}
+	if off := rd.Groups()[3].Offsets[0]; off % 8 != 0 {
+		t.Errorf("Copied Float64Group starts at unaligned offset %d.", off)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Header(int64(1)); err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(3); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 1, 2, 3 }); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	original := append([]byte{ }, buf.Bytes()...)
+
+	// Until the appending Writer is closed, the file's contents don't change.
+	if _, err := buf.Seek(0, 0); err != nil { t.Fatal(err) }
+	wr, err = NewAppendWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 4, 5, 6 }); !errors.Is(err, ErrNoGroup) {
+		t.Errorf("Expected ErrNoGroup, got %v.", err)
+	}
+	if i, err := wr.Header(int64(2)); err != nil || i != 1 {
+		t.Fatalf("Expected header 1 and no error, got %d and %v.", i, err)
+	}
+	err = wr.FloatGroup(2, [2]float32{ 0, 10 }, 0.01, NonPeriodic())
+	if err != nil { t.Fatal(err) }
+	if b, err := wr.Data([]float32{ 2.5, 7.5 }); err != nil || b != 1 {
+		t.Fatalf("Expected block 1 and no error, got %d and %v.", b, err)
+	}
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	if rd.Blocks() != 1 {
+		t.Errorf("Expected unclosed append to leave 1 block, got %d.",
+			rd.Blocks())
+	}
+	if !bytes.Equal(buf.Bytes()[:len(original)], original) {
+		t.Errorf("Appending modified the original file.")
+	}
+
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	rd, err = NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	if err := rd.Verify(); err != nil { t.Fatal(err) }
+	if rd.Blocks() != 2 { t.Fatalf("Expected 2 blocks, got %d.", rd.Blocks()) }
+	var h0, h1 int64
+	if err := rd.Header(0, &h0); err != nil { t.Fatal(err) }
+	if err := rd.Header(1, &h1); err != nil { t.Fatal(err) }
+	if h0 != 1 || h1 != 2 {
+		t.Errorf("Expected headers 1 and 2, got %d and %d.", h0, h1)
+	}
+	i64, f32 := make([]int64, 3), make([]float32, 2)
+	if err := rd.Data(0, i64); err != nil { t.Fatal(err) }
+	if err := rd.Data(1, f32); err != nil { t.Fatal(err) }
+	if !int64sEq(i64, []int64{ 1, 2, 3 }) {
+		t.Errorf("Expected block 0 to be [1 2 3], got %d.", i64)
+	}
+	if !float32sEq(f32, []float32{ 2.5, 7.5 }, 0.01) {
+		t.Errorf("Expected block 1 to be [2.5 7.5], got %g.", f32)
+	}
+
+	// Appending to a version 1 file upgrades it to the current version.
+	data, err := ioutil.ReadFile("testdata/v1.minw")
+	if err != nil { t.Fatal(err) }
+	buf = NewBuffer(data)
+	wr, err = NewAppendWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if err := wr.BytesGroup(1); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]string{ "appended" }); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err = NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	if rd.Version() != Version {
+		t.Errorf("Expected version %d, got %d.", Version, rd.Version())
+	}
+	if err := rd.Verify(); err != nil { t.Fatal(err) }
+	str := make([]string, 1)
+	if err := rd.Data(5, str); err != nil { t.Fatal(err) }
+	if str[0] != "appended" {
+		t.Errorf("Expected block 5 to be 'appended', got '%s'.", str[0])
+	}
+	f32 = make([]float32, 4)
+	if err := rd.Data(4, f32); err != nil { t.Fatal(err) }
+	if exp := []float32{ 0.5, 25.25, 50, 99.99 }; !float32sEq(f32, exp, 0.01) {
+		t.Errorf("Expected block 4 to be %g, got %g.", exp, f32)
+	}
+
+	// Files which don't start at offset 0 can be appended to.
+	buf = NewBuffer([]byte("prefix"))
+	if _, err := buf.Seek(0, 2); err != nil { t.Fatal(err) }
+	wr, err = NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Header(int64(1)); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	if _, err := buf.Seek(6, 0); err != nil { t.Fatal(err) }
+	wr, err = NewAppendWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(2); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 7, 8 }); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	if string(buf.Bytes()[:6]) != "prefix" {
+		t.Errorf("Appending modified the bytes before the minnow file.")
+	}
+	rd, err = NewReader(io.NewSectionReader(buf, 6, int64(buf.Len() - 6)))
+	if err != nil { t.Fatal(err) }
+	if err := rd.Verify(); err != nil { t.Fatal(err) }
+	i64 = make([]int64, 2)
+	if err := rd.Data(0, i64); err != nil { t.Fatal(err) }
+	if err := rd.Header(0, &h0); err != nil || h0 != 1 ||
+		!int64sEq(i64, []int64{ 7, 8 }) {
+		t.Errorf("Expected header 1 and block [7 8], got %d, %d and %v.",
+			h0, i64, err)
+	}
+
+	fname := "../test_files/append.test"
+	wr = MustCreate(fname)
+	if _, err := wr.Header(int64(1)); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	wr, err = OpenAppend(fname)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Header(int64(2)); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	rd = MustOpen(fname)
+	defer rd.Close()
+	if err := rd.Header(1, &h1); err != nil || h1 != 2 {
+		t.Errorf("Expected header 1 to be 2, got %d and %v.", h1, err)
+	}
+}
+
+func TestNamedHeaders(t *testing.T) {
+	type geometry struct {
+		L, Boundary float32
+		Cells int64
+		Origin [3]float64
+	}
+	geom := geometry{ 100, 2.5, 8, [3]float64{ 1, 2, 3 } }
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Header(int64(7)); err != nil { t.Fatal(err) }
+	if _, err := wr.NamedHeader("geometry", geom); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wr.NamedHeader("masses", []float32{ 1, 2 }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wr.NamedHeader("geometry", geom); err == nil {
+		t.Errorf("Expected error for duplicate header name.")
+	}
+	if _, err := wr.NamedHeader("", geom); err == nil {
+		t.Errorf("Expected error for empty header name.")
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	names := []string{ "", "geometry", "masses" }
+	schemas := []string{
+		"int64",
+		"struct{L float32; Boundary float32; Cells int64; Origin [3]float64}",
+		"[2]float32",
+	}
+	for i := range names {
+		if name, _ := rd.HeaderName(i); name != names[i] {
+			t.Errorf("Expected header %d to have name '%s', got '%s'.",
+				i, names[i], name)
+		}
+		if schema, _ := rd.HeaderSchema(i); schema != schemas[i] {
+			t.Errorf("Expected header %d to have schema %s, got %s.",
+				i, schemas[i], schema)
+		}
+	}
+	if i := rd.HeaderIndex(""); i != -1 {
+		t.Errorf("Expected the empty name to have index -1, got %d.", i)
+	}
+
+	outGeom, masses := geometry{ }, make([]float32, 2)
+	if err := rd.HeaderByName("geometry", &outGeom); err != nil {
+		t.Fatal(err)
+	}
+	if outGeom != geom {
+		t.Errorf("Expected geometry %v, got %v.", geom, outGeom)
+	}
+	if err := rd.HeaderByName("masses", masses); err != nil {
+		t.Fatal(err)
+	}
+	if masses[0] != 1 || masses[1] != 2 {
+		t.Errorf("Expected masses [1 2], got %g.", masses)
+	}
+
+	// The schema must match, even if the size does.
+	if err := rd.HeaderByName("masses", make([]int32, 2));
+		!errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	if err := rd.HeaderByName("mass", masses); !errors.Is(err, ErrHeaderName) {
+		t.Errorf("Expected ErrHeaderName, got %v.", err)
+	}
+
+	v1, err := Open("testdata/v1.minw")
+	if err != nil { t.Fatal(err) }
+	defer v1.Close()
+	name, _ := v1.HeaderName(0)
+	schema, _ := v1.HeaderSchema(0)
+	if name != "" || schema != "" {
+		t.Errorf("Expected version 1 header to have no name or schema.")
+	}
+}
+
+func int32sEq(x, y []int32) bool {
+	if len(x) != len(y) { return false }
+	for i := range x {
+		if x[i] != y[i] { return false }
+	}
+	return true
+}
+
+func intsEq(x, y []int) bool {
+	if len(x) != len(y) { return false }
+	for i := range x {
+		if x[i] != y[i] { return false }
+	}
+	return true
+}
+
+func int64sEq(x, y []int64) bool {
+	if len(x) != len(y) { return false }
+	for i := range x {
+		if x[i] != y[i] { return false }
+	}
+	return true
+}
+
+func float32sEq(x, y []float32, eps float32) bool {
+	if len(x) != len(y) { return false }
+	for i := range x {
+		if x[i] + eps < y[i] || x[i] - eps > y[i] { return false }
+	}
+	return true
+}
+
+func float64sExactEq(x, y []float64) bool {
+	if len(x) != len(y) { return false }
+	for i := range x {
+		if x[i] != y[i] { return false }
+	}
+	return true
+}
+
+func TestMmap(t *testing.T) {
+	fname := "../test_files/mmap.test"
+	wr, err := Create(fname)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Header(int64(7)); err != nil { t.Fatal(err) }
+
+	// The Uint8Group block would leave the second Float32Group block
+	// unaligned, so the Writer pads the file before it.
+	blocks := []interface{}{
+		[]float32{ 1.5, 2.5 }, []int16{ -1, 2, -3 }, []uint8{ 4, 5, 6 },
+		[]float32{ 3.5 }, []int64{ 100, 200, 300, 400 },
+	}
+	for _, x := range blocks {
+		var err error
+		switch x.(type) {
+		case []int64: err = wr.IntGroup(sliceLen(x))
+		case []float32: err = wr.FixedSizeGroup(Float32Group, sliceLen(x))
+		case []int16: err = wr.FixedSizeGroup(Int16Group, sliceLen(x))
+		case []uint8: err = wr.FixedSizeGroup(Uint8Group, sliceLen(x))
+		}
+		if err != nil { t.Fatal(err) }
+		if _, err := wr.Data(x); err != nil { t.Fatal(err) }
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := OpenMmap(fname)
+	if err != nil { t.Fatal(err) }
+	rd.VerifyOnRead(true)
+
+	var hd int64
+	if err := rd.Header(0, &hd); err != nil || hd != 7 {
+		t.Errorf("Expected header 7 and no error, got %d and %v.", hd, err)
+	}
+
+	aliased := []bool{ true, true, true, true, false }
+	for b := range blocks {
+		x, err := rd.DataView(b)
+		if err != nil { t.Fatal(err) }
+		if !reflect.DeepEqual(x, blocks[b]) {
+			t.Errorf("Expected block %d to be %v, got %v.", b, blocks[b], x)
+		}
+
+		if rd.mapped == nil { continue }
+		p := reflect.ValueOf(x).Pointer()
+		start := reflect.ValueOf(rd.mapped).Pointer()
+		inMap := p >= start && p < start + uintptr(len(rd.mapped))
+		if inMap != aliased[b] {
+			t.Errorf("Expected aliasing of block %d to be %v, got %v.",
+				b, aliased[b], inMap)
+		}
+	}
+
+	if _, err := rd.DataView(len(blocks)); err == nil {
+		t.Errorf("Expected error for out-of-range block.")
+	}
+	if err := rd.Close(); err != nil { t.Fatal(err) }
+}
+
+func TestBlockStats(t *testing.T) {
+	nan := float32(math.NaN())
+	inf := math.Inf(1)
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+
+	if err := wr.IntGroup(VariableLength); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 4, -2, 7 }); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ }); err != nil { t.Fatal(err) }
+	err = wr.FixedSizeGroup(Int64Group, 2)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ math.MaxInt64, 0 }); err != nil {
+		t.Fatal(err)
+	}
+	err = wr.FixedSizeGroup(Float32Group, 3)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]float32{ 1.5, nan, -0.5 }); err != nil {
+		t.Fatal(err)
+	}
+	err = wr.FloatGroup(4, [2]float32{ 8, 14 }, 0.01, Log(), NonPeriodic())
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]float32{ 1e10, 3e12, nan, 2e11 }); err != nil {
+		t.Fatal(err)
+	}
+	err = wr.FloatGroup(3, [2]float32{ 0, 10 }, 0.1)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]float32{ 9.95, 0.05, 10.5 }); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.BoolGroup(2); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]bool{ true, true }); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.BytesGroup(1); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]string{ "cat" }); err != nil { t.Fatal(err) }
+	err = wr.VecGroup(Vec32Group, 2, [3][2]float64{ { 0, 10 }, { 0, 10 },
+		{ 0, 10 } }, [3]float64{ 0.1, 0.1, 0.1 }, NonPeriodic())
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([][3]float32{ { 1, 2, 3 }, { 4, 5, 6 } }); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+
+	exact := []BlockStats{
+		{ -2, 7, 0 }, { inf, -inf, 0 }, { 0, math.MaxInt64, 0 },
+		{ -0.5, 1.5, 1 },
+	}
+	for b := range exact {
+		stats, err := rd.BlockStats(b)
+		if err != nil { t.Fatal(err) }
+		if stats != exact[b] {
+			t.Errorf("Expected block %d to have stats %v, got %v.",
+				b, exact[b], stats)
+		}
+	}
+
+	// Quantized blocks must contain every value they decode to.
+	approx := []BlockStats{
+		{ 1e8, 3e12, 1 }, { 0, 10, 0 }, { 1, 1, 0 }, { -inf, inf, 0 },
+		{ 1, 6, 0 },
+	}
+	for i := range approx {
+		b := len(exact) + i
+		stats, err := rd.BlockStats(b)
+		if err != nil { t.Fatal(err) }
+		near := func(x, y float64) bool {
+			return x == y || math.Abs(x - y) <= 0.2*math.Abs(y) + 1e-3
+		}
+		if stats.Nulls != approx[i].Nulls || !near(stats.Min, approx[i].Min) ||
+			!near(stats.Max, approx[i].Max) {
+			t.Errorf("Expected block %d to have stats near %v, got %v.",
+				b, approx[i], stats)
+		}
+
+		for _, mode := range []Dequantization{ Dither, Midpoint, LowerEdge } {
+			rd.SetDequantization(mode)
+			var vals []float64
+			switch x, _ := rd.DataView(b); out := x.(type) {
+			case []float32:
+				for _, v := range out { vals = append(vals, float64(v)) }
+			case [][3]float32:
+				for _, v := range out {
+					for k := 0; k < 3; k++ { vals = append(vals, float64(v[k])) }
+				}
+			}
+			for _, v := range vals {
+				if v < stats.Min || v > stats.Max {
+					t.Errorf("Block %d decoded to %g, outside of %v.",
+						b, v, stats)
+				}
+			}
+		}
+	}
+
+	if _, err := rd.BlockStats(rd.Blocks()); err == nil {
+		t.Errorf("Expected error for out-of-range block.")
+	}
+
+	// Files from before version 6 don't have statistics.
+	data, err := ioutil.ReadFile("testdata/v1.minw")
+	if err != nil { t.Fatal(err) }
+	rd, err = NewReader(NewBuffer(data))
+	if err != nil { t.Fatal(err) }
+	if stats, err := rd.BlockStats(0); err != nil ||
+		stats != (BlockStats{ -inf, inf, -1 }) {
+		t.Errorf("Expected unknown stats and no error, got %v and %v.",
+			stats, err)
+	}
+}
+
+func TestDataRange(t *testing.T) {
+	N := 37
+	f64, i64, delta := make([]float64, N), make([]int64, N), make([]int64, N)
+	f32, names := make([]float32, N), make([]string, N)
+	for i := 0; i < N; i++ {
+		f64[i] = float64(i)*1.25 - 3
+		i64[i] = int64((i*i*7919) % 1000) - 500
+		delta[i] = int64(i*3)
+		f32[i] = float32(i % 10) + 0.5
+		names[i] = fmt.Sprintf("halo %d", i)
+	}
+
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	groups := []func() error{
+		func() error { return wr.FixedSizeGroup(Float64Group, N) },
+		func() error { return wr.IntGroup(N) },
+		func() error { return wr.IntGroup(N) },
+		func() error { return wr.FloatGroup(N, [2]float32{ 0, 10 }, 0.01) },
+		func() error {
+			return wr.EntropyFloatGroup(N, [2]float32{ 0, 10 }, 0.01)
+		},
+		func() error { return wr.DeltaIntGroup(N) },
+		func() error { return wr.BytesGroup(N) },
+	}
+	blocks := []interface{}{
+		f64, i64, make([]int64, N), f32, f32, delta, names,
+	}
+	for i := range groups {
+		if err := groups[i](); err != nil { t.Fatal(err) }
+		if _, err := wr.Data(blocks[i]); err != nil { t.Fatal(err) }
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	ranges := [][2]int{ { 0, N }, { 0, 0 }, { 5, 6 }, { 7, 9 }, { 13, 31 },
+		{ N - 1, N } }
+	for b := range blocks {
+		all, err := rd.DataView(b)
+		if err != nil { t.Fatal(err) }
+		for _, r := range ranges {
+			out := reflect.MakeSlice(reflect.TypeOf(all), r[1] - r[0],
+				r[1] - r[0]).Interface()
+			if err := rd.DataRange(b, r[0], r[1], out); err != nil {
+				t.Fatal(err)
+			}
+			want := reflect.ValueOf(all).Slice(r[0], r[1]).Interface()
+			if !reflect.DeepEqual(out, want) {
+				t.Errorf("Expected block %d range %d to be %v, got %v.",
+					b, r, want, out)
+			}
+		}
+	}
+
+	var x float32
+	if err := rd.Element(3, 12, &x); err != nil { t.Fatal(err) }
+	if x < 2.5 || x > 2.51 {
+		t.Errorf("Expected element 12 of block 3 to be 2.5, got %g.", x)
+	}
+	var s string
+	if err := rd.Element(6, 20, &s); err != nil || s != "halo 20" {
+		t.Errorf("Expected 'halo 20' and no error, got '%s' and %v.", s, err)
+	}
+
+	if err := rd.DataRange(1, 30, 40, make([]int64, 10)); err == nil {
+		t.Errorf("Expected error for out-of-range elements.")
+	}
+	err = rd.DataRange(1, 0, 10, make([]int64, 5))
+	if !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for short buffer, got %v.", err)
+	}
+	if err := rd.Element(1, 0, &x); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for wrong type, got %v.", err)
+	}
+	if err := rd.Element(1, 0, x); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch for non-pointer, got %v.", err)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	N := 1000
+	write := func(wr *Writer) error {
+		i64, f32 := make([]int64, N), make([]float32, N)
+		vec, names := make([][3]float32, N), make([][]byte, N)
+		lim := [2]float32{ 0, 100 }
+		groups := []func() error{
+			func() error { return wr.IntGroup(N) },
+			func() error { return wr.FloatGroup(N, lim, 1e-3) },
+			func() error { return wr.EntropyFloatGroup(N, lim, 1e-3, Log()) },
+			func() error { return wr.DeltaIntGroup(VariableLength) },
+			func() error {
+				return wr.LosslessFloatGroup(LosslessFloat32Group, N)
+			},
+			func() error { return wr.FixedSizeGroup(Float32Group, N) },
+			func() error {
+				return wr.VecGroup(Vec32Group, N, [3][2]float64{ { 0, 100 },
+					{ 0, 100 }, { 0, 100 } }, [3]float64{ 0.01, 0.01, 0.01 })
+			},
+			func() error { return wr.BytesGroup(N) },
+		}
+		for gi := range groups {
+			if err := groups[gi](); err != nil { return err }
+			if _, err := wr.Header(int64(gi)); err != nil { return err }
+			if err := groups[gi](); err != nil { return err }
+
+			for b := 0; b < 10; b++ {
+				// Buffers are reused, so Data must copy them.
+				for i := 0; i < N; i++ {
+					k := (i*7919 + b*104729 + gi) % 100000
+					i64[i] = int64(k*k)
+					f32[i] = float32(k) / 1000
+					vec[i] = [3]float32{ f32[i], 100 - f32[i], 50 }
+					names[i] = append(names[i][:0], byte(k), byte(k >> 8))
+				}
+				var x interface{}
+				switch gi {
+				case 0: x = i64
+				case 3: x = i64[:N - b]
+				case 6: x = vec
+				case 7: x = names
+				default: x = f32
+				}
+				if _, err := wr.Data(x); err != nil { return err }
+			}
+		}
+		return nil
+	}
+
+	serial := NewBuffer(nil)
+	wr, err := NewWriter(serial)
+	if err != nil { t.Fatal(err) }
+	if err := write(wr); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	tests := [][2]int{ { 1, 1 }, { 2, 2 }, { 4, 16 }, { 8, 3 } }
+	for _, test := range tests {
+		buf := NewBuffer(nil)
+		wr, err := NewWriter(buf)
+		if err != nil { t.Fatal(err) }
+		err = wr.SetConcurrency(test[0], test[1])
+		if err != nil { t.Fatal(err) }
+		if err := write(wr); err != nil { t.Fatal(err) }
+		if err := wr.Close(); err != nil { t.Fatal(err) }
+
+		if !bytes.Equal(buf.Bytes(), serial.Bytes()) {
+			t.Errorf("%d workers, %d in flight: file differs from the " +
+				"one written without concurrency.", test[0], test[1])
+		}
+	}
+
+	// Encoding errors are returned by later calls.
+	wr, err = NewWriter(NewBuffer(nil))
+	if err != nil { t.Fatal(err) }
+	if err := wr.SetConcurrency(4, 4); err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(3); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 1, 2 }); err != nil {
+		t.Errorf("Expected encoding error to be returned later, got %v.", err)
+	}
+	if err := wr.Close(); !errors.Is(err, ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch from Close, got %v.", err)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	buf := NewBuffer(nil)
+	wr, err := NewWriter(buf)
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Header(int64(1)); err != nil { t.Fatal(err) }
+	if _, err := wr.NamedHeader("x", int32(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := wr.IntGroup(VariableLength); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 10, 11, 17 }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wr.Data([]int64{ -4 }); err != nil { t.Fatal(err) }
+	err = wr.FloatGroup(2, [2]float32{ 0, 8 }, 0.5, NonPeriodic(),
+		Dequantize(Midpoint))
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]float32{ 1.1, 3.9 }); err != nil {
+		t.Fatal(err)
+	}
+	err = wr.FixedSizeGroup(Int16Group, 4)
+	if err != nil { t.Fatal(err) }
+	err = wr.VecGroup(Vec64Group, 1, [3][2]float64{ { 0, 1 }, { 0, 2 },
+		{ 0, 4 } }, [3]float64{ 0.25, 0.25, 0.25 })
+	if err != nil { t.Fatal(err) }
+	if _, err := wr.Data([][3]float64{ { 0.5, 1, 3.5 } }); err != nil {
+		t.Fatal(err)
+	}
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+
+	rd, err := NewReader(buf)
+	if err != nil { t.Fatal(err) }
+	if rd.HeaderCount() != 2 {
+		t.Errorf("Expected 2 headers, got %d.", rd.HeaderCount())
+	}
+
+	groups := rd.Groups()
+	if len(groups) != 4 { t.Fatalf("Expected 4 groups, got %d.", len(groups)) }
+	for i, want := range []struct {
+		gt int64
+		start, blocks, N int
+		lengths []int
+	} {
+		{ IntGroup, 0, 2, VariableLength, []int{ 3, 1 } },
+		{ FloatGroup, 2, 1, 2, []int{ 2 } },
+		{ Int16Group, 3, 0, 4, nil },
+		{ Vec64Group, 3, 1, 1, []int{ 1 } },
+	} {
+		g := groups[i]
+		if g.Type != want.gt || g.StartBlock != want.start ||
+			g.Blocks != want.blocks || g.N != want.N ||
+			!intsEq(g.Lengths, want.lengths) {
+			t.Errorf("Expected group %d to be %s with blocks [%d, +%d), N " +
+				"= %d and lengths %d, got %s with blocks [%d, +%d), N = %d " +
+				"and lengths %d.", i, GroupNames[want.gt], want.start,
+				want.blocks, want.N, want.lengths, GroupNames[g.Type],
+				g.StartBlock, g.Blocks, g.N, g.Lengths)
+		}
+	}
+
+	// Offsets and sizes agree with the raw blocks.
+	for _, g := range groups {
+		for j := 0; j < g.Blocks; j++ {
+			raw, err := rd.readBlock(g.StartBlock + j)
+			if err != nil { t.Fatal(err) }
+			data := make([]byte, g.Sizes[j])
+			if err := rd.readAt(data, g.Offsets[j]); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(data, *raw) {
+				t.Errorf("Block %d doesn't match its offset and size.",
+					g.StartBlock + j)
+			}
+			putBytes(raw)
+		}
+	}
+
+	ig := groups[0]
+	if !int64sEq(ig.Mins, []int64{ 10, -4 }) ||
+		!int64sEq(ig.Bits, []int64{ 3, 0 }) {
+		t.Errorf("Expected mins [10 -4] and bits [3 0], got %d and %d.",
+			ig.Mins, ig.Bits)
+	}
+
+	q := Quantization{ 0, 8, 16, false, false, Midpoint }
+	if fg := groups[1]; len(fg.Quantization) != 1 || fg.Quantization[0] != q {
+		t.Errorf("Expected quantization %v, got %v.", q, fg.Quantization)
+	}
+	if fg := groups[1]; !int64sEq(fg.Mins, []int64{ 2 }) {
+		t.Errorf("Expected FloatGroup mins [2], got %d.", fg.Mins)
+	}
+
+	vg := groups[3]
+	if len(vg.Quantization) != 3 || vg.Quantization[2].Pixels != 16 ||
+		!vg.Quantization[2].Periodic {
+		t.Errorf("Expected 3 periodic quantizations with 16 pixels in " +
+			"the last, got %v.", vg.Quantization)
+	}
+	if !int64sEq(vg.Mins, []int64{ 2, 4, 14 }) {
+		t.Errorf("Expected vector mins [2 4 14], got %d.", vg.Mins)
+	}
+
+	// Changing the descriptions doesn't change the Reader.
+	ig.Mins[0] = 100
+	if rd.Groups()[0].Mins[0] != 10 {
+		t.Errorf("Groups returned a reference to internal state.")
+	}
+}
+
+func TestJournal(t *testing.T) {
+	if _, err := NewWriter(NewBuffer(nil)); err != nil {
+		t.Fatal(err)
+	} else if wr, _ := NewWriter(NewBuffer(nil)); wr.Journal(2) == nil {
+		t.Errorf("Expected error when journaling a Writer without a file.")
+	}
+
+	fname := "../test_files/journal.test"
+	jname := JournalFile(fname)
+	write := func() *Writer {
+		wr, err := Create(fname)
+		if err != nil { t.Fatal(err) }
+		if err := wr.Journal(2); err != nil { t.Fatal(err) }
+		if _, err := wr.Header(int64(7)); err != nil { t.Fatal(err) }
+		if err := wr.IntGroup(3); err != nil { t.Fatal(err) }
+		for i := int64(0); i < 3; i++ {
+			_, err := wr.Data([]int64{ i, i + 1, i + 2 })
+			if err != nil { t.Fatal(err) }
+		}
+		err = wr.FloatGroup(2, [2]float32{ 0, 10 }, 0.01, NonPeriodic())
+		if err != nil { t.Fatal(err) }
+		for i := 0; i < 2; i++ {
+			_, err := wr.Data([]float32{ float32(i), 5 })
+			if err != nil { t.Fatal(err) }
+		}
+		if _, err := wr.Header(int64(8)); err != nil { t.Fatal(err) }
+		return wr
+	}
+
+	// Stop the Writer without closing it.
+	os.Remove(fname)
+	wr := write()
+	if err := wr.closer.Close(); err != nil { t.Fatal(err) }
+	if _, err := Open(fname); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected %s to not exist before recovery, got %v.",
+			fname, err)
+	}
+
+	if err := Recover(fname); err != nil { t.Fatal(err) }
+	if _, err := ioutil.ReadFile(jname); err == nil {
+		t.Errorf("Expected Recover to remove the journal.")
+	}
+	rd, err := Open(fname)
+	if err != nil { t.Fatal(err) }
+	if err := rd.Verify(); err != nil { t.Fatal(err) }
+	if rd.Blocks() != 4 || rd.HeaderCount() != 1 {
+		t.Fatalf("Expected 4 blocks and 1 header, got %d and %d.",
+			rd.Blocks(), rd.HeaderCount())
+	}
+	i64, f32 := make([]int64, 3), make([]float32, 2)
+	if err := rd.Data(2, i64); err != nil { t.Fatal(err) }
+	if err := rd.Data(3, f32); err != nil { t.Fatal(err) }
+	if !int64sEq(i64, []int64{ 2, 3, 4 }) {
+		t.Errorf("Expected block 2 to be [2 3 4], got %d.", i64)
+	}
+	if !float32sEq(f32, []float32{ 0, 5 }, 0.01) {
+		t.Errorf("Expected block 3 to be [0 5], got %g.", f32)
+	}
+	if err := rd.Close(); err != nil { t.Fatal(err) }
+
+	if err := Recover(fname); err == nil {
+		t.Errorf("Expected error when recovering a file without a journal.")
+	}
+
+	// Closing removes the journal, and a leftover journal from before the
+	// file was closed doesn't replace the newer tail.
+	wr = write()
+	journal, err := ioutil.ReadFile(jname)
+	if err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	if _, err := ioutil.ReadFile(jname); err == nil {
+		t.Errorf("Expected Close to remove the journal.")
+	}
+	if err := ioutil.WriteFile(jname, journal, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Recover(fname); err != nil { t.Fatal(err) }
+	rd, err = Open(fname)
+	if err != nil { t.Fatal(err) }
+	if rd.Blocks() != 5 || rd.HeaderCount() != 2 {
+		t.Errorf("Expected 5 blocks and 2 headers, got %d and %d.",
+			rd.Blocks(), rd.HeaderCount())
+	}
+	if err := rd.Close(); err != nil { t.Fatal(err) }
+}
+
+func TestAbort(t *testing.T) {
+	fname := "../test_files/abort.test"
+	os.Remove(fname)
+	exists := func(name string) bool {
+		_, err := os.Stat(name)
+		return err == nil
+	}
+
+	wr, err := Create(fname)
+	if err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(3); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 1, 2, 3 }); err != nil { t.Fatal(err) }
+	tmpName := wr.TempName()
+	if exists(fname) || !exists(tmpName) {
+		t.Errorf("Expected an unclosed Writer to only write to %s.", tmpName)
+	}
+	if err := wr.Abort(); err != nil { t.Fatal(err) }
+	if exists(fname) || exists(tmpName) {
+		t.Errorf("Expected Abort to remove the file.")
+	}
+
+	// Abort removes the file even if it can't be closed.
+	wr, err = Create(fname)
+	if err != nil { t.Fatal(err) }
+	tmpName = wr.TempName()
+	wr.closer = failingCloser{ wr.closer }
+	if err := wr.Abort(); err == nil {
+		t.Errorf("Expected error from Abort.")
+	}
+	if exists(tmpName) {
+		t.Errorf("Expected Abort to remove the file after failing to close it.")
+	}
+
+	// Writers creating the same file don't share temporary files.
+	wr, err = Create(fname)
+	if err != nil { t.Fatal(err) }
+	other, err := Create(fname)
+	if err != nil { t.Fatal(err) }
+	tmpName = wr.TempName()
+	if tmpName == other.TempName() {
+		t.Errorf("Expected different temporary files, got %s twice.", tmpName)
+	}
+	if err := other.Abort(); err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(3); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 1, 2, 3 }); err != nil { t.Fatal(err) }
+	if err := wr.Close(); err != nil { t.Fatal(err) }
+	if !exists(fname) || exists(tmpName) || wr.TempName() != "" {
+		t.Errorf("Expected Close to rename %s to %s.", tmpName, fname)
+	}
+	if err := wr.Close(); err == nil {
+		t.Errorf("Expected error when closing a Writer twice.")
+	}
+	if err := wr.Abort(); err != nil || !exists(fname) {
+		t.Errorf("Expected Abort after Close to do nothing, got %v.", err)
+	}
+	original, err := ioutil.ReadFile(fname)
+	if err != nil { t.Fatal(err) }
+
+	// Aborting an append leaves the original file.
+	wr, err = OpenAppend(fname)
+	if err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(2); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 4, 5 }); err != nil { t.Fatal(err) }
+	if err := wr.Abort(); err != nil { t.Fatal(err) }
+	data, err := ioutil.ReadFile(fname)
+	if err != nil { t.Fatal(err) }
+	if !bytes.Equal(data, original) {
+		t.Errorf("Expected aborted append to leave the file unchanged.")
+	}
+
+	// So does aborting an append after Close has written the new tail but
+	// failed.
+	wr, err = OpenAppend(fname)
+	if err != nil { t.Fatal(err) }
+	if err := wr.IntGroup(2); err != nil { t.Fatal(err) }
+	if _, err := wr.Data([]int64{ 4, 5 }); err != nil { t.Fatal(err) }
+	wr.closer = failingCloser{ wr.closer }
+	if err := wr.Close(); err == nil {
+		t.Errorf("Expected error from Close.")
+	}
+	if err := wr.Abort(); err != nil { t.Fatal(err) }
+	data, err = ioutil.ReadFile(fname)
+	if err != nil { t.Fatal(err) }
+	if !bytes.Equal(data, original) {
+		t.Errorf("Expected append aborted after a failed Close to leave the " +
+			"file unchanged.")
+	}
+}
+
+// failingCloser closes the underlying io.Closer and then returns an error.
+type failingCloser struct { c io.Closer }
+
+func (fc failingCloser) Close() error {
+	fc.c.Close()
+	return fmt.Errorf("failingCloser")
 }
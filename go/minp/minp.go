@@ -1,7 +1,9 @@
 package minp
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"math"
 
 	minnow "github.com/phil-mansfield/minnow/go"
@@ -9,11 +11,24 @@ import (
 
 const (
 	Magic = 0xbadf00d
-	Version = 0
+	// Version is the version of the minp headers written by Writer. Readers
+	// can read any version from MinVersion to Version.
+	//
+	// Version history:
+	//   0 - Initial format.
+	//   1 - Vectors are stored in a single minnow vector group.
+	Version = 1
 
 	basicFileType int64 = iota
 )
 
+// MinVersion is the oldest minp version that can be read. It's kept out of the
+// block above so basicFileType doesn't change.
+const MinVersion = 0
+
+// ErrNotMinp is returned when a minnow file is not a minp file.
+var ErrNotMinp = errors.New("minp: not a minp file")
+
 type idHeader struct {
 	Magic, Version, FileType int64
 }
@@ -61,29 +76,63 @@ type Writer struct {
 	dx float32
 }
 
-func Create(fname string) *Writer {
-	minp := &Writer{ }
-	minp.f = minnow.Create(fname)
-	minp.f.Header(idHeader{Magic, Version, basicFileType})
+// Create creates a new minp file and returns a corresponding Writer. As with
+// minnow.Create, the file doesn't appear at fname until Close succeeds.
+func Create(fname string) (*Writer, error) {
+	f, err := minnow.Create(fname)
+	if err != nil { return nil, err }
+	return newWriter(f)
+}
+
+// NewWriter returns a Writer which writes a minp file to f. Closing the Writer
+// does not close f.
+func NewWriter(f io.WriteSeeker) (*Writer, error) {
+	mf, err := minnow.NewWriter(f)
+	if err != nil { return nil, err }
+	return newWriter(mf)
+}
+
+// newWriter writes the minp header to f. f is aborted if this fails.
+func newWriter(f *minnow.Writer) (*Writer, error) {
+	minp := &Writer{ f: f }
+	_, err := minp.f.NamedHeader("minp",
+		idHeader{Magic, Version, basicFileType})
+	if err != nil {
+		minp.f.Abort()
+		return nil, err
+	}
+	return minp, nil
+}
+
+// MustCreate is the same as Create, but panics on errors.
+func MustCreate(fname string) *Writer {
+	minp, err := Create(fname)
+	if err != nil { panic(err.Error()) }
 	return minp
 }
 
+// Header writes the snapshot header, the raw header of the original snapshot
+// file, the file's cell, the precision of the vectors, and whether or not they
+// are periodic.
 func (minp *Writer) Header(
 	hd *Header, rawHd []byte, c Cell, dx float64, periodic bool,
-) {
-	minp.f.Header(hd)
-	minp.f.Header(rawHd)
-	minp.f.Header(c)
-	minp.f.Header(dx)
-	minp.f.Header(boolToByte(periodic))
+) error {
+	hds := []interface{}{ hd, rawHd, c, dx, boolToByte(periodic) }
+	for i, x := range hds {
+		_, err := minp.f.NamedHeader(headerNames[i], x)
+		if err != nil { return err }
+	}
 
 	minp.hd = *hd
 	minp.c = c
 	minp.periodic = periodic
 	minp.dx = float32(dx)
+	return nil
 }
 
-func (minp *Writer) Vectors(vec [][3]float32) {
+// Vectors writes the vectors in the file's cell. len(vec) must be equal to
+// the number of particles in the cell.
+func (minp *Writer) Vectors(vec [][3]float32) error {
 	var min, max [3]float32
 	if minp.periodic {
 		L := float32(minp.hd.L)
@@ -101,25 +150,41 @@ func (minp *Writer) Vectors(vec [][3]float32) {
 	nSub3, subCells3 := nSub*nSub*nSub, subCells*subCells*subCells
 
 	if nFile*nFile*nFile != len(vec) {
-		panic(fmt.Sprintf("len(vec) = %d, but NSide = %d and FileCells = %d",
-			len(vec), minp.hd.NSide, minp.c.FileCells))
+		return fmt.Errorf("%w: len(vec) = %d, but NSide = %d and " +
+			"FileCells = %d", minnow.ErrTypeMismatch, len(vec),
+			minp.hd.NSide, minp.c.FileCells)
 	}
 
-	subBuf := [3][]float32{
-		make([]float32, nSub3), make([]float32, nSub3), make([]float32, nSub3),
+	var lim [3][2]float64
+	var dx [3]float64
+	for k := 0; k < 3; k++ {
+		lim[k] = [2]float64{ float64(min[k]), float64(max[k]) }
+		dx[k] = float64(minp.dx)
 	}
+	opt := minnow.Periodic()
+	if !minp.periodic { opt = minnow.NonPeriodic() }
 
-	for k := 0; k < 3; k++ {
-		minp.f.FloatGroup(nSub3, [2]float32{min[k], max[k]}, minp.dx)
-		for sc := 0; sc < subCells3; sc++ {
-			getSubCell(vec, subBuf, sc, subCells, nSub)
-			minp.f.Data(subBuf[k])
-		}
+	err := minp.f.VecGroup(minnow.Vec32Group, nSub3, lim, dx, opt)
+	if err != nil { return err }
+
+	subBuf := make([][3]float32, nSub3)
+	for sc := 0; sc < subCells3; sc++ {
+		getSubCell(vec, subBuf, sc, subCells, nSub)
+		if _, err := minp.f.Data(subBuf); err != nil { return err }
 	}
+
+	return nil
 }
 
-func (minp *Writer) Close() {
-	minp.f.Close()
+// Close closes the Writer.
+func (minp *Writer) Close() error {
+	return minp.f.Close()
+}
+
+// Abort stops the Writer without completing the file. A file opened by Create
+// is removed. See minnow.Writer.Abort.
+func (minp *Writer) Abort() error {
+	return minp.f.Abort()
 }
 
 ////////////
@@ -136,78 +201,156 @@ type Reader struct {
 
 	c Cell
 	f *minnow.Reader
+	version int64
 }
 
 // Open opens a minp file with the given file name.
-func Open(fname string) *Reader {
-	minp := &Reader{ }
-	minp.f = minnow.Open(fname)
+func Open(fname string) (*Reader, error) {
+	f, err := minnow.Open(fname)
+	if err != nil { return nil, err }
+	minp, err := open(f, fname)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return minp, nil
+}
+
+// NewReader returns a Reader for the minp file stored in r. Closing the Reader
+// does not close r.
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	f, err := minnow.NewReader(r)
+	if err != nil { return nil, err }
+	return open(f, "minp file")
+}
+
+// MustOpen is the same as Open, but panics on errors.
+func MustOpen(fname string) *Reader {
+	minp, err := Open(fname)
+	if err != nil { panic(err.Error()) }
+	return minp
+}
+
+func open(f *minnow.Reader, fname string) (*Reader, error) {
+	minp := &Reader{ f: f }
 
 	idHeader := idHeader{ }
-	minp.f.Header(0, &idHeader)
+	if err := minp.f.Header(headerIndex(f, "minp", 0), &idHeader); err != nil {
+		return nil, fmt.Errorf("%w: %s does not start with a minp " +
+			"header: %v", ErrNotMinp, fname, err)
+	}
 	if idHeader.Magic != Magic {
-		panic(fmt.Sprintf("Not a minp file. Magic number is %d, not %d",
-			idHeader.Magic, Magic))
-	} else if idHeader.Version != Version {
-		panic(fmt.Sprintf("File version = %d, but code version = %d.",
-			idHeader.Version, Version))
+		return nil, fmt.Errorf("%w: %s has magic number %d, not %d",
+			ErrNotMinp, fname, idHeader.Magic, Magic)
+	} else if idHeader.Version < MinVersion || idHeader.Version > Version {
+		return nil, fmt.Errorf("%w: %s has minp version %d, but code " +
+			"supports versions %d to %d", minnow.ErrVersion, fname,
+			idHeader.Version, MinVersion, Version)
 	} else if idHeader.FileType != basicFileType {
-		panic(fmt.Sprintf("File type = %d", idHeader.FileType))
+		return nil, fmt.Errorf("%w: %s has file type %d",
+			ErrNotMinp, fname, idHeader.FileType)
 	}
 
-	minp.f.Header(1, &minp.Header)
-	minp.RawHeader = make([]byte, minp.f.HeaderSize(2))
-	minp.f.Header(2, minp.RawHeader)
-	minp.f.Header(3, &minp.c)
-	minp.f.Header(4, &minp.Dx)
+	idx := make([]int, len(headerNames))
+	for i := range idx { idx[i] = headerIndex(f, headerNames[i], i + 1) }
+
 	bytePeriodic := byte(0)
-	minp.f.Header(5, &bytePeriodic)
+	rawSize, err := minp.f.HeaderSize(idx[1])
+	if err != nil { return nil, fmt.Errorf("%w: %v", ErrNotMinp, err) }
+	minp.RawHeader = make([]byte, rawSize)
+	hds := []interface{}{
+		&minp.Header, minp.RawHeader, &minp.c, &minp.Dx, &bytePeriodic,
+	}
+	for i := range hds {
+		if err := minp.f.Header(idx[i], hds[i]); err != nil { return nil, err }
+	}
 	minp.Periodic = byteToBool(bytePeriodic)
+	minp.version = idHeader.Version
+
+	nSide, c := minp.NSide, minp.c
+	if nSide <= 0 || c.FileCells <= 0 || c.SubCells <= 0 ||
+		nSide % c.FileCells != 0 || (nSide/c.FileCells) % c.SubCells != 0 {
+		return nil, fmt.Errorf("%w: %s has NSide = %d, FileCells = %d, " +
+			"and SubCells = %d", ErrNotMinp, fname, nSide, c.FileCells,
+			c.SubCells)
+	}
 
 	minp.FileIndex = int(minp.c.FileIndex)
 	minp.FileCells = int(minp.c.FileCells)
 
-	return minp
+	return minp, nil
 }
 
 // Vec reads the vectors form the file into out. out should have length equal to
 // minp.N().
-func (minp *Reader) Vectors(out [][3]float32) {
+func (minp *Reader) Vectors(out [][3]float32) error {
 	nFile := minp.c.NFile(int(minp.NSide))
 	subCells := int(minp.c.SubCells)
 	nSub := nFile / subCells
 	L := float32(minp.L)
 
 	subCells3, nSub3 := subCells*subCells*subCells, nSub*nSub*nSub
-	subBuf := [3][]float32{
-		make([]float32, nSub3), make([]float32, nSub3), make([]float32, nSub3),
-	}
-
-	if minp.f.Blocks() != 3*subCells3 {
-		panic(fmt.Sprintf("Expected %d sub-cells, but got %d",
-			3*subCells, minp.f.Blocks()))
+	subBuf := make([][3]float32, nSub3)
+
+	// Before version 1, each component was stored in its own FloatGroup.
+	blocks := subCells3
+	if minp.version < 1 { blocks = 3*subCells3 }
+
+	if minp.f.Blocks() != blocks {
+		return fmt.Errorf("%w: expected %d blocks, but got %d",
+			minnow.ErrTruncated, blocks, minp.f.Blocks())
+	} else if len(out) != nFile*nFile*nFile {
+		return fmt.Errorf("%w: len(out) = %d, but the file contains %d " +
+			"vectors", minnow.ErrTypeMismatch, len(out), nFile*nFile*nFile)
 	}
 
 	for sc := 0; sc < subCells3; sc++ {
-		for k := 0; k < 3; k++ {
-			minp.f.Data(k*subCells3 + sc, subBuf[k])
+		var err error
+		if minp.version < 1 {
+			err = minp.componentSubCell(sc, subBuf)
+		} else {
+			err = minp.f.Data(sc, subBuf)
+		}
+		if err != nil { return err }
 
-			if minp.Periodic {
-				for i, x := range subBuf[k] {
-					if x < 0 {
-						subBuf[k][i] = x + L
+		if minp.Periodic {
+			for i := range subBuf {
+				for k := 0; k < 3; k++ {
+					if x := subBuf[i][k]; x < 0 {
+						subBuf[i][k] = x + L
 					} else if x >= L {
-						subBuf[k][i] = x - L
+						subBuf[i][k] = x - L
 					}
 				}
 			}
 		}
 		setSubCell(out, subBuf, sc, subCells, nSub)
 	}
+
+	return nil
+}
+
+// componentSubCell reads sub-cell sc of a version 0 file, where the components
+// of the vectors are stored in separate FloatGroups, into out.
+func (minp *Reader) componentSubCell(sc int, out [][3]float32) error {
+	subCells := int(minp.c.SubCells)
+	subCells3 := subCells*subCells*subCells
+	buf := make([]float32, len(out))
+	for k := 0; k < 3; k++ {
+		if err := minp.f.Data(k*subCells3 + sc, buf); err != nil { return err }
+		for i := range buf { out[i][k] = buf[i] }
+	}
+	return nil
 }
 
-// ID returns the Lagrangian IDs of the particles in the file.
-func (minp *Reader) IDs(out []int64) {
+// IDs reads the Lagrangian IDs of the particles in the file into out, which
+// must have length N().
+func (minp *Reader) IDs(out []int64) error {
+	if len(out) != minp.N() {
+		return fmt.Errorf("%w: len(out) = %d, but the file contains %d " +
+			"particles", minnow.ErrTypeMismatch, len(out), minp.N())
+	}
+
 	nFile := int64(minp.c.NFile(int(minp.NSide)))
 	nSide := int64(minp.NSide)
 	ifx, ify, ifz := minp.c.FileCoord()
@@ -227,23 +370,37 @@ func (minp *Reader) IDs(out []int64) {
 			}
 		}
 	}
+	return nil
 }
 
 // N returns the number of particles in the file.
 func (minp *Reader) N() int {
-	return minp.f.Blocks() / 3
+	nFile := minp.c.NFile(int(minp.NSide))
+	return nFile*nFile*nFile
+}
+
+// Cell returns the cell header of the file, which describes where the file's
+// particles are in the full simulation.
+func (minp *Reader) Cell() Cell {
+	return minp.c
+}
+
+// SetDequantization overrides how the quantized vectors are reconstructed.
+// It should not be called concurrently with other methods.
+func (minp *Reader) SetDequantization(mode minnow.Dequantization) {
+	minp.f.SetDequantization(mode)
 }
 
 // Close closes the Reader.
-func (minp *Reader) Close() {
-	minp.f.Close()
+func (minp *Reader) Close() error {
+	return minp.f.Close()
 }
 
 // getSubCell sets subBuf with the corresponding values in x. x is a large
 // vector array, subBuf is a set of small buffers corresponding to one sub-cell,
 // sc is the index of the subcell in x, subCells is the number of sub-cells in
 // x, and nSub is the length of one side of sub-cell
-func getSubCell(x [][3]float32, subBuf [3][]float32, sc, subCells, nSub int) {
+func getSubCell(x [][3]float32, subBuf [][3]float32, sc, subCells, nSub int) {
 	nFile := nSub * subCells
 	sx := sc % subCells
 	sy := (sc / subCells) % subCells
@@ -256,7 +413,7 @@ func getSubCell(x [][3]float32, subBuf [3][]float32, sc, subCells, nSub int) {
 			for jx := 0; jx < nSub; jx++ {
 				ix, iy, iz := jx+ix0, jy+iy0, jz+iz0
 				i := ix + iy*nFile + iz*nFile*nFile
-				for k := 0; k < 3; k++ { subBuf[k][j] = x[i][k] }
+				subBuf[j] = x[i]
 				j++
 			}
 		}
@@ -267,7 +424,7 @@ func getSubCell(x [][3]float32, subBuf [3][]float32, sc, subCells, nSub int) {
 // is a large vector array, subBuf is a set of small buffers corresponding to
 // one sub-cell, sc is the index of the subcell in x, subCells is the number of
 // sub-cells in x, and nSub is the length of one side of sub-cell
-func setSubCell(x [][3]float32, subBuf [3][]float32, sc, subCells, nSub int) {
+func setSubCell(x [][3]float32, subBuf [][3]float32, sc, subCells, nSub int) {
 	nFile := nSub * subCells
 	sx := sc % subCells
 	sy := (sc / subCells) % subCells
@@ -280,13 +437,24 @@ func setSubCell(x [][3]float32, subBuf [3][]float32, sc, subCells, nSub int) {
 			for jx := 0; jx < nSub; jx++ {
 				ix, iy, iz := jx+ix0, jy+iy0, jz+iz0
 				i := ix + iy*nFile + iz*nFile*nFile
-				for k := 0; k < 3; k++ { x[i][k] = subBuf[k][j] }
+				x[i] = subBuf[j]
 				j++
 			}
 		}
 	}
 }
 
+// headerNames are the names of the headers which follow the id header, in the
+// order they're written.
+var headerNames = []string{ "header", "raw_header", "cell", "dx", "periodic" }
+
+// headerIndex returns the index of the header with the given name. Files
+// written before minnow had named headers fall back to index i.
+func headerIndex(f *minnow.Reader, name string, i int) int {
+	if j := f.HeaderIndex(name); j >= 0 { return j }
+	return i
+}
+
 // bounds returns the minimum and maximum of an array of vectors.
 func bounds(vec [][3]float32) (min, max [3]float32) {
 	min, max = vec[0], vec[0]
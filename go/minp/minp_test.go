@@ -1,7 +1,10 @@
 package minp
 
 import (
+	"errors"
 	"testing"
+
+	minnow "github.com/phil-mansfield/minnow/go"
 )
 
 func TestVecReaderWriter(t *testing.T) {
@@ -42,13 +45,13 @@ func TestVecReaderWriter(t *testing.T) {
 		for _, periodic := range []bool{ false, true } {
 			//vec := makeVectors([3]float32{20.5, 30.6, 40.7}, 100, nFile)
 			vec := makeVectors([3]float32{0, 0, 0}, 100, nFile)
-			wr := Create("test_files/test.minp")
+			wr := MustCreate("../../test_files/test.minp")
 			wr.Header(hd, rawHd, c, dx, periodic)
 			wr.Vectors(vec)
 			wr.Close()
 
 			out := make([][3]float32, len(vec))
-			rd := Open("test_files/test.minp")
+			rd := MustOpen("../../test_files/test.minp")
 			rd.Vectors(out)
 			
 			if !vectorsEq(vec, out, float32(dx)) {
@@ -56,17 +59,20 @@ func TestVecReaderWriter(t *testing.T) {
 					"subCells = %d, periodic = %v",
 					i, tests[i].nSide, tests[i].subCells, periodic)
 			}
+			if rd.N() != len(vec) {
+				t.Errorf("%d) Expected N() = %d, got %d.", i, len(vec), rd.N())
+			}
 			if *hd != rd.Header {
-				t.Errorf("%d) Expected header %v, got %v.", *hd, rd.Header)
+				t.Errorf("%d) Expected header %v, got %v.", i, *hd, rd.Header)
 			}
 			if !bytesEq(rawHd, rd.RawHeader) {
 				t.Errorf("%d) Expected raw header %v, got %v.",
-					rawHd, rd.RawHeader)
+					i, rawHd, rd.RawHeader)
 			}
 			if rd.FileIndex != 0 || 
 				rd.FileCells != int(tests[i].fileCells) ||
 				rd.Dx != dx || rd.Periodic != periodic {
-				t.Errorf("%d) Incorrect header read.")
+				t.Errorf("%d) Incorrect header read.", i)
 			}
 		}
 	}
@@ -82,16 +88,16 @@ func TestIDs(t *testing.T) {
 	}
 
 	for i := range indices {
-		wr := Create("test_files/test.minp")
+		wr := MustCreate("../../test_files/test.minp")
 		hd := &Header{ NSide: 10, L: 100 }
 		c := Cell{ int64(indices[i]), int64(fileCells), int64(subCells) }
 		wr.Header(hd, []byte{}, c, 1.0, true)
 		wr.Vectors(make([][3]float32, nFile*nFile*nFile))
 		wr.Close()
 
-		rd := Open("test_files/test.minp")
+		rd := MustOpen("../../test_files/test.minp")
 		out := make([]int64, nFile*nFile*nFile)
-		rd.IDs(out)
+		if err := rd.IDs(out); err != nil { t.Fatal(err) }
 
 		if !int64sEq(out, ids[i]) {
 			t.Errorf("%d) Expected IDs = %d, got %d", i, ids[i], out)
@@ -99,6 +105,58 @@ func TestIDs(t *testing.T) {
 	}
 }
 
+func TestErrors(t *testing.T) {
+	fname := "../../test_files/errors.minp"
+
+	f := minnow.MustCreate(fname)
+	f.Header(int64(0))
+	f.Close()
+
+	if _, err := Open(fname); !errors.Is(err, ErrNotMinp) {
+		t.Errorf("Expected ErrNotMinp, got %v.", err)
+	}
+
+	wr := MustCreate(fname)
+	hd := &Header{ NSide: 2, L: 100 }
+	wr.Header(hd, []byte{}, Cell{ 0, 1, 1 }, 1.0, true)
+	err := wr.Vectors(make([][3]float32, 7))
+	if !errors.Is(err, minnow.ErrTypeMismatch) {
+		t.Errorf("Expected ErrTypeMismatch, got %v.", err)
+	}
+	if err := wr.Abort(); err != nil { t.Fatal(err) }
+
+	// The aborted Writer doesn't replace the existing file.
+	if _, err := Open(fname); !errors.Is(err, ErrNotMinp) {
+		t.Errorf("Expected ErrNotMinp after Abort, got %v.", err)
+	}
+}
+
+// TestVersion1 checks that minp files written with version 1 of the minnow
+// format can still be read.
+func TestVersion1(t *testing.T) {
+	rd, err := Open("testdata/v1.minp")
+	if err != nil { t.Fatal(err) }
+	defer rd.Close()
+
+	if rd.NSide != 4 || rd.L != 100 || rd.FileCells != 1 || !rd.Periodic ||
+		string(rd.RawHeader) != "raw" {
+		t.Errorf("Incorrect header read: %v.", rd.Header)
+	}
+
+	vec := make([][3]float32, 64)
+	for i := range vec {
+		vec[i] = [3]float32{ float32(i), float32(i) + 0.5, 99 - float32(i) }
+	}
+	if rd.N() != len(vec) {
+		t.Errorf("Expected N() = %d, got %d.", len(vec), rd.N())
+	}
+	out := make([][3]float32, len(vec))
+	if err := rd.Vectors(out); err != nil { t.Fatal(err) }
+	if !vectorsEq(vec, out, float32(rd.Dx)) {
+		t.Errorf("Expected vectors %v, got %v.", vec, out)
+	}
+}
+
 func int64sEq(x, y []int64) bool {
 	if len(x) != len(y) { return false }
 	for i := range x {
@@ -158,24 +216,18 @@ func TestGetSubCell(t *testing.T) {
 	subCells3 := subCells*subCells*subCells	
 	nFile3 := nFile*nFile*nFile
 
-	inSubBuf := [3][]float32{
-		make([]float32, nSub3), make([]float32, nSub3), make([]float32, nSub3),
-	}
-	outSubBuf := [3][]float32{
-		make([]float32, nSub3), make([]float32, nSub3), make([]float32, nSub3),
-	}
+	inSubBuf := make([][3]float32, nSub3)
+	outSubBuf := make([][3]float32, nSub3)
 
 	for i := 0; i < nSub3; i++ {
-		inSubBuf[0][i] = float32(i)
-		inSubBuf[1][i] = float32(i*10)
-		inSubBuf[2][i] = float32(i*100)
+		inSubBuf[i] = [3]float32{ float32(i), float32(i*10), float32(i*100) }
 	}
 
 	vec := make([][3]float32, nFile3)
 
 	for sc := 0; sc < subCells3; sc++ {
-		for k := 0; k < 3; k++ {
-			for i := range inSubBuf[k] { inSubBuf[k][i] += 1 }
+		for i := range inSubBuf {
+			for k := 0; k < 3; k++ { inSubBuf[i][k] += 1 }
 		}
 
 		setSubCell(vec, inSubBuf, sc, subCells, nSub)
@@ -188,12 +240,10 @@ func TestGetSubCell(t *testing.T) {
 	}
 }
 
-func subBufEq(buf1, buf2 [3][]float32) bool {
-	for k := 0; k < 3; k++ {
-		if len(buf1[k]) != len(buf2[k]) { return false }
-		for i := range buf1[k] {
-			if buf1[k][i] != buf2[k][i] { return false }
-		}
+func subBufEq(buf1, buf2 [][3]float32) bool {
+	if len(buf1) != len(buf2) { return false }
+	for i := range buf1 {
+		if buf1[i] != buf2[i] { return false }
 	}
 	return true
 }
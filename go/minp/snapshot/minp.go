@@ -20,7 +20,8 @@ type MinP struct {
 
 func NewMinP(dir, fileFmt string, fileCells, subCells int) (Snapshot, error) {
 	m := &MinP{ dir: dir, fileFmt: fileFmt }
-	f0 := minp.Open(m.fileName("x", 0))
+	f0, err := minp.Open(m.fileName("x", 0))
+	if err != nil { return nil, err }
 	defer f0.Close()
 
 	m.fileCells = f0.FileCells
@@ -58,23 +59,26 @@ func (m *MinP) UniformMass() bool {
 }
 
 func (m *MinP) ReadX(i int) ([][3]float32, error) {
-	f := minp.Open(m.fileName("x", i))
-	f.Vectors(m.vecBuffer)
-	f.Close()
-	return m.vecBuffer, nil
+	return m.readVectors("x", i)
 }
 
 func (m *MinP) ReadV(i int) ([][3]float32, error) {
-	f := minp.Open(m.fileName("v", i))
-	f.Vectors(m.vecBuffer)
-	f.Close()
+	return m.readVectors("v", i)
+}
+
+func (m *MinP) readVectors(v string, i int) ([][3]float32, error) {
+	f, err := minp.Open(m.fileName(v, i))
+	if err != nil { return nil, err }
+	defer f.Close()
+	if err := f.Vectors(m.vecBuffer); err != nil { return nil, err }
 	return m.vecBuffer, nil
 }
 
 func (m *MinP) ReadID(i int) ([]int64, error) {
-	f := minp.Open(m.fileName("x", i))
-	f.IDs(m.idBuffer)
-	f.Close()
+	f, err := minp.Open(m.fileName("x", i))
+	if err != nil { return nil, err }
+	defer f.Close()
+	if err := f.IDs(m.idBuffer); err != nil { return nil, err }
 	return m.idBuffer, nil
 }
 
@@ -97,27 +101,29 @@ func WriteMinP(
 
 	for i := 0; i < snap.Files(); i++ {
 		c := minp.Cell{ int64(i), int64(fileCells), int64(subCells) }
-        f := minp.Create(path.Join(dir, fmt.Sprintf(fnameFmt, "x", i)))
+        f := minp.MustCreate(path.Join(dir, fmt.Sprintf(fnameFmt, "x", i)))
 
-        f.Header(snap.Header(), snap.RawHeader(i), c, dx, true)
+        err := f.Header(snap.Header(), snap.RawHeader(i), c, dx, true)
+        if err != nil { panic(err.Error())  }
 
         x, err := snap.ReadX(i)
         if err != nil { panic(err.Error())  }
-        f.Vectors(x)
+        if err = f.Vectors(x); err != nil { panic(err.Error())  }
 
-		f.Close()
+		if err = f.Close(); err != nil { panic(err.Error())  }
 	}
 
 	for i := 0; i < snap.Files(); i++ {
 		c := minp.Cell{ int64(i), int64(fileCells), int64(subCells) }
-        f := minp.Create(path.Join(dir, fmt.Sprintf(fnameFmt, "v", i)))
+        f := minp.MustCreate(path.Join(dir, fmt.Sprintf(fnameFmt, "v", i)))
 
-        f.Header(snap.Header(), snap.RawHeader(i), c, dv, false)
+        err := f.Header(snap.Header(), snap.RawHeader(i), c, dv, false)
+        if err != nil { panic(err.Error())  }
 
         v, err := snap.ReadX(i)
         if err != nil { panic(err.Error())  }
-        f.Vectors(v)
+        if err = f.Vectors(v); err != nil { panic(err.Error())  }
 
-		f.Close()		
+		if err = f.Close(); err != nil { panic(err.Error())  }
 	}
 }
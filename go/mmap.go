@@ -0,0 +1,177 @@
+package minnow
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"unsafe"
+)
+
+// hostLittleEndian is true if the machine stores integers little-endian, the
+// same as minnow files.
+var hostLittleEndian = func() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}()
+
+// mapping is a memory-mapped file which is unmapped on Close.
+type mapping struct {
+	data []byte
+}
+
+func (m *mapping) Close() error {
+	return munmap(m.data)
+}
+
+// OpenMmap opens a minnow file by memory-mapping it. Reads are served
+// directly from the mapping and DataView can return blocks of fixed-size
+// groups without copying them. On platforms other than Linux, OpenMmap is
+// the same as Open.
+//
+// The file must not be truncated while the Reader is open. Recover and
+// aborted or failed appends (see OpenAppend) can truncate files, and reading
+// a part of the mapping that was cut off crashes the program with SIGBUS.
+// Mapping the file privately wouldn't prevent this, since pages which haven't
+// been read yet still come from the file.
+func OpenMmap(fname string) (*Reader, error) {
+	f, err := os.Open(fname)
+	if err != nil { return nil, err }
+
+	data, err := mmapFile(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	} else if data == nil {
+		// mmap isn't supported or the file is empty: read f normally.
+		rd, err := newReader(f, fname)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		rd.closer = f
+		return rd, nil
+	}
+
+	// The mapping stays valid after f is closed.
+	if err := f.Close(); err != nil {
+		munmap(data)
+		return nil, err
+	}
+	rd, err := newReader(bytes.NewReader(data), fname)
+	if err != nil {
+		munmap(data)
+		return nil, err
+	}
+	rd.mapped = data
+	rd.closer = &mapping{ data }
+	return rd, nil
+}
+
+// DataView returns the contents of block b as a newly allocated slice with
+// the default type for its group (see TypeMatch): []int64 for IntGroup,
+// []float32 for FloatGroup, [][]byte for BytesGroup, etc.
+//
+// If the Reader was opened with OpenMmap and block b is in a fixed-size
+// group, the returned slice aliases the mapped file instead. It must not be
+// modified and it's only valid until the Reader is closed. Blocks in all
+// other groups are decoded with Data. User-defined groups are not supported.
+func (rd *Reader) DataView(b int) (interface{}, error) {
+	if b < 0 || b >= rd.blocks {
+		return nil, fmt.Errorf("minnow: block %d is not in the range [0, %d)",
+			b, rd.blocks)
+	}
+	i := rd.blockIndex[b]
+
+	if g, ok := rd.readers[i].(*fixedSizeGroup); ok {
+		if out, ok, err := rd.fixedSizeView(g, i, b); ok { return out, err }
+	}
+
+	out := newBlockSlice(rd.dataType(b), rd.dataLen(b))
+	if out == nil {
+		return nil, fmt.Errorf("%w: DataView can't read block %d, which " +
+			"has group type %d", ErrUnknownGroup, b, rd.dataType(b))
+	}
+	if err := rd.Data(b, out); err != nil { return nil, err }
+	return out, nil
+}
+
+// fixedSizeView returns a slice aliasing the mapped contents of block b,
+// which is in the ith group, g. ok is false if the block can't be aliased,
+// either because the Reader isn't memory-mapped, the host isn't
+// little-endian, or the block isn't aligned to its element size. Writer aligns
+// fixed-size groups, but older files may not be.
+func (rd *Reader) fixedSizeView(
+	g *fixedSizeGroup, i, b int,
+) (out interface{}, ok bool, err error) {
+	n := g.length(b)
+	if rd.mapped == nil || !hostLittleEndian || n == 0 {
+		return nil, false, nil
+	}
+
+	start := rd.groupOffsets[i] + g.blockOffset(b)
+	end := start + g.blockSize(b)
+	if start < 0 || end > int64(len(rd.mapped)) {
+		return nil, true, fmt.Errorf("%w: block %d ends at byte %d, past " +
+			"the end of the file", ErrTruncated, b, end)
+	} else if start % g.typeSize != 0 {
+		return nil, false, nil
+	}
+
+	data := rd.mapped[start:end:end]
+	if rd.verifyOnRead && rd.version >= 2 {
+		err := checkCRC(data, rd.blockCRCs[b], "block", b)
+		if err != nil { return nil, true, err }
+	}
+
+	p := unsafe.Pointer(&data[0])
+	switch g.gt {
+	case Int64Group:
+		var x []int64
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	case Int32Group:
+		var x []int32
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	case Int16Group:
+		var x []int16
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	case Int8Group:
+		var x []int8
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	case Uint64Group:
+		var x []uint64
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	case Uint32Group:
+		var x []uint32
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	case Uint16Group:
+		var x []uint16
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	case Uint8Group:
+		return data, true, nil
+	case Float64Group:
+		var x []float64
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	case Float32Group:
+		var x []float32
+		setSliceHeader(unsafe.Pointer(&x), p, n)
+		return x, true, nil
+	}
+	return nil, false, nil
+}
+
+// setSliceHeader points the slice at x to n elements starting at p. p must
+// not point to memory managed by the garbage collector. This is the same as
+// unsafe.Slice, which isn't available before Go 1.17.
+func setSliceHeader(x, p unsafe.Pointer, n int) {
+	hd := (*reflect.SliceHeader)(x)
+	hd.Data, hd.Len, hd.Cap = uintptr(p), n, n
+}
@@ -0,0 +1,34 @@
+//go:build linux
+// +build linux
+
+package minnow
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the contents of f into memory as read-only. A nil slice is
+// returned if f is empty.
+func mmapFile(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil { return nil, err }
+	size := info.Size()
+	if size == 0 { return nil, nil }
+	if int64(int(size)) != size {
+		return nil, &os.PathError{ Op: "mmap", Path: f.Name(),
+			Err: syscall.EFBIG }
+	}
+
+	data, err := syscall.Mmap(int(f.Fd()), 0, int(size),
+		syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{ Op: "mmap", Path: f.Name(), Err: err }
+	}
+	return data, nil
+}
+
+// munmap unmaps memory returned by mmapFile.
+func munmap(data []byte) error {
+	return syscall.Munmap(data)
+}
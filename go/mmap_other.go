@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package minnow
+
+import (
+	"os"
+)
+
+// mmapFile always returns a nil slice on platforms without mmap support, so
+// OpenMmap falls back to normal reads.
+func mmapFile(f *os.File) ([]byte, error) {
+	return nil, nil
+}
+
+// munmap unmaps memory returned by mmapFile.
+func munmap(data []byte) error {
+	return nil
+}
@@ -1,59 +1,220 @@
 package minnow
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
 	"os"
+	"reflect"
 )
 
 //////////////////
 // Reader //
 //////////////////
 
-// Reader represents an open minnow file.
+// Reader represents an open minnow file. Once opened, a Reader's methods are
+// safe for concurrent use by multiple goroutines, provided that the underlying
+// io.ReaderAt is. *os.File and Buffer both are.
 type Reader struct {
-	f *os.File
+	f io.ReaderAt
+	closer io.Closer
 
+	version int
 	groups, headers, blocks int
 
 	readers []group
 	blockIndex []int
 	
 	headerOffsets, headerSizes []int64
+	headerNames, headerSchemas []string
 	groupOffsets, groupSizes, groupHeaderSizes []int64
 	groupTypes []int64
+	headerCRCs, blockCRCs []uint32
+	blockStats []BlockStats
+
+	verifyOnRead bool
+
+	// mapped is the contents of the file if it was opened with OpenMmap.
+	mapped []byte
 }
 
 // Open opens a minnow file.
-func Open(fname string) *Reader {
+func Open(fname string) (*Reader, error) {
 	f, err := os.Open(fname)
+	if err != nil { return nil, err }
+
+	rd, err := newReader(f, fname)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	rd.closer = f
+	return rd, nil
+}
+
+// NewReader returns a Reader for the minnow file stored in r. Offsets are
+// relative to the start of r, so files embedded in larger files can be read by
+// wrapping them with io.NewSectionReader. If r doesn't have a Size, Stat, or
+// Len method which gives the size of the file, everything after the start of
+// the tail is read into memory while it's parsed. Closing the Reader does not
+// close r.
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	return newReader(r, "minnow file")
+}
+
+// MustOpen is the same as Open, but panics on errors.
+func MustOpen(fname string) *Reader {
+	rd, err := Open(fname)
 	if err != nil { panic(err.Error()) }
+	return rd
+}
+
+// newReader reads the header and tail of the minnow file r. fname is only
+// used in error messages.
+func newReader(r io.ReaderAt, fname string) (*Reader, error) {
+	f := io.NewSectionReader(r, 0, math.MaxInt64)
 
 	// Read header
 
 	minHd := &minnowHeader{}
-	binaryRead(f, minHd)
+	if err := binaryRead(f, minHd); err != nil {
+		if errors.Is(err, ErrTruncated) {
+			return nil, fmt.Errorf("%w: %s is too short to contain a " +
+				"minnow header", ErrNotMinnow, fname)
+		}
+		return nil, err
+	}
 
 	// Check that this is a file we can actually read.
 
 	if minHd.Magic != Magic {
-		panic(fmt.Sprintf("%s is not a minnow file. Magic number is %x, " + 
-			"not %x.", fname, minHd.Magic, Magic))
-	} else if minHd.Version != Version {
-		panic(fmt.Sprintf("%s was written with minnow verison %d, but this " +
-			"code has version %d. See the github page for instrucitons on " + 
-			"retrieving a specific version.", fname, minHd.Version, Version))
+		return nil, fmt.Errorf("%w: %s has magic number %x, not %x",
+			ErrNotMinnow, fname, minHd.Magic, Magic)
+	} else if minHd.Version < MinVersion || minHd.Version > Version {
+		return nil, fmt.Errorf("%w: %s was written with minnow version %d, " +
+			"but this code can only read versions %d to %d. See the github " +
+			"page for instructions on retrieving a specific version",
+			ErrVersion, fname, minHd.Version, MinVersion, Version)
 	}
 
 	rd := &Reader{
-		f: f, groups: int(minHd.Groups),
+		f: r, version: int(minHd.Version), groups: int(minHd.Groups),
 		headers: int(minHd.Headers), blocks: int(minHd.Blocks),
 	}
 
-	// Read tail data
+	// Read tail data. The tail is parsed as it's read from the file, and then
+	// its checksum is checked. The tail normally runs to the end of the file,
+	// but it may be followed by the blocks of an append which was never
+	// closed, so only the bytes which are parsed are read. Counts in the tail
+	// are checked against the bytes left in the file before anything is
+	// allocated.
+
+	if minHd.TailStart < int64(binary.Size(minHd)) {
+		return nil, fmt.Errorf("%w: %s has a tail which starts at byte %d",
+			ErrTruncated, fname, minHd.TailStart)
+	}
+	src, err := tailSource(r, minHd.TailStart)
+	if err != nil { return nil, err }
 
-	_, err = f.Seek(minHd.TailStart, 0)
-	if err != nil { panic(err.Error()) }	
+	tr := &tailReader{
+		crcReader{ r: bufio.NewReader(src) }, src.Size(), int64(rd.blocks),
+	}
+	if err := rd.readTail(tr, fname); err != nil {
+		// A tail which matches the checksum at the end of the file is intact,
+		// so the error, e.g. ErrUnknownGroup, is returned as is. Otherwise,
+		// the tail is probably corrupt.
+		if rd.version >= 2 && !errors.Is(err, ErrChecksum) {
+			intact, ioErr := tailIntact(src, minHd)
+			if ioErr != nil { return nil, ioErr }
+			if !intact { return nil, &tailError{ fname, err } }
+		}
+		return nil, err
+	}
+
+	if rd.version >= 2 {
+		// The tail checksum also covers the minnowHeader.
+		hdCW := &crcWriter{ w: ioutil.Discard, crc: tr.crc }
+		if err := binaryWrite(hdCW, minHd); err != nil { return nil, err }
+		var tailCRC uint32
+		if err := binaryRead(tr, &tailCRC); err != nil { return nil, err }
+		if tailCRC != hdCW.crc {
+			return nil, fmt.Errorf("%w: %s has a corrupt tail",
+				ErrChecksum, fname)
+		}
+	}
+
+	if err := rd.checkLayout(minHd.TailStart, fname); err != nil {
+		return nil, err
+	}
+	return rd, nil
+}
+
+// tailSource returns a reader for everything from tailStart to the end of r.
+// If the size of r can't be found, everything after tailStart is read into
+// memory instead.
+func tailSource(r io.ReaderAt, tailStart int64) (*io.SectionReader, error) {
+	size := int64(-1)
+	switch r := r.(type) {
+	case interface{ Size() int64 }:
+		size = r.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		info, err := r.Stat()
+		if err != nil { return nil, err }
+		size = info.Size()
+	case interface{ Len() int }:
+		// Buffer's length is its size.
+		size = int64(r.Len())
+	}
+
+	// Sizes can be upper bounds, like those of io.SectionReaders which run
+	// past the ends of their files, so the last byte has to exist.
+	if size > 0 {
+		if n, _ := r.ReadAt(make([]byte, 1), size - 1); n == 1 {
+			n := size - tailStart
+			if n < 0 { n = 0 }
+			return io.NewSectionReader(r, tailStart, n), nil
+		}
+	}
+
+	data, err := ioutil.ReadAll(io.NewSectionReader(
+		r, tailStart, math.MaxInt64 - tailStart,
+	))
+	if err != nil { return nil, err }
+	return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data))), nil
+}
+
+// tailIntact returns true if the tail in src, which runs to the end of the
+// file, matches the checksum at its end.
+func tailIntact(src *io.SectionReader, hd *minnowHeader) (bool, error) {
+	n := src.Size() - 4
+	if n < 0 { return false, nil }
+
+	cw := &crcWriter{ w: ioutil.Discard }
+	if _, err := io.Copy(cw, io.NewSectionReader(src, 0, n)); err != nil {
+		return false, err
+	}
+	if err := binaryWrite(cw, hd); err != nil { return false, err }
+
+	var tailCRC uint32
+	err := binaryRead(io.NewSectionReader(src, n, 4), &tailCRC)
+	if err != nil { return false, err }
+	return tailCRC == cw.crc, nil
+}
+
+// readTail reads everything in the tail up to its checksum from f.
+func (rd *Reader) readTail(f *tailReader, fname string) error {
+	for _, n := range []int64{ int64(rd.headers), int64(rd.groups) } {
+		if err := checkCount(f, n, 16); err != nil { return err }
+	}
+	if err := checkBlocks(f, int64(rd.blocks)); err != nil { return err }
+	if rd.version >= 2 {
+		if err := checkCount(f, int64(rd.blocks), 4); err != nil { return err }
+	}
 
 	rd.headerOffsets = make([]int64, rd.headers)
 	rd.headerSizes = make([]int64, rd.headers)
@@ -69,10 +230,50 @@ func Open(fname string) *Reader {
 	// Read group data
 
 	for _, data := range tailData {
-		binaryRead(f, data)
+		if err := binaryRead(f, data); err != nil { return err }
 	}
+
+	blocks := int64(0)
+	for _, n := range groupBlocks {
+		if n < 0 || n > int64(rd.blocks) - blocks {
+			return fmt.Errorf("%w: %s has more blocks in its groups than " +
+				"the %d in its header", ErrTruncated, fname, rd.blocks)
+		}
+		blocks += n
+	}
+	if blocks != int64(rd.blocks) {
+		return fmt.Errorf("%w: %s has %d blocks in its groups, but %d in " +
+			"its header", ErrTruncated, fname, blocks, rd.blocks)
+	}
+
+	startBlock := 0
 	for i := 0; i < rd.groups; i++ {
-		rd.readers = append(rd.readers, groupFromTail(f, rd.groupTypes[i]))
+		g, err := groupFromTail(f, rd.groupTypes[i], startBlock)
+		if err != nil { return err }
+		g.setStartBlock(startBlock)
+		if cg, ok := g.(countedGroup); ok && cg.blocks() != groupBlocks[i] {
+			return fmt.Errorf("%w: group %d of %s has %d blocks, but %d " +
+				"in its tail", ErrTruncated, i, fname, groupBlocks[i],
+				cg.blocks())
+		}
+		rd.readers = append(rd.readers, g)
+		startBlock += int(groupBlocks[i])
+	}
+
+	var err error
+	if rd.version >= 5 {
+		rd.headerNames, rd.headerSchemas, err = readHeaderNames(f, rd.headers)
+		if err != nil { return err }
+	} else {
+		rd.headerNames = make([]string, rd.headers)
+		rd.headerSchemas = make([]string, rd.headers)
+	}
+
+	if rd.version >= 6 {
+		if err := rd.readStats(f); err != nil { return err }
+	} else {
+		rd.blockStats = make([]BlockStats, rd.blocks)
+		for i := range rd.blockStats { rd.blockStats[i] = unknownStats(-1) }
 	}
 
 	rd.blockIndex = make([]int, rd.blocks)
@@ -84,25 +285,161 @@ func Open(fname string) *Reader {
 		}
 	}
 
-	return rd
+	if rd.version < 2 { return nil }
+
+	// Read checksums (version >= 2)
+
+	for _, n := range []int{ rd.headers, rd.blocks } {
+		if err := checkCount(f, int64(n), 4); err != nil { return err }
+	}
+	rd.headerCRCs = make([]uint32, rd.headers)
+	rd.blockCRCs = make([]uint32, rd.blocks)
+	if err := binaryRead(f, rd.headerCRCs); err != nil { return err }
+	return binaryRead(f, rd.blockCRCs)
+}
+
+// checkLayout returns an error if any block in the file doesn't fit between
+// the minnowHeader and the tail at tailStart, or if a block holds more elements
+// than its size allows. This keeps corrupt tails from causing huge allocations
+// when blocks are read.
+func (rd *Reader) checkLayout(tailStart int64, fname string) error {
+	hdSize := int64(binary.Size(minnowHeader{ }))
+	for b := 0; b < rd.blocks; b++ {
+		i := rd.blockIndex[b]
+		g := rd.readers[i]
+		off, size, n := rd.groupOffsets[i] + g.blockOffset(b),
+			g.blockSize(b), int64(g.length(b))
+		if off < hdSize || size < 0 || size > tailStart - off {
+			return fmt.Errorf("%w: block %d of %s has %d bytes at offset " +
+				"%d, but the tail starts at %d", ErrTruncated, b, fname,
+				size, off, tailStart)
+		}
+		if mb, ok := g.(minBitsGroup); ok {
+			bits, packed := mb.minBits(b)
+			if bits > 0 && packed > size*8 / bits {
+				return fmt.Errorf("%w: block %d of %s has %d elements, but " +
+					"only %d bytes", ErrTruncated, b, fname, n, size)
+			}
+		}
+	}
+	return nil
+}
+
+// countedGroup is implemented by groups which know how many blocks they have.
+// Every group does, including user-defined ones.
+type countedGroup interface {
+	blocks() int64
+}
+
+// minBitsGroup is implemented by groups which pack n of the elements of block
+// b into at least minBits bits each, so that the length of their blocks is
+// bounded by their size. Blocks where bits is zero aren't bounded.
+type minBitsGroup interface {
+	minBits(b int) (bits, n int64)
+}
+
+// tailError is returned when a tail can't be parsed and doesn't match the
+// checksum at the end of the file. It matches ErrChecksum, since the tail is
+// probably corrupt, and wraps the error that stopped the parse.
+type tailError struct {
+	fname string
+	err error
+}
+
+func (e *tailError) Error() string {
+	return fmt.Sprintf("%v: %s has a corrupt tail (%v)",
+		ErrChecksum, e.fname, e.err)
+}
+
+func (e *tailError) Is(target error) bool { return target == ErrChecksum }
+
+func (e *tailError) Unwrap() error { return e.err }
+
+// tailReader reads a tail and computes its checksum. left is the number of
+// bytes left in the file and blocks is the number of blocks in the
+// minnowHeader.
+type tailReader struct {
+	crcReader
+	left, blocks int64
+}
+
+func (tr *tailReader) Read(p []byte) (int, error) {
+	n, err := tr.crcReader.Read(p)
+	tr.left -= int64(n)
+	return n, err
+}
+
+// checkCount returns an error if count is negative or if f is a tailReader
+// without enough bytes left for count elements of size bytes. It's called
+// before slices are allocated from counts stored in tails.
+func checkCount(f io.Reader, count, size int64) error {
+	left := int64(math.MaxInt64)
+	if tr, ok := f.(*tailReader); ok { left = tr.left }
+	if count < 0 || (size > 0 && count > left / size) {
+		return fmt.Errorf("%w: tail has a count of %d, but only %d bytes " +
+			"are left in it", ErrTruncated, count, left)
+	}
+	return nil
+}
+
+// checkBlocks returns an error if blocks is negative or if f is a tailReader
+// and blocks is larger than the number of blocks in the file.
+func checkBlocks(f io.Reader, blocks int64) error {
+	if err := checkCount(f, blocks, 0); err != nil { return err }
+	if tr, ok := f.(*tailReader); ok && blocks > tr.blocks {
+		return fmt.Errorf("%w: tail has a group with %d blocks, but the " +
+			"file only has %d", ErrTruncated, blocks, tr.blocks)
+	}
+	return nil
 }
 
 
 // Header reads the ith header in the minnow file.
-func (rd *Reader) Header(i int, out interface{}) {
+func (rd *Reader) Header(i int, out interface{}) error {
+	if i < 0 || i >= rd.headers {
+		return fmt.Errorf("minnow: header %d is not in the range [0, %d)",
+			i, rd.headers)
+	}
 	if binary.Size(out) != int(rd.headerSizes[i]) {
-		panic(fmt.Sprintf("Header buffer has size %d, but written header " + 
-			"has size %d.", binary.Size(out), rd.headerSizes[i]))
+		return fmt.Errorf("%w: header buffer has size %d, but written " +
+			"header has size %d", ErrTypeMismatch, binary.Size(out),
+			rd.headerSizes[i])
 	}
 
-	_, err := rd.f.Seek(rd.headerOffsets[i], 0)
-	if err != nil { panic(err.Error()) }
-	binaryRead(rd.f, out)
+	buf := getBytes(int(rd.headerSizes[i]))
+	defer putBytes(buf)
+	if err := rd.readAt(*buf, rd.headerOffsets[i]); err != nil { return err }
+	if rd.verifyOnRead && rd.version >= 2 {
+		err := checkCRC(*buf, rd.headerCRCs[i], "header", i)
+		if err != nil { return err }
+	}
+	return binaryRead(bytes.NewReader(*buf), out)
+}
+
+// SetDequantization overrides the Dequantization stored in the file for every
+// float group. It should not be called concurrently with other methods.
+func (rd *Reader) SetDequantization(mode Dequantization) {
+	for _, g := range rd.readers {
+		switch g := g.(type) {
+		case *floatGroup: g.override = int(mode)
+		case *vecGroup: g.override = int(mode)
+		}
+	}
+}
+
+// Version returns the version of the file format that the file was written
+// with.
+func (rd *Reader) Version() int {
+	return rd.version
 }
 
 // HeaderSize returns the number of bytes in ith header in the file.
-func (rd *Reader) HeaderSize(i int) int {
-	return int(rd.headerSizes[i])
+func (rd *Reader) HeaderSize(i int) (int, error) {
+	if i < 0 || i >= rd.headers {
+		return 0, fmt.Errorf("minnow: header %d is not in the range [0, %d)",
+			i, rd.headers)
+	}
+	return int(rd.headerSizes[i]), nil
 }
 
 // Blocks returns the number of data blocks in the file.
@@ -111,37 +448,148 @@ func (rd *Reader) Blocks() int {
 }
 
 // Data reads the bth data block in the file.
-func (rd *Reader) Data(b int, out interface{}) {
+func (rd *Reader) Data(b int, out interface{}) error {
+	if b < 0 || b >= rd.blocks {
+		return fmt.Errorf("minnow: block %d is not in the range [0, %d)",
+			b, rd.blocks)
+	}
 	i := rd.blockIndex[b]
 	
-	if err := TypeMatch(out, rd.DataType(b)); err != nil {
-		panic(err.Error())
+	if err := TypeMatch(out, rd.dataType(b)); err != nil {
+		return err
+	} else if n := sliceLen(out); n >= 0 && n < rd.dataLen(b) {
+		return fmt.Errorf("%w: block %d has length %d, but the output " +
+			"buffer has length %d", ErrTypeMismatch, b, rd.dataLen(b), n)
 	}
 
-	_, err := rd.f.Seek(rd.groupOffsets[i], 0)
-	if err != nil { panic(err.Error()) }
-	_, err = rd.f.Seek(rd.readers[i].blockOffset(b), 1)
-	if err != nil { panic(err.Error()) }
+	buf, err := rd.readBlock(b)
+	if err != nil { return err }
+	defer putBytes(buf)
+	if rd.verifyOnRead && rd.version >= 2 {
+		err := checkCRC(*buf, rd.blockCRCs[b], "block", b)
+		if err != nil { return err }
+	}
 
-	rd.readers[i].readData(rd.f, b, out)
+	return rd.readers[i].readData(*buf, b, out)
+}
+
+// DataRange reads elements [start, end) of the bth data block into out. For
+// fixed-size groups, IntGroup, and FloatGroup, only the bytes holding those
+// elements are read and decoded, and checksums aren't checked. Blocks in other
+// groups are read with Data and then copied.
+func (rd *Reader) DataRange(b, start, end int, out interface{}) error {
+	if b < 0 || b >= rd.blocks {
+		return fmt.Errorf("minnow: block %d is not in the range [0, %d)",
+			b, rd.blocks)
+	} else if n := rd.dataLen(b); start < 0 || end > n || start > end {
+		return fmt.Errorf("minnow: range [%d, %d) is not in block %d, " +
+			"which has length %d", start, end, b, n)
+	}
+
+	if err := TypeMatch(out, rd.dataType(b)); err != nil {
+		return err
+	} else if n := sliceLen(out); n >= 0 && n < end - start {
+		return fmt.Errorf("%w: range [%d, %d) has length %d, but the " +
+			"output buffer has length %d", ErrTypeMismatch, start, end,
+			end - start, n)
+	}
+
+	i := rd.blockIndex[b]
+	g := rd.readers[i]
+	if rg, ok := g.(rangeGroup); ok {
+		lo, hi := rg.rangeBytes(b, start, end)
+		buf := getBytes(int(hi - lo))
+		defer putBytes(buf)
+		err := rd.readAt(*buf, rd.groupOffsets[i] + g.blockOffset(b) + lo)
+		if err != nil { return err }
+		return rg.readRange(*buf, b, start, end, out)
+	}
+
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Slice {
+		return fmt.Errorf("%w: DataRange needs a slice to read block %d " +
+			"into, got %s", ErrTypeMismatch, b, v.Type())
+	}
+	all := reflect.MakeSlice(v.Type(), rd.dataLen(b), rd.dataLen(b))
+	if err := rd.Data(b, all.Interface()); err != nil { return err }
+	reflect.Copy(v, all.Slice(start, end))
+	return nil
+}
+
+// Element reads the ith element of the bth data block into out, which must
+// be a pointer to the element type of the block, e.g. *float32 for a
+// FloatGroup. It's the same as a call to DataRange with a length-one range.
+func (rd *Reader) Element(b, i int, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("%w: Element needs a non-nil pointer to read " +
+			"into, got %T", ErrTypeMismatch, out)
+	}
+	buf := reflect.MakeSlice(reflect.SliceOf(v.Elem().Type()), 1, 1)
+	if err := rd.DataRange(b, i, i + 1, buf.Interface()); err != nil {
+		return err
+	}
+	v.Elem().Set(buf.Index(0))
+	return nil
+}
+
+// readBlock reads the raw bytes of block b into a buffer from the byte pool.
+func (rd *Reader) readBlock(b int) (*[]byte, error) {
+	i := rd.blockIndex[b]
+	g := rd.readers[i]
+	buf := getBytes(int(g.blockSize(b)))
+	err := rd.readAt(*buf, rd.groupOffsets[i] + g.blockOffset(b))
+	if err != nil {
+		putBytes(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// readAt fills buf with the bytes starting at off.
+func (rd *Reader) readAt(buf []byte, off int64) error {
+	n, err := rd.f.ReadAt(buf, off)
+	if n == len(buf) { return nil }
+	if err == io.EOF { err = io.ErrUnexpectedEOF }
+	return ioError(err)
 }
 
 // DataType returns an integer representing the group type of block be.
-func (rd *Reader) DataType(b int) int64 {
-	return rd.groupTypes[rd.blockIndex[b]]
+func (rd *Reader) DataType(b int) (int64, error) {
+	if b < 0 || b >= rd.blocks {
+		return -1, fmt.Errorf("minnow: block %d is not in the range [0, %d)",
+			b, rd.blocks)
+	}
+	return rd.dataType(b), nil
 }
 
 // DataLen returns the number of element in block b.
-func (rd *Reader) DataLen(b int) int {
+func (rd *Reader) DataLen(b int) (int, error) {
+	if b < 0 || b >= rd.blocks {
+		return 0, fmt.Errorf("minnow: block %d is not in the range [0, %d)",
+			b, rd.blocks)
+	}
+	return rd.dataLen(b), nil
+}
+
+// dataType and dataLen are the same as DataType and DataLen, but don't check
+// that b is in range.
+
+func (rd *Reader) dataType(b int) int64 {
+	return rd.groupTypes[rd.blockIndex[b]]
+}
+
+func (rd *Reader) dataLen(b int) int {
 	return rd.readers[rd.blockIndex[b]].length(b)
 }
 
-// Close closes the file.
-func (rd *Reader) Close() {
-	rd.f.Close()
+// Close closes the file if it was opened by Open or OpenMmap.
+func (rd *Reader) Close() error {
+	if rd.closer == nil { return nil }
+	return rd.closer.Close()
 }
 
-func binaryRead(f *os.File, data interface{}) {
+func binaryRead(f io.Reader, data interface{}) error {
 	err := binary.Read(f, binary.LittleEndian, data)
-	if err != nil { panic(err.Error()) }
+	return ioError(err)
 }
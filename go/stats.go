@@ -0,0 +1,208 @@
+package minnow
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// BlockStats summarizes the values in a block. Starting with version 6, the
+// statistics of every block are stored in the tail, after the header names.
+//
+// Min and Max bound the values that Reader.Data returns for the block. They
+// are exact for lossless groups and are widened to cover the edges of the
+// quantization cells for FloatGroup, EntropyFloatGroup, and vector groups.
+// Vector blocks have a single range that covers all three components, and
+// BoolGroup blocks treat false as 0 and true as 1. Min > Max if the block
+// has no values that can be ordered, e.g. if it's empty or only holds NaNs.
+//
+// Nulls is the number of NaNs written to the block. It's -1 if unknown.
+// Quantized groups read NaNs back as the lower limit of the group. So do
+// infinities in periodic groups and zero or negative values in groups with
+// the Log option, but they aren't counted in Nulls.
+//
+// Blocks in BytesGroup, user-defined groups, and files written before
+// version 6 have unknown statistics: Min = -Inf, Max = +Inf. Integers with
+// magnitudes larger than 2^53 are rounded outwards.
+type BlockStats struct {
+	Min, Max float64
+	Nulls int64
+}
+
+// Contains returns true if the block could hold values in [low, high].
+func (s BlockStats) Contains(low, high float64) bool {
+	return s.Min <= high && s.Max >= low
+}
+
+// unknownStats returns statistics which don't rule out any values.
+func unknownStats(nulls int64) BlockStats {
+	return BlockStats{ math.Inf(-1), math.Inf(+1), nulls }
+}
+
+// emptyStats returns the statistics of a block without any values.
+func emptyStats() BlockStats {
+	return BlockStats{ math.Inf(+1), math.Inf(-1), 0 }
+}
+
+// statsGroup is implemented by groups whose values change when read back, so
+// the statistics of their blocks can't be computed from the data passed to
+// writeData.
+type statsGroup interface {
+	// lastStats returns the statistics of the last block written.
+	lastStats() BlockStats
+}
+
+// add updates s to include v, counting NaNs as nulls.
+func (s *BlockStats) add(v float64) {
+	if math.IsNaN(v) {
+		s.Nulls++
+		return
+	}
+	if v < s.Min { s.Min = v }
+	if v > s.Max { s.Max = v }
+}
+
+// addInt updates s to include every value in [min, max].
+func (s *BlockStats) addInt(min, max int64) {
+	lo, hi := float64(min), float64(max)
+	// float64(math.MaxInt64) rounds up to 2^63, which doesn't fit in an
+	// int64, so it needs to be checked before converting back.
+	if lo >= 1 << 63 || int64(lo) > min {
+		lo = math.Nextafter(lo, math.Inf(-1))
+	}
+	if hi < 1 << 63 && int64(hi) < max {
+		hi = math.Nextafter(hi, math.Inf(+1))
+	}
+	s.add(lo)
+	s.add(hi)
+}
+
+// addUint updates s to include every value in [min, max].
+func (s *BlockStats) addUint(min, max uint64) {
+	lo, hi := float64(min), float64(max)
+	if lo >= 1 << 64 || uint64(lo) > min {
+		lo = math.Nextafter(lo, math.Inf(-1))
+	}
+	if hi < 1 << 64 && uint64(hi) < max {
+		hi = math.Nextafter(hi, math.Inf(+1))
+	}
+	s.add(lo)
+	s.add(hi)
+}
+
+// sliceStats returns the statistics of a block written as x.
+func sliceStats(x interface{}) BlockStats {
+	s := emptyStats()
+	if sliceLen(x) == 0 { return s }
+
+	switch data := x.(type) {
+	case []int64:
+		min, max := data[0], data[0]
+		for _, v := range data {
+			if v < min { min = v }
+			if v > max { max = v }
+		}
+		s.addInt(min, max)
+	case []int32:
+		for _, v := range data { s.add(float64(v)) }
+	case []int16:
+		for _, v := range data { s.add(float64(v)) }
+	case []int8:
+		for _, v := range data { s.add(float64(v)) }
+	case []uint64:
+		min, max := data[0], data[0]
+		for _, v := range data {
+			if v < min { min = v }
+			if v > max { max = v }
+		}
+		s.addUint(min, max)
+	case []uint32:
+		for _, v := range data { s.add(float64(v)) }
+	case []uint16:
+		for _, v := range data { s.add(float64(v)) }
+	case []uint8:
+		for _, v := range data { s.add(float64(v)) }
+	case []float64:
+		for _, v := range data { s.add(v) }
+	case []float32:
+		for _, v := range data { s.add(float64(v)) }
+	case []bool:
+		for _, v := range data {
+			if v { s.add(1) } else { s.add(0) }
+		}
+	case [][]byte, []string:
+		return unknownStats(0)
+	default:
+		return unknownStats(-1)
+	}
+	return s
+}
+
+// cellStats returns the statistics of a block of quantized values with
+// cells of width (high - low)/pixels, where the smallest and largest cells
+// used are qMin and qMax. Float32 rounding during reconstruction is covered by
+// widening the range slightly.
+func cellStats(
+	low, high float64, pixels, qMin, qMax int64, log bool,
+) BlockStats {
+	dx := (high - low) / float64(pixels)
+	eps := 1e-6 * math.Max(math.Abs(low), math.Abs(high))
+	lo := low + dx*float64(qMin) - eps
+	hi := low + dx*float64(qMax + 1) + eps
+	if log {
+		lo, hi = math.Pow(10, lo), math.Pow(10, hi)
+		lo, hi = lo - 1e-6*lo, hi + 1e-6*hi
+	}
+	return BlockStats{ lo, hi, 0 }
+}
+
+// quantizedRange returns the smallest and largest cells in q, a block of
+// quantized values that has already been passed through bound. Periodic
+// values are wrapped back into [0, pixels), the same as when they're read.
+func quantizedRange(q []int64, pixels int64, periodic bool) (min, max int64) {
+	for i, v := range q {
+		if periodic { v = ((v % pixels) + pixels) % pixels }
+		if i == 0 || v < min { min = v }
+		if i == 0 || v > max { max = v }
+	}
+	return min, max
+}
+
+// writeStats writes the statistics of every block to f.
+func (wr *Writer) writeStats(f io.Writer) error {
+	mins := make([]float64, len(wr.blockStats))
+	maxes := make([]float64, len(wr.blockStats))
+	nulls := make([]int64, len(wr.blockStats))
+	for i, s := range wr.blockStats {
+		mins[i], maxes[i], nulls[i] = s.Min, s.Max, s.Nulls
+	}
+	for _, x := range []interface{}{ mins, maxes, nulls } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	return nil
+}
+
+// readStats reads the statistics of every block from f.
+func (rd *Reader) readStats(f io.Reader) error {
+	if err := checkCount(f, int64(rd.blocks), 24); err != nil { return err }
+	mins := make([]float64, rd.blocks)
+	maxes := make([]float64, rd.blocks)
+	nulls := make([]int64, rd.blocks)
+	for _, x := range []interface{}{ mins, maxes, nulls } {
+		if err := binaryRead(f, x); err != nil { return err }
+	}
+	rd.blockStats = make([]BlockStats, rd.blocks)
+	for i := range rd.blockStats {
+		rd.blockStats[i] = BlockStats{ mins[i], maxes[i], nulls[i] }
+	}
+	return nil
+}
+
+// BlockStats returns the statistics of block b.
+func (rd *Reader) BlockStats(b int) (BlockStats, error) {
+	if b < 0 || b >= rd.blocks {
+		return BlockStats{ }, fmt.Errorf("minnow: block %d is not in the " +
+			"range [0, %d)", b, rd.blocks)
+	}
+	return rd.blockStats[b], nil
+}
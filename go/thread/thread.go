@@ -167,3 +167,73 @@ func WorkerQueue(workers, jobs int, work func(worker, job int)) {
 	close(jobChan)
 	for i := 0; i < workers; i++ { <-lockChan }
 }
+
+// Queue runs jobs on a pool of worker goroutines and returns their results in
+// the order that the jobs were pushed, regardless of the order they finish in.
+//
+// How to use:
+//
+// q := NewQueue(
+//     workers,
+//     func(worker int, job interface{}) interface{} {
+//         /* use resources associated with [worker] to do [job] */
+//     },
+// )
+// for _, job := range jobs {
+//     if q.Len() == maxPending { /* use */ q.Pop() }
+//     q.Push(job)
+// }
+// for q.Len() > 0 { /* use */ q.Pop() }
+// q.Close()
+type Queue struct {
+	jobs chan queueJob
+	pending []chan interface{}
+}
+
+type queueJob struct {
+	job interface{}
+	out chan interface{}
+}
+
+// NewQueue starts a Queue with the given number of workers.
+func NewQueue(
+	workers int, work func(worker int, job interface{}) interface{},
+) *Queue {
+	if workers < 1 { workers = 1 }
+	q := &Queue{ jobs: make(chan queueJob, workers) }
+	for i := 0; i < workers; i++ {
+		go func(workerIdx int) {
+			for j := range q.jobs { j.out <- work(workerIdx, j.job) }
+		}(i)
+	}
+	return q
+}
+
+// Push adds a job to the Queue. It blocks if every worker is busy and enough
+// jobs are already waiting for them.
+func (q *Queue) Push(job interface{}) {
+	out := make(chan interface{}, 1)
+	q.pending = append(q.pending, out)
+	q.jobs <- queueJob{ job, out }
+}
+
+// Pop waits for the oldest job which hasn't been popped yet to finish and
+// returns its result. It panics if there are no such jobs.
+func (q *Queue) Pop() interface{} {
+	if len(q.pending) == 0 { panic("Pop called on empty thread.Queue.") }
+	out := <-q.pending[0]
+	q.pending[0] = nil
+	q.pending = q.pending[1:]
+	return out
+}
+
+// Len returns the number of jobs which have been pushed but not popped.
+func (q *Queue) Len() int {
+	return len(q.pending)
+}
+
+// Close stops the workers once all pushed jobs have finished. Their results
+// can still be popped. Push must not be called after Close.
+func (q *Queue) Close() {
+	close(q.jobs)
+}
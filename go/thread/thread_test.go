@@ -2,6 +2,7 @@ package thread
 
 import (
 	"testing"
+	"time"
 )
 
 func SplitSum(xs []float64, jobs int) float64 {
@@ -110,3 +111,42 @@ func TestSplitArrayJump(t *testing.T) {
 		}
 	}
 }
+
+func TestQueue(t *testing.T) {
+	tests := []struct{ workers, maxPending, jobs int } {
+		{ 1, 1, 10 }, { 4, 4, 100 }, { 4, 16, 100 }, { 16, 2, 50 },
+	}
+	for i := range tests {
+		q := NewQueue(
+			tests[i].workers,
+			func(worker int, job interface{}) interface{} {
+				// Make earlier jobs take longer.
+				wait := time.Duration(tests[i].jobs - job.(int))
+				time.Sleep(wait*10*time.Microsecond)
+				return job.(int)*job.(int)
+			},
+		)
+
+		next := 0
+		check := func(x interface{}) {
+			if x.(int) != next*next {
+				t.Errorf("%d) Expected result %d, got %d.", i, next*next, x)
+			}
+			next++
+		}
+		for job := 0; job < tests[i].jobs; job++ {
+			if q.Len() == tests[i].maxPending { check(q.Pop()) }
+			q.Push(job)
+			if q.Len() > tests[i].maxPending {
+				t.Errorf("%d) %d jobs pending, but max is %d.", i, q.Len(),
+					tests[i].maxPending)
+			}
+		}
+		q.Close()
+		for q.Len() > 0 { check(q.Pop()) }
+		if next != tests[i].jobs {
+			t.Errorf("%d) Expected %d results, got %d.",
+				i, tests[i].jobs, next)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package minnow
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// MinUserGroup is the smallest group type ID available to user-defined groups.
+// Built-in group types will never use IDs at or above it.
+const MinUserGroup int64 = 1 << 16
+
+// Group is a codec for a user-defined group type. Block indices passed to a
+// Group count from the start of that group, not the start of the file.
+//
+// When a file is opened, the number, lengths, offsets and sizes of the
+// group's blocks are read from the Group once and checked against the rest of
+// the file. If a Group method panics while the file is being opened or read,
+// the panic is returned as an error instead.
+type Group interface {
+	// Blocks returns the number of blocks in the group.
+	Blocks() int
+	// Length returns the number of elements in block b.
+	Length(b int) int
+
+	// WriteData encodes the slice x as the group's next block and writes it
+	// to f. It should return an error wrapping ErrTypeMismatch if x has the
+	// wrong type or length.
+	WriteData(f io.Writer, x interface{}) error
+	// WriteTail writes everything needed to decode the group's blocks. It is
+	// read back by the GroupFactory registered for the group's type.
+	WriteTail(f io.Writer) error
+
+	// BlockOffset returns the offset of block b in bytes, relative to the
+	// start of the group's first block.
+	BlockOffset(b int) int64
+	// BlockSize returns the size of block b in bytes.
+	BlockSize(b int) int64
+
+	// ReadData decodes block b from data, the full contents of the block, into
+	// x. It must be safe to call concurrently.
+	ReadData(data []byte, b int, x interface{}) error
+}
+
+// GroupFactory creates a Group for reading from the tail that the Group wrote
+// with WriteTail.
+type GroupFactory func(tail io.Reader) (Group, error)
+
+var (
+	groupRegistry = map[int64]GroupFactory{ }
+	groupRegistryLock sync.RWMutex
+)
+
+// RegisterGroup registers a user-defined group type so that it can be written
+// with Writer.Group and read by Reader. id must be at least MinUserGroup and
+// cannot be registered twice. RegisterGroup is intended to be called from init
+// functions and panics if either condition is violated.
+func RegisterGroup(id int64, factory GroupFactory) {
+	groupRegistryLock.Lock()
+	defer groupRegistryLock.Unlock()
+
+	if id < MinUserGroup {
+		panic(fmt.Sprintf("minnow: group type %d is reserved for built-in " +
+			"groups. User groups must have IDs >= %d.", id, MinUserGroup))
+	} else if _, ok := groupRegistry[id]; ok {
+		panic(fmt.Sprintf("minnow: group type %d registered twice.", id))
+	}
+	groupRegistry[id] = factory
+}
+
+// registeredGroup returns the factory for a user-defined group type.
+func registeredGroup(id int64) (GroupFactory, bool) {
+	groupRegistryLock.RLock()
+	defer groupRegistryLock.RUnlock()
+	factory, ok := groupRegistry[id]
+	return factory, ok
+}
+
+// userGroup adapts a Group to the group interface used internally, which
+// indexes blocks from the start of the file.
+type userGroup struct {
+	g Group
+	gt int64
+	startBlock int
+
+	// fromTail is true if the group was read from a file. If so, the length,
+	// offset and size of each block are stored in lengths, offsets and sizes
+	// and are used instead of g's methods.
+	fromTail bool
+	lengths []int
+	offsets, sizes []int64
+}
+
+// newUserGroupFromTail creates a userGroup with the factory registered for gt
+// and reads the layout of its blocks.
+func newUserGroupFromTail(
+	f io.Reader, gt int64, factory GroupFactory,
+) (*userGroup, error) {
+	ug := &userGroup{ gt: gt, fromTail: true }
+	err := ug.call("GroupFactory", func() error {
+		var err error
+		ug.g, err = factory(f)
+		return err
+	})
+	if err != nil { return nil, err }
+
+	blocks := 0
+	err = ug.call("Blocks", func() error {
+		blocks = ug.g.Blocks()
+		return checkBlocks(f, int64(blocks))
+	})
+	if err != nil { return nil, err }
+
+	ug.lengths = make([]int, blocks)
+	ug.offsets, ug.sizes = make([]int64, blocks), make([]int64, blocks)
+	err = ug.call("block layout", func() error {
+		for b := 0; b < blocks; b++ {
+			ug.lengths[b] = ug.g.Length(b)
+			ug.offsets[b], ug.sizes[b] = ug.g.BlockOffset(b), ug.g.BlockSize(b)
+			if ug.lengths[b] < 0 {
+				return fmt.Errorf("%w: block %d of group type %d has length " +
+					"%d", ErrTruncated, b, gt, ug.lengths[b])
+			}
+		}
+		return nil
+	})
+	if err != nil { return nil, err }
+	return ug, nil
+}
+
+// call calls f and returns an error if it panics. name is the Group method
+// that f calls and is only used in error messages.
+func (g *userGroup) call(name string, f func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("minnow: %s of group type %d panicked: %v",
+				name, g.gt, r)
+		}
+	}()
+	return f()
+}
+
+func (g *userGroup) groupType() int64 { return g.gt }
+
+func (g *userGroup) blocks() int64 {
+	if g.fromTail { return int64(len(g.lengths)) }
+	return int64(g.g.Blocks())
+}
+
+func (g *userGroup) length(b int) int {
+	if g.fromTail { return g.lengths[b - g.startBlock] }
+	return g.g.Length(b - g.startBlock)
+}
+
+func (g *userGroup) writeData(f io.Writer, x interface{}) error {
+	return g.call("WriteData", func() error { return g.g.WriteData(f, x) })
+}
+
+func (g *userGroup) writeTail(f io.Writer) error {
+	return g.call("WriteTail", func() error { return g.g.WriteTail(f) })
+}
+
+func (g *userGroup) blockOffset(b int) int64 {
+	if g.fromTail { return g.offsets[b - g.startBlock] }
+	return g.g.BlockOffset(b - g.startBlock)
+}
+
+func (g *userGroup) blockSize(b int) int64 {
+	if g.fromTail { return g.sizes[b - g.startBlock] }
+	return g.g.BlockSize(b - g.startBlock)
+}
+
+func (g *userGroup) setStartBlock(b int) {
+	g.startBlock = b
+}
+
+func (g *userGroup) readData(data []byte, b int, x interface{}) error {
+	return g.call("ReadData", func() error {
+		return g.g.ReadData(data, b - g.startBlock, x)
+	})
+}
@@ -0,0 +1,227 @@
+package minnow
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+//////////////
+// vecGroup //
+//////////////
+
+// vecGroup stores [][3]float32 or [][3]float64 blocks. Each component is
+// quantized the same way as FloatGroup, but with its own limits and precision,
+// and its quantized values are stored with an intGroup. A block is the three
+// component blocks, one after another.
+type vecGroup struct {
+	blockIndex
+	gt int64
+	comps [3]*intGroup
+	low, high [3]float64
+	pixels [3]int64
+	flags uint8
+	buf []int64 // Only used by writeData.
+	fbuf []float64 // Only used by writeData.
+	stats BlockStats // Only used by writeData.
+
+	// override replaces the Dequantization stored in flags if it's
+	// non-negative. Only set by Reader.SetDequantization.
+	override int
+}
+
+func newVecGroup(
+	startBlock, N int, gt int64, lim [3][2]float64, dx [3]float64, flags uint8,
+) *vecGroup {
+	g := &vecGroup{
+		blockIndex: *newBlockIndex(startBlock),
+		gt: gt, flags: flags, override: -1,
+	}
+	for k := 0; k < 3; k++ {
+		g.comps[k] = newIntGroup(startBlock, N).(*intGroup)
+		g.low[k], g.high[k] = lim[k][0], lim[k][1]
+		g.pixels[k] = int64(math.Ceil((lim[k][1] - lim[k][0]) / dx[k]))
+	}
+	return g
+}
+
+func newVecGroupFromTail(f io.Reader, gt int64) (*vecGroup, error) {
+	g := &vecGroup{ gt: gt, override: -1 }
+	for k := 0; k < 3; k++ {
+		ig, err := newIntGroupFromTail(f)
+		if err != nil { return nil, err }
+		g.comps[k] = ig.(*intGroup)
+	}
+	for _, x := range []interface{}{ &g.low, &g.high, &g.pixels, &g.flags } {
+		if err := binaryRead(f, x); err != nil { return nil, err }
+	}
+
+	blocks := g.comps[0].blocks()
+	start := g.comps[0].startBlock
+	for k := 1; k < 3; k++ {
+		if g.comps[k].blocks() != blocks || g.comps[k].startBlock != start {
+			return nil, fmt.Errorf("%w: components of %s have different " +
+				"blocks", ErrTypeMismatch, GroupNames[gt])
+		}
+	}
+
+	g.blockIndex = *newBlockIndex(int(start))
+	for b := int(start); b < int(start + blocks); b++ {
+		size := int64(0)
+		for k := 0; k < 3; k++ { size += g.comps[k].blockSize(b) }
+		g.addBlock(size)
+	}
+	return g, nil
+}
+
+func (g *vecGroup) writeTail(f io.Writer) error {
+	for k := 0; k < 3; k++ {
+		if err := g.comps[k].writeTail(f); err != nil { return err }
+	}
+	for _, x := range []interface{}{ g.low, g.high, g.pixels, g.flags } {
+		if err := binaryWrite(f, x); err != nil { return err }
+	}
+	return nil
+}
+
+func (g *vecGroup) groupType() int64 {
+	return g.gt
+}
+
+func (g *vecGroup) length(b int) int {
+	return g.comps[0].length(b)
+}
+
+func (g *vecGroup) setStartBlock(b int) {
+	g.blockIndex.setStartBlock(b)
+	for k := 0; k < 3; k++ { g.comps[k].setStartBlock(b) }
+}
+
+// dequantization returns the method used to reconstruct values.
+func (g *vecGroup) dequantization() Dequantization {
+	if g.override >= 0 { return Dequantization(g.override) }
+	return Dequantization((g.flags & floatModeMask) >> floatModeShift)
+}
+
+func (g *vecGroup) encoder() group {
+	enc := &vecGroup{
+		blockIndex: *newBlockIndex(0),
+		gt: g.gt, low: g.low, high: g.high, pixels: g.pixels,
+		flags: g.flags, override: -1,
+	}
+	for k := 0; k < 3; k++ {
+		enc.comps[k] = g.comps[k].encoder().(*intGroup)
+	}
+	return enc
+}
+
+func (g *vecGroup) appendBlock(enc group) {
+	e := enc.(*vecGroup)
+	g.appendIndex(&e.blockIndex)
+	for k := 0; k < 3; k++ { g.comps[k].appendBlock(e.comps[k]) }
+}
+
+func (g *vecGroup) writeData(f io.Writer, x interface{}) error {
+	n := sliceLen(x)
+	g.buf = resizeInt64(g.buf, n)
+	if cap(g.fbuf) < n { g.fbuf = make([]float64, n) }
+	g.fbuf = g.fbuf[:n]
+	periodic := g.flags & floatPeriodic != 0
+	g.stats = emptyStats()
+
+	size := int64(0)
+	for k := 0; k < 3; k++ {
+		dx := (g.high[k] - g.low[k]) / float64(g.pixels[k])
+		maxX := math.Nextafter(g.high[k], math.Inf(-1))
+
+		switch data := x.(type) {
+		case [][3]float32:
+			for i := range data { g.fbuf[i] = float64(data[i][k]) }
+		case [][3]float64:
+			for i := range data { g.fbuf[i] = data[i][k] }
+		default:
+			return fmt.Errorf("%w: got type %T for group %s",
+				ErrTypeMismatch, x, GroupNames[g.gt])
+		}
+
+		for i, v := range g.fbuf {
+			if math.IsNaN(v) { g.stats.Nulls++ }
+			if g.flags & floatLog != 0 { v = math.Log10(v) }
+			if periodic {
+				g.buf[i] = periodicCell((v - g.low[k]) / dx, g.pixels[k])
+				continue
+			}
+			// Clamp to [low, high), sending NaNs to low.
+			if !(v >= g.low[k]) { v = g.low[k] }
+			if v > maxX { v = maxX }
+			g.buf[i] = int64(math.Floor((v - g.low[k]) / dx))
+		}
+		if periodic {
+			min := periodicMin(g.buf, g.pixels[k])
+			bound(g.buf, min, g.pixels[k])
+		}
+		if n > 0 {
+			qMin, qMax := quantizedRange(g.buf, g.pixels[k], periodic)
+			s := cellStats(g.low[k], g.high[k], g.pixels[k], qMin, qMax,
+				g.flags & floatLog != 0)
+			g.stats.Min = math.Min(g.stats.Min, s.Min)
+			g.stats.Max = math.Max(g.stats.Max, s.Max)
+		}
+
+		b := int(g.startBlock + g.blocks())
+		if err := g.comps[k].writeData(f, g.buf); err != nil { return err }
+		size += g.comps[k].blockSize(b)
+	}
+
+	g.addBlock(size)
+	return nil
+}
+
+func (g *vecGroup) lastStats() BlockStats {
+	return g.stats
+}
+
+func (g *vecGroup) readData(data []byte, b int, x interface{}) error {
+	buf := getInt64s(g.length(b))
+	defer putInt64s(buf)
+
+	var set func(i, k int, v float64)
+	switch out := x.(type) {
+	case [][3]float32:
+		set = func(i, k int, v float64) { out[i][k] = float32(v) }
+	case [][3]float64:
+		set = func(i, k int, v float64) { out[i][k] = v }
+	default:
+		return fmt.Errorf("%w: got type %T for group %s",
+			ErrTypeMismatch, x, GroupNames[g.gt])
+	}
+
+	bIdx := int64(b) - g.startBlock
+	mode, seed := g.dequantization(), splitmix64(uint64(bIdx))
+	for k := 0; k < 3; k++ {
+		size := g.comps[k].blockSize(b)
+		if err := g.comps[k].readData(data[:size], b, *buf); err != nil {
+			return err
+		}
+		data = data[size:]
+		if g.flags & floatPeriodic != 0 { bound(*buf, 0, g.pixels[k]) }
+
+		dx := (g.high[k] - g.low[k]) / float64(g.pixels[k])
+		for i, q := range *buf {
+			var v float64
+			switch mode {
+			case Midpoint:
+				v = dx*(float64(q) + 0.5) + g.low[k]
+			case LowerEdge:
+				v = dx*float64(q) + g.low[k]
+			default:
+				r := splitmix64(seed + uint64(3*i + k))
+				u := float64(r >> 11) / (1 << 53)
+				v = dx*(float64(q) + u) + g.low[k]
+			}
+			if g.flags & floatLog != 0 { v = math.Pow(10, v) }
+			set(i, k, v)
+		}
+	}
+	return nil
+}
@@ -1,14 +1,28 @@
 package minnow
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
 	"math"
 	"os"
+	"sync/atomic"
+
+	"github.com/phil-mansfield/minnow/go/thread"
 )
 
 // MinnowWriter represents a new file which minnow blocks can be written into.
 type Writer struct {
-	f *os.File
+	f io.WriteSeeker
+	cw crcWriter
+	closer io.Closer
+	start int64
+	// sync is set when appending, so that the new tail is flushed to disk
+	// before the minnowHeader is changed to point to it.
+	sync bool
 
 	headers, blocks int
 
@@ -16,8 +30,34 @@ type Writer struct {
 
     writers []group
     headerOffsets, headerSizes []int64
+	headerNames, headerSchemas []string
 	groupBlocks []int64
     groupOffsets []int64
+	headerCRCs, blockCRCs []uint32
+	blockStats []BlockStats
+
+	// queue encodes blocks if SetConcurrency has been called, with at most
+	// inFlight blocks in it at once. err is the first error it returned.
+	queue *thread.Queue
+	inFlight int
+	err error
+
+	// fname is the name of the file if it was opened by Create or
+	// OpenAppend. If journalEvery > 0, a checkpoint is written to its journal
+	// after every journalEvery blocks. sinceJournal counts blocks since the
+	// last one.
+	fname string
+	journalEvery, sinceJournal int
+
+	// tmpName is the file that Create writes to before it's renamed to
+	// fname. appendSize and appendHeader are the original size and
+	// minnowHeader of a file opened by OpenAppend. closed is set once Close
+	// has been called and done is set once the Writer has been closed
+	// successfully or aborted.
+	tmpName string
+	appendSize int64
+	appendHeader minnowHeader
+	closed, done bool
 }
 
 // minnowHeader is the data block written before any user data is added to the
@@ -28,88 +68,474 @@ type minnowHeader struct {
 	TailStart int64
 }
 
-// Create creates a new minnow file and returns a corresponding Writer.
-func Create(fname string) *Writer {
-	f, err := os.Create(fname)
-	if err != nil { panic(err.Error()) }
+// Create creates a new minnow file and returns a corresponding Writer. The
+// file is written to a temporary file in the same directory, given by
+// TempName, and is only renamed to fname once Close succeeds, so fname never
+// holds a partially written file.
+func Create(fname string) (*Writer, error) {
+	f, err := createTemp(fname)
+	if err != nil { return nil, err }
 
-	wr := &Writer{ f: f, currGroup: -1 }
-	binaryWrite(wr.f, &minnowHeader{})
+	wr, err := NewWriter(f)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	wr.closer = f
+	wr.fname, wr.tmpName = fname, f.Name()
 
-	return wr
+	return wr, nil
 }
 
-// Header writes a header block to the file and returns its header index.
-func (wr *Writer) Header(x interface{}) int {
+// tempFiles counts the temporary files created by this process.
+var tempFiles uint64
+
+// createTemp creates a new temporary file for fname. Its name is unique to
+// this process, and files which already exist are never reused, so Writers
+// creating the same file don't write to the same temporary file.
+func createTemp(fname string) (*os.File, error) {
+	for {
+		n := atomic.AddUint64(&tempFiles, 1)
+		name := fmt.Sprintf("%s.%d-%d.tmp", fname, os.Getpid(), n)
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if !os.IsExist(err) { return f, err }
+	}
+}
+
+// TempName returns the name of the temporary file that a Writer returned by
+// Create writes to before it's renamed to its final name. It returns "" for
+// other Writers and once Close has renamed the file.
+func (wr *Writer) TempName() string { return wr.tmpName }
+
+// NewWriter returns a Writer which writes a minnow file to f, starting at f's
+// current position. Closing the Writer does not close f.
+func NewWriter(f io.WriteSeeker) (*Writer, error) {
+	start, err := f.Seek(0, 1)
+	if err != nil { return nil, err }
+
+	wr := &Writer{ f: f, start: start, currGroup: -1 }
+	wr.cw.w = f
+	if err := binaryWrite(wr.f, &minnowHeader{}); err != nil {
+		return nil, err
+	}
+	return wr, nil
+}
+
+// tell returns the current position of the Writer relative to the start of
+// the minnow file.
+func (wr *Writer) tell() (int64, error) {
 	pos, err := wr.f.Seek(0, 1)
+	return pos - wr.start, err
+}
+
+// MustCreate is the same as Create, but panics on errors.
+func MustCreate(fname string) *Writer {
+	wr, err := Create(fname)
 	if err != nil { panic(err.Error()) }
-	wr.headerOffsets = append(wr.headerOffsets, pos)
-	wr.headerSizes = append(wr.headerSizes, int64(binary.Size(x)))
+	return wr
+}
 
-	binaryWrite(wr.f, x)
+// Header writes a header block to the file and returns its header index.
+func (wr *Writer) Header(x interface{}) (int, error) {
+	if err := wr.drain(); err != nil { return -1, err }
+	pos, err := wr.tell()
+	if err != nil { return -1, err }
+
+	size := binary.Size(x)
+	if size < 0 {
+		return -1, fmt.Errorf("%w: header has type %T, which does not " +
+			"have a fixed size", ErrTypeMismatch, x)
+	}
+
+	wr.cw.crc = 0
+	if err := binaryWrite(&wr.cw, x); err != nil { return -1, err }
+
+	wr.headerOffsets = append(wr.headerOffsets, pos)
+	wr.headerSizes = append(wr.headerSizes, int64(size))
+	wr.headerNames = append(wr.headerNames, "")
+	wr.headerSchemas = append(wr.headerSchemas, schema(x))
+	wr.headerCRCs = append(wr.headerCRCs, wr.cw.crc)
 
 	wr.headers++
 	wr.currGroup = -1
 
-	return wr.headers - 1
+	return wr.headers - 1, nil
 }
 
 // FixedSizeGroup starts a "fixed size" group, meaning that each block only
-// contains in16s, uint64, float32s, etc. They are not compressed.
-func (wr *Writer) FixedSizeGroup(groupType int64, N int) {
-	wr.newGroup(newFixedSizeGroup(wr.blocks, N, groupType))
+// contains in16s, uint64, float32s, etc. They are not compressed. The group is
+// padded to start at a multiple of its element size, so OpenMmap can alias
+// its blocks.
+func (wr *Writer) FixedSizeGroup(groupType int64, N int) error {
+	if groupType < Int64Group || groupType > Float32Group {
+		return fmt.Errorf("%w: %d is not a fixed size group type",
+			ErrUnknownGroup, groupType)
+	}
+	g := newFixedSizeGroup(wr.blocks, N, groupType)
+	if err := wr.align(g.typeSize); err != nil { return err }
+	return wr.newGroup(g)
+}
+
+// align pads the file with zeros until its position is a multiple of size.
+// Readers find groups by their offsets, so they skip over the padding.
+func (wr *Writer) align(size int64) error {
+	if err := wr.drain(); err != nil { return err }
+	pos, err := wr.tell()
+	if err != nil { return err }
+	if pad := (size - pos % size) % size; pad > 0 {
+		_, err = wr.f.Write(make([]byte, pad))
+	}
+	return err
 }
 
 // IntGroup starts an integer group which stores int64s to the minimum
 // neccessary precision.
-func (wr *Writer) IntGroup(N int) {
-	wr.newGroup(newIntGroup(wr.blocks, N))
+func (wr *Writer) IntGroup(N int) error {
+	return wr.newGroup(newIntGroup(wr.blocks, N))
+}
+
+// FloatOption changes how a FloatGroup or EntropyFloatGroup stores its data.
+// Options are stored in the file, so readers decode the data correctly without
+// being told about them.
+type FloatOption struct {
+	mask, flags uint8
+}
+
+// Periodic causes the data to wrap around from the upper limit to the lower
+// limit. This is the default.
+func Periodic() FloatOption { return FloatOption{ floatPeriodic, floatPeriodic } }
+
+// NonPeriodic causes values outside the limits to be clamped to them.
+func NonPeriodic() FloatOption { return FloatOption{ floatPeriodic, 0 } }
+
+// Linear causes the data to be quantized linearly. This is the default.
+func Linear() FloatOption { return FloatOption{ floatLog, 0 } }
+
+// Log causes the base-10 logarithm of the data to be quantized instead of
+// the data itself. The limits and dx are then given in log10 units. Zero and
+// negative values have no logarithm and are stored as the lower limit.
+func Log() FloatOption { return FloatOption{ floatLog, floatLog } }
+
+// Dequantize sets the Dequantization that readers use to reconstruct values.
+// The default is Dither.
+func Dequantize(mode Dequantization) FloatOption {
+	return FloatOption{ floatModeMask, uint8(mode) << floatModeShift }
+}
+
+// floatFlags applies opts to the default float group flags.
+func floatFlags(opts []FloatOption) uint8 {
+	flags := floatPeriodic
+	for _, opt := range opts { flags = flags &^ opt.mask | opt.flags }
+	return flags
 }
 
 // FloatGroup starts a float group which stores float32s to within a precision
 // of dx. lim gives the lower and upper limits for the the data set. The data is
-// assumed to be periodic.
-func (wr *Writer) FloatGroup(N int, lim [2]float32, dx float32) {
+// assumed to be periodic unless the NonPeriodic option is given.
+func (wr *Writer) FloatGroup(
+	N int, lim [2]float32, dx float32, opts ...FloatOption,
+) error {
+	pixels := int64((math.Ceil(float64((lim[1] - lim[0]) / dx))))
+	ig := newIntGroup(wr.blocks, N).(*intGroup)
+	return wr.newGroup(newFloatGroup(ig, FloatGroup,
+		lim[0], lim[1], pixels, floatFlags(opts)))
+}
+
+// EntropyIntGroup starts an integer group which Huffman codes its int64s.
+// This is smaller than IntGroup when values have a skewed distribution.
+func (wr *Writer) EntropyIntGroup(N int) error {
+	return wr.newGroup(newEntropyIntGroup(wr.blocks, N))
+}
+
+// DeltaIntGroup starts an integer group for sorted or nearly sorted int64s,
+// like IDs. Blocks store the differences between neighboring elements, unless
+// that would take more space than IntGroup's encoding.
+func (wr *Writer) DeltaIntGroup(N int) error {
+	return wr.newGroup(newDeltaIntGroup(wr.blocks, N))
+}
+
+// LosslessFloatGroup starts a group which compresses float64s or float32s
+// without losing any precision. groupType must be LosslessFloat64Group or
+// LosslessFloat32Group.
+func (wr *Writer) LosslessFloatGroup(groupType int64, N int) error {
+	if groupType != LosslessFloat64Group && groupType != LosslessFloat32Group {
+		return fmt.Errorf("%w: %d is not a lossless float group type",
+			ErrUnknownGroup, groupType)
+	}
+	return wr.newGroup(newLosslessFloatGroup(wr.blocks, N, groupType))
+}
+
+// EntropyFloatGroup is the same as FloatGroup, but Huffman codes the quantized
+// values the same way EntropyIntGroup does.
+func (wr *Writer) EntropyFloatGroup(
+	N int, lim [2]float32, dx float32, opts ...FloatOption,
+) error {
 	pixels := int64((math.Ceil(float64((lim[1] - lim[0]) / dx))))
-	wr.newGroup(newFloatGroup(wr.blocks, N, lim[0], lim[1], pixels, true))
+	ig := newEntropyIntGroup(wr.blocks, N)
+	return wr.newGroup(newFloatGroup(ig, EntropyFloatGroup,
+		lim[0], lim[1], pixels, floatFlags(opts)))
+}
+
+// VecGroup starts a group whose blocks are [][3]float32 or [][3]float64
+// slices, like positions or velocities. groupType must be Vec32Group or
+// Vec64Group. Each component k is quantized the same way as FloatGroup, with
+// limits lim[k] and precision dx[k]. Computations are done in float64, so
+// Vec64Group can store values more precisely than a float32 could.
+func (wr *Writer) VecGroup(
+	groupType int64, N int, lim [3][2]float64, dx [3]float64,
+	opts ...FloatOption,
+) error {
+	if groupType != Vec32Group && groupType != Vec64Group {
+		return fmt.Errorf("%w: %d is not a vector group type",
+			ErrUnknownGroup, groupType)
+	}
+	return wr.newGroup(newVecGroup(wr.blocks, N, groupType,
+		lim, dx, floatFlags(opts)))
+}
+
+// BytesGroup starts a group whose blocks are [][]byte or []string slices. The
+// elements of each block are LZ compressed together.
+func (wr *Writer) BytesGroup(N int) error {
+	return wr.newGroup(newBytesGroup(wr.blocks, N))
+}
+
+// BoolGroup starts a group whose blocks are []bool slices, stored at one bit
+// per element.
+func (wr *Writer) BoolGroup(N int) error {
+	return wr.newGroup(newFlagGroup(wr.blocks, N, BoolGroup, 1))
+}
+
+// BitmaskGroup starts a group whose blocks are []uint64 bitmasks where only the
+// lowest bits bits may be set. Each element is stored using exactly bits bits,
+// so this is useful for columns which pack several flags together.
+func (wr *Writer) BitmaskGroup(N, bits int) error {
+	if bits < 1 || bits > 64 {
+		return fmt.Errorf("minnow: BitmaskGroup must have between 1 and 64 " +
+			"bits, not %d", bits)
+	}
+	return wr.newGroup(newFlagGroup(wr.blocks, N, BitmaskGroup, int64(bits)))
+}
+
+// Group starts a group of a user-defined type. id must have been registered
+// with RegisterGroup.
+func (wr *Writer) Group(id int64, g Group) error {
+	if _, ok := registeredGroup(id); !ok {
+		return fmt.Errorf("%w: group type %d has not been registered",
+			ErrUnknownGroup, id)
+	}
+	return wr.newGroup(&userGroup{ g: g, gt: id, startBlock: wr.blocks })
+}
+
+// CopyGroup adds a copy of group i of rd to the file. Its blocks are copied
+// without being decoded, along with their checksums and statistics. Like
+// Header, CopyGroup ends the current group, so another group must be started
+// before Data is called.
+func (wr *Writer) CopyGroup(rd *Reader, i int) error {
+	if i < 0 || i >= rd.groups {
+		return fmt.Errorf("minnow: group %d is not in the range [0, %d)",
+			i, rd.groups)
+	}
+
+	// The group is rebuilt from its tail so that rd isn't changed.
+	tail := &bytes.Buffer{ }
+	if err := rd.readers[i].writeTail(tail); err != nil { return err }
+	g, err := groupFromTail(tail, rd.groupTypes[i], wr.blocks)
+	if err != nil { return err }
+	g.setStartBlock(wr.blocks)
+
+	if gt := g.groupType(); gt >= Int64Group && gt <= Float32Group {
+		if err := wr.align(int64(fixedSizeBytes[gt])); err != nil {
+			return err
+		}
+	}
+	if err := wr.newGroup(g); err != nil { return err }
+	wr.currGroup = -1
+
+	for b := 0; b < rd.blocks; b++ {
+		if rd.blockIndex[b] != i { continue }
+		buf, err := rd.readBlock(b)
+		if err != nil { return err }
+		_, err = wr.f.Write(*buf)
+		crc := crc32.Checksum(*buf, crcTable)
+		putBytes(buf)
+		if err != nil { return err }
+
+		wr.blockCRCs = append(wr.blockCRCs, crc)
+		wr.blockStats = append(wr.blockStats, rd.blockStats[b])
+		wr.groupBlocks[len(wr.groupBlocks) - 1]++
+		wr.blocks++
+		if err := wr.journalBlock(); err != nil { return err }
+	}
+	return nil
 }
 
 // newGroup starts a new group.
-func (wr *Writer) newGroup(g group) {
+func (wr *Writer) newGroup(g group) error {
+	if err := wr.drain(); err != nil { return err }
+	pos, err := wr.tell()
+	if err != nil { return err }
+
 	wr.currGroup = g.groupType()
 
 	wr.writers = append(wr.writers, g)
 	wr.groupBlocks = append(wr.groupBlocks, 0)
-
-	pos, err := wr.f.Seek(0, 1)
-	if err != nil { panic(err.Error()) }
 	wr.groupOffsets = append(wr.groupOffsets, pos)
+
+	return nil
 }
 
-// Data writes a data block to the file within the most recent Group.
-func (wr *Writer) Data(x interface{}) int {
+// Data writes a data block to the file within the most recent Group and
+// returns its block index.
+func (wr *Writer) Data(x interface{}) (int, error) {
 	if wr.currGroup == -1 {
-		panic("Data written to minnow.Writer without assigning Group first.")
+		return -1, fmt.Errorf("%w: Data written to minnow.Writer without " +
+			"assigning Group first", ErrNoGroup)
 	} else if err := TypeMatch(x, wr.currGroup); err != nil {
-		panic(err.Error())
+		return -1, err
+	} else if wr.err != nil {
+		return -1, wr.err
 	}
 
 	writer := wr.writers[len(wr.writers) - 1]
-	writer.writeData(wr.f, x)
+	if cg, ok := writer.(concurrentGroup); ok && wr.queue != nil {
+		return wr.dataConcurrent(cg, x)
+	}
+	wr.cw.crc = 0
+	if err := writer.writeData(&wr.cw, x); err != nil { return -1, err }
 	
+	wr.blockCRCs = append(wr.blockCRCs, wr.cw.crc)
+	if sg, ok := writer.(statsGroup); ok {
+		wr.blockStats = append(wr.blockStats, sg.lastStats())
+	} else {
+		wr.blockStats = append(wr.blockStats, sliceStats(x))
+	}
 	wr.groupBlocks[len(wr.groupBlocks) - 1]++
 	wr.blocks++
-	return wr.blocks - 1
+	if err := wr.journalBlock(); err != nil { return -1, err }
+	return wr.blocks - 1, nil
 }
 
 // Close writes internal bookkeeping information to the end of the file
-// and closes it.
-func (wr *Writer) Close() {
-	defer wr.f.Close()
-	tailStart, err := wr.f.Seek(0, 1)
-	if err != nil { panic(err.Error()) }
+// and closes it if it was opened by Create. Files opened by Create are then
+// renamed to their final names. If the Writer is journaled, the journal is
+// removed once the file is complete. If Close fails, the partial file is left
+// behind for Recover, and Abort can be used to remove it instead.
+func (wr *Writer) Close() error {
+	if wr.closed || wr.done {
+		return fmt.Errorf("minnow: Writer is already closed")
+	}
+	wr.closed = true
 
-	// Write default tail.
+	err := wr.writeTail()
+	if wr.queue != nil {
+		wr.queue.Close()
+		wr.queue = nil
+	}
+	if s, ok := wr.f.(interface{ Sync() error }); ok && err == nil &&
+		wr.tmpName != "" {
+		// Otherwise, a crash after the rename could leave a partial file.
+		err = s.Sync()
+	}
+	if wr.closer != nil {
+		if cerr := wr.closer.Close(); err == nil { err = cerr }
+		wr.closer = nil
+	}
+	if err != nil { return err }
+
+	if wr.tmpName != "" {
+		if err := os.Rename(wr.tmpName, wr.fname); err != nil { return err }
+		wr.tmpName = ""
+	}
+	wr.done = true
+	if wr.journalEvery > 0 {
+		err = os.Remove(JournalFile(wr.fname))
+		if err != nil && !os.IsNotExist(err) { return err }
+		wr.journalEvery = 0
+	}
+	return nil
+}
+
+// Abort stops the Writer without completing the file. Files opened by Create
+// are removed, files opened by OpenAppend are truncated back to their
+// original contents, and the journal is removed. Files passed to NewWriter or
+// NewAppendWriter are left as they are and aren't closed. Abort can be called
+// after a failed Close, and does nothing after a successful one.
+func (wr *Writer) Abort() error {
+	// Files are removed even if closing fails, and the first error is
+	// returned.
+	var err error
+	if !wr.done {
+		wr.done = true
+		if wr.queue != nil {
+			wr.queue.Close()
+			wr.queue = nil
+		}
+		if wr.closer != nil {
+			err = wr.closer.Close()
+			wr.closer = nil
+		}
+		if wr.appendSize > 0 {
+			if rerr := wr.restore(); err == nil { err = rerr }
+		}
+	}
+
+	names := []string{ }
+	if wr.tmpName != "" { names = append(names, wr.tmpName) }
+	if wr.journalEvery > 0 { names = append(names, JournalFile(wr.fname)) }
+	for _, name := range names {
+		rerr := os.Remove(name)
+		if rerr != nil && !os.IsNotExist(rerr) && err == nil { err = rerr }
+	}
+	return err
+}
+
+// restore returns a file opened by OpenAppend to its original contents. A
+// failed Close may have already pointed the minnowHeader to the new tail, so
+// the original one is written back before the new data is truncated.
+func (wr *Writer) restore() error {
+	f, err := os.OpenFile(wr.fname, os.O_RDWR, 0)
+	if err != nil { return err }
+
+	hd := &bytes.Buffer{ }
+	err = binaryWrite(hd, wr.appendHeader)
+	if err == nil { _, err = f.WriteAt(hd.Bytes(), 0) }
+	if err == nil { err = f.Truncate(wr.appendSize) }
+	if cerr := f.Close(); err == nil { err = cerr }
+	return err
+}
+
+// writeTail writes the tail and the minnowHeader.
+func (wr *Writer) writeTail() error {
+	if err := wr.drain(); err != nil { return err }
+	tailStart, err := wr.tell()
+	if err != nil { return err }
+
+	hd, err := wr.encodeTail(wr.f, tailStart)
+	if err != nil { return err }
+
+	// Write the header and leave f at the end of the file.
+
+	end, err := wr.f.Seek(0, 1)
+	if err != nil { return err }
+	if err := wr.flush(); err != nil { return err }
+	_, err = wr.f.Seek(wr.start, 0)
+	if err != nil { return err }
+	
+	if err := binaryWrite(wr.f, hd); err != nil { return err }
+	if err := wr.flush(); err != nil { return err }
+	_, err = wr.f.Seek(end, 0)
+	return err
+}
+
+// encodeTail writes a tail starting at tailStart to f, followed by its
+// checksum, and returns the minnowHeader which points to it.
+func (wr *Writer) encodeTail(
+	f io.Writer, tailStart int64,
+) (minnowHeader, error) {
+	// Write default tail. Everything up to the tail checksum goes through cw.
+
+	cw := &crcWriter{ w: f }
 
 	groupTypes := make([]int64, len(wr.writers))
 	for i := range groupTypes {
@@ -121,26 +547,38 @@ func (wr *Writer) Close() {
 		groupTypes, wr.groupBlocks,
 	}
 	
+	hd := minnowHeader{ }
 	for _, data := range tailData {
-		binaryWrite(wr.f, data)
+		if err := binaryWrite(cw, data); err != nil { return hd, err }
 	}
 	for _, g := range wr.writers {
-		g.writeTail(wr.f)
+		if err := g.writeTail(cw); err != nil { return hd, err }
 	}
+	err := writeHeaderNames(cw, wr.headerNames, wr.headerSchemas)
+	if err != nil { return hd, err }
+	if err := wr.writeStats(cw); err != nil { return hd, err }
+	if err := binaryWrite(cw, wr.headerCRCs); err != nil { return hd, err }
+	if err := binaryWrite(cw, wr.blockCRCs); err != nil { return hd, err }
 
-	// Write the header.
-
-	_, err = wr.f.Seek(0, 0)
-	if err != nil { panic(err.Error()) }
-	
-	hd := minnowHeader{
+	hd = minnowHeader{
 		Magic, Version, uint64(len(wr.writers)),
 		uint64(wr.headers), uint64(wr.blocks), tailStart,
 	}
-	binaryWrite(wr.f, hd)
+
+	// The tail checksum also covers the minnowHeader.
+	hdCW := &crcWriter{ w: ioutil.Discard, crc: cw.crc }
+	if err := binaryWrite(hdCW, hd); err != nil { return hd, err }
+	return hd, binaryWrite(f, hdCW.crc)
+}
+
+// flush commits the file to disk if wr.sync is set and the file supports it.
+func (wr *Writer) flush() error {
+	if s, ok := wr.f.(interface{ Sync() error }); ok && wr.sync {
+		return s.Sync()
+	}
+	return nil
 }
 
-func binaryWrite(f *os.File, data interface{}) {
-    err := binary.Write(f, binary.LittleEndian, data)
-    if err != nil { panic(err.Error()) }
+func binaryWrite(f io.Writer, data interface{}) error {
+    return binary.Write(f, binary.LittleEndian, data)
 }
@@ -6,18 +6,33 @@ import numpy as np
 import gc
 
 MAGIC = 0xbaff1ed
+# This module writes version 0 files: log-scaled float columns are scaled
+# here rather than by minnow and each block of each column is its own group.
+# It reads files up to version 3, but only if every column has one of the
+# types in _supported_column_types. The Go Writer stores the other column
+# types in groups that the minnow module can't read, so opening those files
+# raises a minnow.UnsupportedGroupError.
 VERSION = 0
 
 _basic_file_type = 0
 _boundary_file_type = 1
 
-_column_buf_size = 232
+_supported_column_types = (
+    minnow.int64_group, minnow.int32_group, minnow.int16_group,
+    minnow.int8_group, minnow.uint64_group, minnow.uint32_group,
+    minnow.uint16_group, minnow.uint8_group, minnow.float64_group,
+    minnow.float32_group, minnow.int_group, minnow.float_group,
+    minnow.bool_group, minnow.bitmask_group
+)
+
+_column_buf_size = 228
 _column_type = np.dtype([
     ("type", np.int64),
     ("log", np.int32),
     ("low", np.float32),
     ("high", np.float32),
     ("dx", np.float32),
+    ("bits", np.int32),
     ("buf", "S%d" % _column_buf_size)
 ])
 assert(_column_type.itemsize == 256)
@@ -29,9 +44,11 @@ def open(fname):
     return Reader(fname)
 
 class Column(object):
-    def __init__(self, type, log=0, low=0, high=0, dx=0):
+    def __init__(self, type, log=0, low=0, high=0, dx=0, bits=0):
         self.type, self.log = type, log != 0
         self.low, self.high, self.dx = low, high, dx
+        # bits is the number of bits in each element of a bitmask column.
+        self.bits = bits
         
 class Writer(object):
     def __init__(self, fname):
@@ -43,6 +60,9 @@ class Writer(object):
         self.cells, self.L, self.boundary = 0, 0, 0
 
     def header(self, names, text, cols):
+        for col in cols:
+            if col.type not in _supported_column_types:
+                raise minnow.UnsupportedGroupError(col.type)
         self.cols = cols
         self.f.header(text.encode("ascii"))
         self.f.header("$".join(names).encode("ascii"))
@@ -54,6 +74,7 @@ class Writer(object):
             bin_cols["low"][i] = cols[i].low
             bin_cols["high"][i] = cols[i].high
             bin_cols["dx"][i] = cols[i].dx
+            bin_cols["bits"][i] = cols[i].bits
         
         self.f.header(bin_cols)
 
@@ -90,6 +111,14 @@ class Writer(object):
                 
                 self.f.float_group(len(cols[i]), lim, self.cols[i].dx)
                 self.f.data(buf)
+            elif col_type == minnow.bool_group:
+                self.f.bool_group(len(cols[i]))
+                self.f.data(cols[i])
+            elif col_type == minnow.bitmask_group:
+                self.f.bitmask_group(len(cols[i]), self.cols[i].bits)
+                self.f.data(cols[i])
+            else:
+                raise minnow.UnsupportedGroupError(col_type)
             
     def close(self):
         self.f.header(struct.pack("<ffq", self.L, self.boundary, self.cells))
@@ -101,9 +130,12 @@ class Reader(object):
     def __init__(self, fname):
         self.f = minnow.open(fname)
 
-        magic, version, self.file_type = self.f.header(0, "qqq")
+        magic, self.version, self.file_type = self.f.header(0, "qqq")
         assert(magic == MAGIC)
-        assert(version == VERSION)
+        # Version 1 files are log-scaled by the minnow float groups instead,
+        # and the boundary column of version 2 boundary files is a bool column.
+        # Version 3 basic files store each column in a single group.
+        assert(self.version in (0, 1, 2, 3))
 
         self.text = self.f.header(1, "s")
         self.names = self.f.header(2, "s")
@@ -117,7 +149,7 @@ class Reader(object):
             self.columns[i] = Column(
                 raw_columns["type"][i], raw_columns["log"][i], 
                 raw_columns["low"][i], raw_columns["high"][i], 
-                raw_columns["dx"][i]
+                raw_columns["dx"][i], raw_columns["bits"][i]
             )
             
         self.names = self.names.split("$")
@@ -148,14 +180,14 @@ class Reader(object):
             c = self.names.index(names[i])
             assert(c >= 0)
             
-            if self.file_type == _basic_file_type:
+            if self.file_type == _basic_file_type and self.version < 3:
                 idx = b*len(self.columns) + c
             else:
                 idx = b + c*self.blocks
 
             out[i] = self.f.data(idx)
 
-            if self.columns[c].log: out[i]=10**out[i]
+            if self.columns[c].log and self.version < 1: out[i]=10**out[i]
 
         return out
 
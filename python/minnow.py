@@ -1,7 +1,6 @@
 from __future__ import division, print_function
 
 import numpy as np
-import numpy.random as random
 import struct
 import sys
 import copy
@@ -9,6 +8,8 @@ import abc
 import bit
 
 MAGIC = 0xacedad
+# This module writes version 1 files, which have no checksums or block
+# statistics. The Go package reads these files without any trouble.
 VERSION = 1
 
 int64_group = 0
@@ -27,6 +28,50 @@ float32_group = 9
 int_group = 10
 float_group = 11
 
+# Group types 12 to 17 and 20 to 21 are written by the Go package (its minh
+# Writer uses them for columns with those types), but this module can't read
+# or write them. Neither can it read user-defined groups. Opening a file which
+# contains one of these groups raises an UnsupportedGroupError.
+entropy_int_group = 12
+entropy_float_group = 13
+delta_int_group = 14
+lossless_float64_group = 15
+lossless_float32_group = 16
+bytes_group = 17
+bool_group = 18
+bitmask_group = 19
+vec32_group = 20
+vec64_group = 21
+
+min_user_group = 1 << 16
+
+_unsupported_group_names = {
+    entropy_int_group: "EntropyIntGroup",
+    entropy_float_group: "EntropyFloatGroup",
+    delta_int_group: "DeltaIntGroup",
+    lossless_float64_group: "LosslessFloat64Group",
+    lossless_float32_group: "LosslessFloat32Group",
+    bytes_group: "BytesGroup",
+    vec32_group: "Vec32Group",
+    vec64_group: "Vec64Group",
+}
+
+class UnsupportedGroupError(ValueError):
+    """ UnsupportedGroupError is raised when a file uses a group type that
+    this module can't read or write.
+    """
+    def __init__(self, gt):
+        if gt in _unsupported_group_names:
+            name = _unsupported_group_names[gt]
+        elif gt >= min_user_group:
+            name = "user-defined group"
+        else:
+            name = "unknown group"
+        super(UnsupportedGroupError, self).__init__(
+            "unsupported group type %d (%s)" % (int(gt), name)
+        )
+        self.group_type = int(gt)
+
 _py_open = open
 
 def type_match(col_type, arr):
@@ -42,7 +87,9 @@ def type_match(col_type, arr):
     if col_type == float32_group: return arr.dtype == np.float32
     if col_type == int_group: return arr.dtype == np.int64
     if col_type == float_group: return arr.dtype == np.float32
-    assert(0)
+    if col_type == bool_group: return arr.dtype == np.bool_
+    if col_type == bitmask_group: return arr.dtype == np.uint64
+    raise UnsupportedGroupError(col_type)
 
 def create(fname): return Writer(fname)
 
@@ -83,6 +130,13 @@ class Writer(object):
         pixels = int(np.ceil((high - low) / dx))
         self._new_group(_FloatGroup(self.blocks, N, low, high, pixels, True))
 
+    def bool_group(self, N):
+        self._new_group(_FlagGroup(self.blocks, N, bool_group, 1))
+
+    def bitmask_group(self, N, bits):
+        assert(bits >= 1 and bits <= 64)
+        self._new_group(_FlagGroup(self.blocks, N, bitmask_group, bits))
+
     def _new_group(self, g):
         self.writers.append(g)
         self.group_blocks.append(0)
@@ -121,7 +175,12 @@ class Reader(object):
         min_hd = struct.unpack("<qqqqqq", f.read(6*8))
         magic, version, groups, headers, blocks, tail_start = min_hd
         assert(MAGIC == magic)
-        assert(VERSION == version)
+        # Version 2 only appends checksums to the end of the tail, which this
+        # reader ignores. Version 3 adds log scaling to float groups and
+        # version 4 adds variable-length blocks. Version 5 adds header names
+        # after the group tails and version 6 adds block statistics after
+        # those, which this reader also ignores.
+        assert(version in (1, 2, 3, 4, 5, 6))
 
         self.groups, self.headers, self.blocks = groups, headers, blocks
         self.f.seek(tail_start)
@@ -134,9 +193,15 @@ class Reader(object):
         self.group_types = np.frombuffer(f.read(8*groups), dtype=dtype)
         group_blocks = np.frombuffer(f.read(8*groups), dtype=dtype)
 
+        # Each group's tail has its own layout, so the rest of the tail can't
+        # be read past a group this module doesn't support.
         self.readers = [None]*groups
         for i in range(groups):
-            self.readers[i] = _group_from_tail(f, self.group_types[i])
+            try:
+                self.readers[i] = _group_from_tail(f, self.group_types[i])
+            except UnsupportedGroupError:
+                f.close()
+                raise
 
         self.block_index = np.zeros(blocks, dtype=np.int64)
         i0 = 0
@@ -172,7 +237,6 @@ class Reader(object):
         i = self.block_index[b]
         self.f.seek(self.group_offsets[i], 0)
         self.f.seek(self.readers[i].block_offset(b), 1)
-        random.seed(b)
         return self.readers[i].read_data(self.f, b)
         
     def data_type(self, b):
@@ -201,7 +265,9 @@ def _group_from_tail(f, gt):
         return _new_int_group_from_tail(f)
     elif gt == float_group:
         return _new_float_group_from_tail(f)
-    assert(0)
+    elif gt == bool_group or gt == bitmask_group:
+        return _new_flag_group_from_tail(f, gt)
+    raise UnsupportedGroupError(gt)
 
 _fixed_size_bytes = [8, 4, 2, 1, 8, 4, 2, 1, 8, 4]
 _fixed_size_dtypes = [
@@ -246,10 +312,24 @@ class _BlockIndex(object):
     def blocks(self):
         return len(self.offsets)
 
+# VARIABLE_LENGTH is the block length of groups whose blocks each have their
+# own length, stored in the tail.
+VARIABLE_LENGTH = -1
+
+def _read_lengths(f, N, blocks):
+    if N != VARIABLE_LENGTH: return None
+    dtype = np.dtype(np.int64).newbyteorder("<")
+    return np.frombuffer(f.read(8*blocks), dtype=dtype)
+
+def _block_len(g, b_idx):
+    if g.lengths is None: return g.N
+    return int(g.lengths[b_idx])
+
 class _FixedSizeGroup(_Group, _BlockIndex):
     def __init__(self, start_block, N, gt):
         _BlockIndex.__init__(self, start_block)
         self.N = N
+        self.lengths = None
         self.gt = gt
         self.type_size = _fixed_size_bytes[gt]
 
@@ -265,7 +345,8 @@ class _FixedSizeGroup(_Group, _BlockIndex):
 
     def read_data(self, f, b):
         dtype = _fixed_size_dtypes[self.gt]
-        return np.frombuffer(f.read(self.N*self.type_size), dtype=dtype)
+        n = _block_len(self, b - self.start_block)
+        return np.frombuffer(f.read(n*self.type_size), dtype=dtype)
 
     def block_offset(self, b):
         return _BlockIndex.block_offset(self, b)
@@ -277,8 +358,9 @@ class _FixedSizeGroup(_Group, _BlockIndex):
 def _new_fixed_size_group_from_tail(f, gt):
     N, start_block, blocks = struct.unpack("<qqq", f.read(24))
     g = _FixedSizeGroup(start_block, N, gt)
+    g.lengths = _read_lengths(f, N, blocks)
     for i in range(blocks):
-        g.add_block(g.type_size*g.N)
+        g.add_block(g.type_size*_block_len(g, i))
     return g    
 
 
@@ -286,6 +368,7 @@ class _IntGroup(_Group, _BlockIndex):
     def __init__(self, start_block, N):
         _BlockIndex.__init__(self, start_block)
         self.N = N
+        self.lengths = None
         self.mins = []
         self.bits = []
 
@@ -316,7 +399,7 @@ class _IntGroup(_Group, _BlockIndex):
     def read_data(self, f, b):
         b_idx = b - self.start_block
         bits, min = self.bits[b_idx], self.mins[b_idx]
-        b_array =  bit.read_array(f, bits, self.N)
+        b_array =  bit.read_array(f, bits, _block_len(self, b_idx))
         return np.asarray(b_array, dtype=np.int64) + min
 
     def block_offset(self, b):
@@ -328,6 +411,7 @@ class _IntGroup(_Group, _BlockIndex):
 def _new_int_group_from_tail(f):
     N, start_block, blocks = struct.unpack("<qqq", f.read(3*8))
     g = _IntGroup(start_block, N)
+    g.lengths = _read_lengths(f, N, blocks)
 
     def read():
         min, bits = struct.unpack("<qq", f.read(2*8))
@@ -338,7 +422,7 @@ def _new_int_group_from_tail(f):
     g.bits = read()
 
     for i in range(blocks):
-        g.add_block(bit.array_bytes(g.bits[i], g.N))
+        g.add_block(bit.array_bytes(g.bits[i], _block_len(g, i)))
 
     return g
     
@@ -346,6 +430,8 @@ class _FloatGroup(_Group, _BlockIndex):
     def __init__(self, start_block, N, low, high, pixels, periodic):
         self.low, self.high = low, high
         self.pixels, self.periodic = pixels, periodic
+        self.log = False
+        self.mode = _dither
         self.ig = _IntGroup(start_block, N)
 
     def group_type(self):
@@ -366,10 +452,33 @@ class _FloatGroup(_Group, _BlockIndex):
                             self.pixels, self.periodic))
     
     def read_data(self, f, b):
-        quant = self.ig.read_data(f, b)
+        """ read_data dequantizes block b the same way that the Go reader
+        does, in float32, so that both return the same values.
+        """
+        if self.mode not in (_dither, _midpoint, _lower_edge):
+            raise ValueError("unsupported dequantization mode %d" % self.mode)
+
+        quant = np.asarray(self.ig.read_data(f, b), dtype=np.int64)
         if self.periodic: bound(quant, 0, self.pixels)
-        dx = (self.high - self.low) / self.pixels
-        out = self.low + (quant + random.rand(len(quant)))*dx
+        low = np.float32(self.low)
+        dx = (np.float32(self.high) - low) / np.float32(self.pixels)
+
+        if self.mode == _midpoint:
+            cell = quant.astype(np.float32) + np.float32(0.5)
+        elif self.mode == _lower_edge:
+            cell = quant.astype(np.float32)
+        else:
+            # The dither is seeded by the block's index within its group.
+            seed = _splitmix64(b - self.ig.start_block)
+            i = np.arange(len(quant), dtype=np.uint64)
+            with np.errstate(over="ignore"):
+                r = _splitmix64(seed + i)
+            u = (r >> np.uint64(11)).astype(np.float64) / 2.0**53
+            cell = (quant.astype(np.float64) + u).astype(np.float32)
+
+        out = dx*cell + low
+        if self.log:
+            out = (10.0**out.astype(np.float64)).astype(np.float32)
         return out
 
     def block_offset(self, b):
@@ -381,12 +490,72 @@ class _FloatGroup(_Group, _BlockIndex):
 def _new_float_group_from_tail(f):
     g = _FloatGroup(0, 0, 0, 0, 0, 0)
     g.ig = _new_int_group_from_tail(f)
-    g.low, g.high, g.pixels, g.periodic = struct.unpack(
-        "<ffqc", f.read(2*4 + 8 + 1)
+    g.low, g.high, g.pixels, flags = struct.unpack(
+        "<ffqB", f.read(2*4 + 8 + 1)
     )
-    g.periodic = g.periodic != 0
+    g.periodic = (flags & 1) != 0
+    g.log = (flags & 2) != 0
+    g.mode = (flags >> 2) & 3
+    return g
+
+class _FlagGroup(_Group, _BlockIndex):
+    """ _FlagGroup stores bool_group and bitmask_group blocks, which are packed
+    at a fixed number of bits per element.
+    """
+    def __init__(self, start_block, N, gt, bits):
+        _BlockIndex.__init__(self, start_block)
+        self.N = N
+        self.lengths = None
+        self.gt, self.bits = gt, bits
+
+    def group_type(self):
+        return self.gt
+
+    def write_data(self, f, x):
+        bit.write_array(f, self.bits, np.asarray(x, dtype=np.uint64))
+        self.add_block(bit.array_bytes(self.bits, self.N))
+
+    def write_tail(self, f):
+        f.write(struct.pack("<qqqq", self.N, self.start_block,
+                            self.blocks(), self.bits))
+
+    def read_data(self, f, b):
+        n = _block_len(self, b - self.start_block)
+        out = bit.read_array(f, self.bits, n)
+        if self.gt == bool_group: return out != 0
+        return np.asarray(out, dtype=np.uint64)
+
+    def block_offset(self, b):
+        return _BlockIndex.block_offset(self, b)
+
+    def length(self):
+        return self.N
+
+def _new_flag_group_from_tail(f, gt):
+    N, start_block, blocks, bits = struct.unpack("<qqqq", f.read(4*8))
+    g = _FlagGroup(start_block, N, gt, bits)
+    g.lengths = _read_lengths(f, N, blocks)
+    for i in range(blocks):
+        g.add_block(bit.array_bytes(bits, _block_len(g, i)))
     return g
 
+# Dequantization modes, stored in bits 2 and 3 of float group flags from
+# version 3 onwards. Earlier files always use _dither.
+_dither = 0
+_midpoint = 1
+_lower_edge = 2
+
+def _splitmix64(x):
+    """ _splitmix64 is the hash used by the Go reader to generate dithering.
+    x is converted to a uint64 array.
+    """
+    x = np.asarray(x, dtype=np.uint64)
+    with np.errstate(over="ignore"):
+        x = x + np.uint64(0x9e3779b97f4a7c15)
+        x = (x ^ (x >> np.uint64(30))) * np.uint64(0xbf58476d1ce4e5b9)
+        x = (x ^ (x >> np.uint64(27))) * np.uint64(0x94d049bb133111eb)
+    return x ^ (x >> np.uint64(31))
+
 def bound(x, min, pixels):
     x[x < min] += pixels
     x[x >= min + pixels] -= pixels
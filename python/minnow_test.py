@@ -305,6 +305,34 @@ def test_minh_reader_writer():
         assert(len(rd_log) == len(block[4]))
         assert(np.all(eps_eq(np.log10(rd_log), np.log10(block[4]), 0.01)))
 
+def test_minh_flags():
+    fname = "../test_files/flags_minh.test"
+    names = ["flag", "mask"]
+    columns = [
+        minh.Column(minnow.bool_group),
+        minh.Column(minnow.bitmask_group, bits=3)
+    ]
+    blocks = [
+        [np.array([True, False, True, True], dtype=np.bool_),
+         np.array([7, 0, 5, 2], dtype=np.uint64)],
+        [np.array([False, False], dtype=np.bool_),
+         np.array([1, 6], dtype=np.uint64)]
+    ]
+
+    wr = minh.create(fname)
+    wr.header(names, "", columns)
+    for block in blocks: wr.block(block)
+    wr.close()
+
+    rd = minh.open(fname)
+    assert(rd.columns[1].bits == 3)
+    for b in range(len(blocks)):
+        flag, mask = rd.block(b, names)
+        assert(flag.dtype == np.bool_)
+        assert(np.all(flag == blocks[b][0]))
+        assert(np.all(mask == blocks[b][1]))
+    rd.close()
+
 def column_eq(c1, c2):
     return (c1.type == c2.type and c1.log == c2.log and 
             eps_eq(c1.dx, c2.dx, 1e-5) and
@@ -363,6 +391,7 @@ if __name__ == "__main__":
     test_bit_int_record()
     test_q_float_record()
     test_minh_reader_writer()
+    test_minh_flags()
     test_origin()
     test_normalize()
 
@@ -10,6 +10,7 @@ import (
 	"time"
 	"runtime"
 
+	minnow "github.com/phil-mansfield/minnow/go"
 	"github.com/phil-mansfield/minnow/go/minh"
 )
 
@@ -50,29 +51,60 @@ func OutName(outDir, hlist string) string {
 }
 
 func ConvertFile(inName, outName string, cells int, bnd float64) {
-	in := minh.Open(inName)
-	out := minh.CreateBoundary(outName)
+	in := minh.MustOpen(inName)
+	out := minh.MustCreateBoundary(outName)
+	// Abort removes the partial file if a panic stops the conversion, and
+	// does nothing once out is closed.
+	defer out.Abort()
 	defer in.Close()
-	defer out.Close()
 
-	out.Header(in.Text)
+	err := out.Header(in.Text)
+	if err != nil { panic(err.Error()) }
 	out.Geometry(in.L, float32(bnd), cells)
 	
-	coord := in.Floats([]string{"x", "y", "z"})
-	out.Coordinates(coord["x"], coord["y"], coord["z"])
+	coord, err := in.Floats([]string{"x", "y", "z"})
+	if err != nil { panic(err.Error()) }
+	err = out.Coordinates(coord["x"], coord["y"], coord["z"])
+	if err != nil { panic(err.Error()) }
 
 	for i := range in.Names {
 		runtime.GC()
 
 		var data interface{}
 
+		name := []string{ in.Names[i] }
 		switch in.Columns[i].Type {
-		case minh.Float, minh.Float32:
-			data = in.Floats([]string{in.Names[i]})[in.Names[i]]
-		case minh.Int, minh.Int64:
-			data = in.Ints([]string{in.Names[i]})[in.Names[i]]
+		case minh.Float, minh.Float32, minh.EntropyFloat, minh.LosslessFloat32:
+			var fx map[string][]float32
+			fx, err = in.Floats(name)
+			data = fx[in.Names[i]]
+		case minh.Int, minh.Int64, minh.EntropyInt, minh.DeltaInt:
+			var ix map[string][]int64
+			ix, err = in.Ints(name)
+			data = ix[in.Names[i]]
+		case minh.Bytes:
+			var sx map[string][]string
+			sx, err = in.Strings(name)
+			data = sx[in.Names[i]]
+		case minh.Bool:
+			var bx map[string][]bool
+			bx, err = in.Bools(name)
+			data = bx[in.Names[i]]
+		case minh.Bitmask:
+			var mx map[string][]uint64
+			mx, err = in.Bitmasks(name)
+			data = mx[in.Names[i]]
+		default:
+			err = fmt.Errorf("%w: column '%s' of %s has type flag %d, " +
+				"which can't be written to a boundary file",
+				minnow.ErrTypeMismatch, in.Names[i], inName,
+				in.Columns[i].Type)
 		}
+		if err != nil { panic(err.Error()) }
 		
-		out.Column(in.Names[i], in.Columns[i], data)
+		err = out.Column(in.Names[i], in.Columns[i], data)
+		if err != nil { panic(err.Error()) }
 	}
+
+	if err = out.Close(); err != nil { panic(err.Error()) }
 }
@@ -202,15 +202,18 @@ func ConvertFile(info *FileInfo, hlist, out string) {
 	fR.SetThreads(Threads)
 	fR.SetNames(allNames)
 
-	fM := minh.Create(out)
-	fM.Header(names, header, cols)
+	fM := minh.MustCreate(out)
+	err := fM.Header(names, header, cols)
+	if err != nil { panic(err.Error()) }
 	fM.Geometry(float32(info.Config.L), 0, 0)
 	for b := 0; b < fR.Blocks(); b++ {
 		fR.Block(b, names, buf)
 		n := GenericCut(cutoff, buf[iMass], buf)
-		if n > 0 { fM.Block(buf) }
+		if n > 0 {
+			if err = fM.Block(buf); err != nil { panic(err.Error()) }
+		}
 	}
-	fM.Close()
+	if err = fM.Close(); err != nil { panic(err.Error()) }
 }
 
 func find(names []string, name string) int {
@@ -231,9 +234,16 @@ func ParseTypeString(
 	case "float32":
 		buf = append(buf, []float32{ })
 		cols = append(cols, minh.Column{Type: minh.Float32})
+	case "lossless_float32":
+		buf = append(buf, []float32{ })
+		cols = append(cols, minh.Column{Type: minh.LosslessFloat32})
 	case "int":
 		buf = append(buf, []int64{ })
 		cols = append(cols, minh.Column{Type: minh.Int})
+	case "delta_int":
+		// Best for sorted or nearly sorted columns, like IDs.
+		buf = append(buf, []int64{ })
+		cols = append(cols, minh.Column{Type: minh.DeltaInt})
 	case "q_float":
 		col := minh.Column{Type: minh.Float}
 		switch t[1] {